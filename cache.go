@@ -0,0 +1,423 @@
+package plp
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// valores padrão dos campos zerados do CachedClient
+const (
+	ttlCEP              = 24 * time.Hour
+	ttlCEPNaoEncontrado = time.Hour
+	ttlServicos         = time.Hour
+	prefixoCache        = "plp:cache"
+)
+
+// Cache armazenamento de valores com prazo de validade, seguro para uso concorrente
+type Cache interface {
+	// Get devolve o valor da chave e se ele foi encontrado e ainda é válido
+	Get(ctx context.Context, chave string) ([]byte, bool, error)
+	// Set guarda o valor da chave por ttl, zero para sem prazo
+	Set(ctx context.Context, chave string, valor []byte, ttl time.Duration) error
+	// Delete remove a chave
+	Delete(ctx context.Context, chave string) error
+}
+
+// LRUCache cache em memória com no máximo Capacidade itens, descartando os usados
+// há mais tempo
+type LRUCache struct {
+	mu         sync.Mutex
+	capacidade int
+	lista      *list.List
+	itens      map[string]*list.Element
+}
+
+type itemLRU struct {
+	chave  string
+	valor  []byte
+	expira time.Time
+}
+
+// NewLRUCache cria um LRUCache com a capacidade informada
+func NewLRUCache(capacidade int) *LRUCache {
+	if capacidade <= 0 {
+		capacidade = 1
+	}
+	return &LRUCache{
+		capacidade: capacidade,
+		lista:      list.New(),
+		itens:      make(map[string]*list.Element),
+	}
+}
+
+// Get devolve o valor da chave, removendo-o se estiver vencido
+func (c *LRUCache) Get(ctx context.Context, chave string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.itens[chave]
+	if !ok {
+		return nil, false, nil
+	}
+	it := el.Value.(*itemLRU)
+	if !it.expira.IsZero() && time.Now().After(it.expira) {
+		c.lista.Remove(el)
+		delete(c.itens, chave)
+		return nil, false, nil
+	}
+	c.lista.MoveToFront(el)
+	return append([]byte(nil), it.valor...), true, nil
+}
+
+// Set guarda o valor da chave, descartando o item usado há mais tempo quando o
+// cache está cheio
+func (c *LRUCache) Set(ctx context.Context, chave string, valor []byte, ttl time.Duration) error {
+	it := &itemLRU{chave: chave, valor: append([]byte(nil), valor...)}
+	if ttl > 0 {
+		it.expira = time.Now().Add(ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.itens[chave]; ok {
+		el.Value = it
+		c.lista.MoveToFront(el)
+		return nil
+	}
+	c.itens[chave] = c.lista.PushFront(it)
+	for c.lista.Len() > c.capacidade {
+		el := c.lista.Back()
+		c.lista.Remove(el)
+		delete(c.itens, el.Value.(*itemLRU).chave)
+	}
+	return nil
+}
+
+// Delete remove a chave
+func (c *LRUCache) Delete(ctx context.Context, chave string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.itens[chave]; ok {
+		c.lista.Remove(el)
+		delete(c.itens, chave)
+	}
+	return nil
+}
+
+// Len quantidade de itens no cache, incluindo os vencidos ainda não removidos
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lista.Len()
+}
+
+// RedisCache cache guardado no REDIS, compartilhado entre processos
+type RedisCache struct {
+	// Redis conexões com o REDIS, nil para o RedisStore iniciado por IniRedis
+	Redis *RedisStore
+	// Prefixo prefixo das chaves no REDIS, padrão "plp:cache"
+	Prefixo string
+}
+
+// NewRedisCache cria um RedisCache sobre o RedisStore informado
+func NewRedisCache(s *RedisStore) *RedisCache {
+	return &RedisCache{Redis: s}
+}
+
+// Get devolve o valor da chave
+func (c *RedisCache) Get(ctx context.Context, chave string) ([]byte, bool, error) {
+	conn, err := c.conexao(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer conn.Close()
+	v, err := redis.Bytes(conn.Do("GET", c.chave(chave)))
+	if err == redis.ErrNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("plp cache get %s: %w", chave, err)
+	}
+	return v, true, nil
+}
+
+// Set guarda o valor da chave
+func (c *RedisCache) Set(ctx context.Context, chave string, valor []byte, ttl time.Duration) error {
+	conn, err := c.conexao(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	args := []interface{}{c.chave(chave), valor}
+	if ttl > 0 {
+		args = append(args, "PX", int64(ttl/time.Millisecond))
+	}
+	if _, err := conn.Do("SET", args...); err != nil {
+		return fmt.Errorf("plp cache set %s: %w", chave, err)
+	}
+	return nil
+}
+
+// Delete remove a chave
+func (c *RedisCache) Delete(ctx context.Context, chave string) error {
+	conn, err := c.conexao(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Do("DEL", c.chave(chave)); err != nil {
+		return fmt.Errorf("plp cache delete %s: %w", chave, err)
+	}
+	return nil
+}
+
+func (c *RedisCache) conexao(ctx context.Context) (redis.Conn, error) {
+	s := c.Redis
+	if s == nil {
+		var err error
+		if s, err = redisAtual(); err != nil {
+			return nil, err
+		}
+	}
+	return s.Conn(ctx)
+}
+
+func (c *RedisCache) chave(chave string) string {
+	prefixo := c.Prefixo
+	if prefixo == "" {
+		prefixo = prefixoCache
+	}
+	return prefixo + ":" + chave
+}
+
+// MetricasCache contadores das consultas ao cache, seguros para uso concorrente
+type MetricasCache struct {
+	acertos   int64
+	negativos int64
+	faltas    int64
+	erros     int64
+}
+
+// EstatisticasCache valores dos contadores de MetricasCache
+type EstatisticasCache struct {
+	// Acertos consultas respondidas pelo cache, incluindo AcertosNegativos
+	Acertos int64
+	// AcertosNegativos consultas respondidas pelo cache com ErrCEPNaoEncontrado
+	AcertosNegativos int64
+	// Faltas consultas encaminhadas ao SIGEPWEB
+	Faltas int64
+	// Erros falhas de leitura ou gravação do cache, que não interrompem a consulta
+	Erros int64
+}
+
+// TaxaAcerto fração das consultas respondidas pelo cache, zero sem consultas
+func (e EstatisticasCache) TaxaAcerto() float64 {
+	total := e.Acertos + e.Faltas
+	if total == 0 {
+		return 0
+	}
+	return float64(e.Acertos) / float64(total)
+}
+
+// Estatisticas valores atuais dos contadores
+func (m *MetricasCache) Estatisticas() EstatisticasCache {
+	return EstatisticasCache{
+		Acertos:          atomic.LoadInt64(&m.acertos),
+		AcertosNegativos: atomic.LoadInt64(&m.negativos),
+		Faltas:           atomic.LoadInt64(&m.faltas),
+		Erros:            atomic.LoadInt64(&m.erros),
+	}
+}
+
+// Zera reinicia os contadores
+func (m *MetricasCache) Zera() {
+	atomic.StoreInt64(&m.acertos, 0)
+	atomic.StoreInt64(&m.negativos, 0)
+	atomic.StoreInt64(&m.faltas, 0)
+	atomic.StoreInt64(&m.erros, 0)
+}
+
+// CachedClient Client cujas chamadas ConsultaCEP e BuscaServicos passam pelo
+// Cache. Os CEPs não encontrados também são guardados, por TTLCEPNaoEncontrado.
+// Falhas do cache são contadas em Metricas e não impedem a chamada ao SIGEPWEB.
+// Campos zerados assumem os valores padrão; com Cache nil, as chamadas vão
+// direto ao SIGEPWEB.
+type CachedClient struct {
+	*Client
+	Cache Cache
+	// TTLCEP validade dos endereços, padrão 24h
+	TTLCEP time.Duration
+	// TTLCEPNaoEncontrado validade dos CEPs não encontrados, padrão 1h
+	TTLCEPNaoEncontrado time.Duration
+	// TTLServicos validade dos serviços do contrato, padrão 1h
+	TTLServicos time.Duration
+	// Metricas contadores das consultas, nil para não contar
+	Metricas *MetricasCache
+}
+
+// NewCachedClient cria um CachedClient com os valores padrão e suas próprias métricas
+func NewCachedClient(c *Client, cache Cache) *CachedClient {
+	return &CachedClient{Client: c, Cache: cache, Metricas: &MetricasCache{}}
+}
+
+// ConsultaCEP obtém o endereco correspondente ao CEP do cache ou do SIGEPWEB
+func (c *CachedClient) ConsultaCEP(cep string) (Endereco, error) {
+	return c.ConsultaCEPContext(context.Background(), cep)
+}
+
+// ConsultaCEPContext é a variante de ConsultaCEP que respeita o prazo e o cancelamento de ctx
+func (c *CachedClient) ConsultaCEPContext(ctx context.Context, cep string) (Endereco, error) {
+	if c.Cache == nil {
+		return c.Client.ConsultaCEPContext(ctx, cep)
+	}
+	chave := "cep:" + normalizaCEP(cep)
+	m := c.metricas()
+	endereco := Endereco{}
+	if v, ok := c.busca(ctx, chave); ok {
+		// valor vazio indica CEP não encontrado
+		if len(v) == 0 {
+			c.conta(&m.acertos)
+			c.conta(&m.negativos)
+			return endereco, fmt.Errorf("sigep consultaCEP: %w", ErrCEPNaoEncontrado)
+		}
+		if err := json.Unmarshal(v, &endereco); err == nil {
+			c.conta(&m.acertos)
+			return endereco, nil
+		}
+		c.invalido(m)
+	}
+	endereco, err := c.Client.ConsultaCEPContext(ctx, cep)
+	switch {
+	case errors.Is(err, ErrCEPNaoEncontrado):
+		c.guarda(ctx, chave, []byte{}, c.ttl(c.TTLCEPNaoEncontrado, ttlCEPNaoEncontrado))
+	case err == nil:
+		c.guardaJSON(ctx, chave, endereco, c.ttl(c.TTLCEP, ttlCEP))
+	}
+	return endereco, err
+}
+
+// BuscaServicos obtém os serviços do contrato do cache ou do SIGEPWEB
+func (c *CachedClient) BuscaServicos(contrato string, cartao string) ([]Servico, error) {
+	return c.BuscaServicosContext(context.Background(), contrato, cartao)
+}
+
+// BuscaServicosContext é a variante de BuscaServicos que respeita o prazo e o cancelamento de ctx
+func (c *CachedClient) BuscaServicosContext(ctx context.Context, contrato string, cartao string) ([]Servico, error) {
+	if c.Cache == nil {
+		return c.Client.BuscaServicosContext(ctx, contrato, cartao)
+	}
+	chave := "servicos:" + strings.TrimSpace(contrato) + ":" + strings.TrimSpace(cartao)
+	m := c.metricas()
+	var servicos []Servico
+	if v, ok := c.busca(ctx, chave); ok {
+		if err := json.Unmarshal(v, &servicos); err == nil {
+			c.conta(&m.acertos)
+			return servicos, nil
+		}
+		c.invalido(m)
+	}
+	servicos, err := c.Client.BuscaServicosContext(ctx, contrato, cartao)
+	if err == nil {
+		c.guardaJSON(ctx, chave, servicos, c.ttl(c.TTLServicos, ttlServicos))
+	}
+	return servicos, err
+}
+
+// busca consulta o cache, contando faltas e erros. O acerto só é contado pelo
+// chamador, depois de decodificado o valor.
+func (c *CachedClient) busca(ctx context.Context, chave string) ([]byte, bool) {
+	m := c.metricas()
+	v, ok, err := c.Cache.Get(ctx, chave)
+	if err != nil {
+		c.conta(&m.erros)
+	}
+	if err != nil || !ok {
+		c.conta(&m.faltas)
+		return nil, false
+	}
+	return v, true
+}
+
+// invalido conta o valor do cache que não pôde ser decodificado como erro e
+// falta, já que a consulta segue para o SIGEPWEB
+func (c *CachedClient) invalido(m *MetricasCache) {
+	c.conta(&m.erros)
+	c.conta(&m.faltas)
+}
+
+func (c *CachedClient) guardaJSON(ctx context.Context, chave string, v interface{}, ttl time.Duration) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		c.conta(&c.metricas().erros)
+		return
+	}
+	c.guarda(ctx, chave, b, ttl)
+}
+
+func (c *CachedClient) guarda(ctx context.Context, chave string, v []byte, ttl time.Duration) {
+	if err := c.Cache.Set(ctx, chave, v, ttl); err != nil {
+		c.conta(&c.metricas().erros)
+	}
+}
+
+// metricas devolve Metricas ou contadores descartáveis quando nil
+func (c *CachedClient) metricas() *MetricasCache {
+	if c.Metricas == nil {
+		return &MetricasCache{}
+	}
+	return c.Metricas
+}
+
+func (c *CachedClient) conta(contador *int64) {
+	atomic.AddInt64(contador, 1)
+}
+
+func (c *CachedClient) ttl(ttl time.Duration, padrao time.Duration) time.Duration {
+	if ttl <= 0 {
+		return padrao
+	}
+	return ttl
+}
+
+// normalizaCEP mantém apenas os dígitos do CEP
+func normalizaCEP(cep string) string {
+	return strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, cep)
+}
+
+var (
+	muCache       sync.RWMutex
+	cachePadrao   Cache
+	metricasCache = &MetricasCache{}
+)
+
+// DefineCache define o cache usado pelas funções ConsultaCEP e BuscaServicos do
+// pacote. Com c nil, as consultas voltam a ir direto ao SIGEPWEB.
+func DefineCache(c Cache) {
+	muCache.Lock()
+	cachePadrao = c
+	muCache.Unlock()
+}
+
+// MetricasCachePadrao devolve as métricas do cache definido por DefineCache
+func MetricasCachePadrao() *MetricasCache {
+	return metricasCache
+}
+
+// clienteLegadoCache monta um CachedClient sobre o clienteLegado com o cache do pacote
+func clienteLegadoCache(usuario string, senha string) *CachedClient {
+	muCache.RLock()
+	defer muCache.RUnlock()
+	return &CachedClient{Client: clienteLegado(usuario, senha), Cache: cachePadrao, Metricas: metricasCache}
+}
@@ -0,0 +1,175 @@
+package plp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RogerioML/plp/sigeptest"
+)
+
+func TestLRUCacheDescartaUsadoHaMaisTempo(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(2)
+	c.Set(ctx, "a", []byte("1"), 0)
+	c.Set(ctx, "b", []byte("2"), 0)
+	if _, ok, _ := c.Get(ctx, "a"); !ok {
+		t.Fatal("a não encontrada")
+	}
+	c.Set(ctx, "c", []byte("3"), 0)
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("b, usada há mais tempo, não foi descartada")
+	}
+	for _, chave := range []string{"a", "c"} {
+		if _, ok, _ := c.Get(ctx, chave); !ok {
+			t.Errorf("%s descartada", chave)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, esperado 2", c.Len())
+	}
+
+	c.Delete(ctx, "a")
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Error("a encontrada após Delete")
+	}
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(10)
+	c.Set(ctx, "curta", []byte("1"), 20*time.Millisecond)
+	c.Set(ctx, "eterna", []byte("2"), 0)
+	if v, ok, _ := c.Get(ctx, "curta"); !ok || string(v) != "1" {
+		t.Fatalf("Get(curta) = %q, %v antes do prazo", v, ok)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok, _ := c.Get(ctx, "curta"); ok {
+		t.Error("curta encontrada após o prazo")
+	}
+	if _, ok, _ := c.Get(ctx, "eterna"); !ok {
+		t.Error("eterna vencida")
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d, esperado 1 após remover a vencida", c.Len())
+	}
+}
+
+// clienteCache CachedClient do servidor com um LRUCache
+func clienteCache(srv *sigeptest.Server) *CachedClient {
+	return NewCachedClient(NewClient(srv.URL, srv.Usuario, srv.Senha), NewLRUCache(10))
+}
+
+func TestCachedClientConsultaCEP(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	srv.AdicionaCEP("70002900", sigeptest.Endereco{Cep: "70002900", Cidade: "Brasília", UF: "DF"})
+	c := clienteCache(srv)
+
+	for _, cep := range []string{"70002-900", "70002900", " 70002900"} {
+		e, err := c.ConsultaCEP(cep)
+		if err != nil {
+			t.Fatalf("ConsultaCEP(%q): %v", cep, err)
+		}
+		if e.Cidade != "Brasília" {
+			t.Errorf("ConsultaCEP(%q) = %+v", cep, e)
+		}
+	}
+	if n := srv.Chamadas("consultaCEP"); n != 1 {
+		t.Errorf("chamadas = %d, esperado 1", n)
+	}
+	esperado := EstatisticasCache{Acertos: 2, Faltas: 1}
+	if e := c.Metricas.Estatisticas(); e != esperado {
+		t.Errorf("Estatisticas() = %+v, esperado %+v", e, esperado)
+	}
+	if taxa := c.Metricas.Estatisticas().TaxaAcerto(); taxa < 0.66 || taxa > 0.67 {
+		t.Errorf("TaxaAcerto() = %f, esperado 2/3", taxa)
+	}
+}
+
+func TestCachedClientCEPNaoEncontrado(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	c := clienteCache(srv)
+	c.TTLCEPNaoEncontrado = 20 * time.Millisecond
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.ConsultaCEP("00000000"); !errors.Is(err, ErrCEPNaoEncontrado) {
+			t.Fatalf("ConsultaCEP %d = %v, esperado ErrCEPNaoEncontrado", i+1, err)
+		}
+	}
+	if n := srv.Chamadas("consultaCEP"); n != 1 {
+		t.Errorf("chamadas = %d, esperado 1", n)
+	}
+	esperado := EstatisticasCache{Acertos: 1, AcertosNegativos: 1, Faltas: 1}
+	if e := c.Metricas.Estatisticas(); e != esperado {
+		t.Errorf("Estatisticas() = %+v, esperado %+v", e, esperado)
+	}
+
+	// vencido o prazo do negativo, o CEP recém cadastrado é encontrado
+	srv.AdicionaCEP("00000000", sigeptest.Endereco{Cep: "00000000", Cidade: "Nova"})
+	time.Sleep(30 * time.Millisecond)
+	if e, err := c.ConsultaCEP("00000000"); err != nil || e.Cidade != "Nova" {
+		t.Errorf("ConsultaCEP após o prazo = %+v, %v", e, err)
+	}
+}
+
+func TestCachedClientValorInvalidoNaoContaAcerto(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	c := clienteCache(srv)
+	ctx := context.Background()
+	c.Cache.Set(ctx, "servicos:9912208555:0067599079", []byte("{inválido"), 0)
+
+	servicos, err := c.BuscaServicos("9912208555", "0067599079")
+	if err != nil || len(servicos) == 0 {
+		t.Fatalf("BuscaServicos = %v, %v", servicos, err)
+	}
+	esperado := EstatisticasCache{Faltas: 1, Erros: 1}
+	if e := c.Metricas.Estatisticas(); e != esperado {
+		t.Errorf("Estatisticas() = %+v, esperado %+v", e, esperado)
+	}
+
+	// o valor do SIGEPWEB substitui o inválido
+	c.Metricas.Zera()
+	if _, err := c.BuscaServicos("9912208555", "0067599079"); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Chamadas("buscaServicos"); n != 1 {
+		t.Errorf("chamadas = %d, esperado 1", n)
+	}
+	esperado = EstatisticasCache{Acertos: 1}
+	if e := c.Metricas.Estatisticas(); e != esperado {
+		t.Errorf("Estatisticas() após Zera = %+v, esperado %+v", e, esperado)
+	}
+}
+
+// cacheFalho Cache cujas operações sempre falham
+type cacheFalho struct{}
+
+func (cacheFalho) Get(ctx context.Context, chave string) ([]byte, bool, error) {
+	return nil, false, errors.New("cache fora")
+}
+
+func (cacheFalho) Set(ctx context.Context, chave string, valor []byte, ttl time.Duration) error {
+	return errors.New("cache fora")
+}
+
+func (cacheFalho) Delete(ctx context.Context, chave string) error {
+	return errors.New("cache fora")
+}
+
+func TestCachedClientCacheFalho(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	c := NewCachedClient(NewClient(srv.URL, srv.Usuario, srv.Senha), cacheFalho{})
+
+	if _, err := c.BuscaServicos("9912208555", "0067599079"); err != nil {
+		t.Fatalf("BuscaServicos com cache fora: %v", err)
+	}
+	esperado := EstatisticasCache{Faltas: 1, Erros: 2}
+	if e := c.Metricas.Estatisticas(); e != esperado {
+		t.Errorf("Estatisticas() = %+v, esperado %+v", e, esperado)
+	}
+}
@@ -0,0 +1,415 @@
+package plp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client mantém a configuração de acesso ao SIGEPWEB de um contrato: endereço do
+// serviço, credenciais e o *http.Client usado nas chamadas. Um mesmo Client pode
+// ser usado por várias goroutines simultaneamente; os campos não devem ser
+// alterados depois da primeira chamada.
+type Client struct {
+	// Wsdl endereço do serviço AtendeCliente do SIGEPWEB
+	Wsdl    string
+	Usuario string
+	Senha   string
+	// HTTPClient cliente HTTP usado nas chamadas. Quando nulo, o Client cria o seu
+	// próprio, usando Transport, a configuração TLS e Timeout.
+	HTTPClient *http.Client
+	// Transport transporte do cliente HTTP criado pelo Client. Quando nulo, é usada
+	// uma cópia do http.DefaultTransport com a configuração TLS abaixo.
+	Transport http.RoundTripper
+	// TLSConfig configuração TLS base do transporte criado pelo Client. Quando nula,
+	// o certificado do servidor é verificado com as autoridades do sistema.
+	TLSConfig *tls.Config
+	// RootCAs autoridades certificadoras aceitas para o certificado do servidor,
+	// substituindo as do sistema
+	RootCAs *x509.CertPool
+	// Certificates certificados apresentados pelo cliente, para autenticação mútua
+	Certificates []tls.Certificate
+	// InsecureSkipVerify desabilita a verificação do certificado do servidor.
+	// Deve ser usado apenas em ambientes de homologação.
+	InsecureSkipVerify bool
+	// Timeout tempo máximo de cada chamada ao SIGEPWEB, zero indica sem limite
+	Timeout time.Duration
+	// Retry política de novas tentativas, nula para tentar uma única vez
+	Retry *RetryPolicy
+	// Breaker circuito que interrompe as chamadas enquanto o SIGEPWEB estiver fora
+	Breaker *CircuitBreaker
+
+	once sync.Once
+	hc   *http.Client
+}
+
+// ErrTimeout indica que uma chamada ao SIGEPWEB excedeu o prazo do contexto ou o
+// Timeout do Client. O erro devolvido nesses casos também satisfaz
+// errors.Is(err, context.DeadlineExceeded) quando o prazo veio do contexto.
+var ErrTimeout = errors.New("sigep: tempo limite excedido")
+
+// erroTimeout associa a operação e o erro original a ErrTimeout
+type erroTimeout struct {
+	operacao string
+	err      error
+}
+
+func (e *erroTimeout) Error() string {
+	return fmt.Sprintf("sigep %s: tempo limite excedido: %s", e.operacao, e.err)
+}
+
+func (e *erroTimeout) Unwrap() error { return e.err }
+
+func (e *erroTimeout) Is(target error) bool { return target == ErrTimeout }
+
+// Timeout permite que o erro seja tratado como net.Error
+func (e *erroTimeout) Timeout() bool { return true }
+
+// NewClient cria um Client para o endereço e as credenciais informados
+func NewClient(wsdl string, usuario string, senha string) *Client {
+	return &Client{
+		Wsdl:    wsdl,
+		Usuario: usuario,
+		Senha:   senha,
+	}
+}
+
+// httpClient devolve o cliente HTTP do Client, criando-o na primeira chamada.
+// O http.DefaultClient e o http.DefaultTransport nunca são alterados.
+func (c *Client) httpClient() *http.Client {
+	c.once.Do(func() {
+		if c.HTTPClient != nil {
+			c.hc = c.HTTPClient
+			return
+		}
+		transport := c.Transport
+		if transport == nil {
+			t := http.DefaultTransport.(*http.Transport).Clone()
+			t.TLSClientConfig = c.tlsConfig()
+			transport = t
+		}
+		c.hc = &http.Client{
+			Timeout:   c.Timeout,
+			Transport: transport,
+		}
+	})
+	return c.hc
+}
+
+// tlsConfig monta a configuração TLS do transporte a partir de TLSConfig,
+// RootCAs, Certificates e InsecureSkipVerify
+func (c *Client) tlsConfig() *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.TLSConfig != nil {
+		cfg = c.TLSConfig.Clone()
+	}
+	if c.RootCAs != nil {
+		cfg.RootCAs = c.RootCAs
+	}
+	if len(c.Certificates) > 0 {
+		cfg.Certificates = append(cfg.Certificates, c.Certificates...)
+	}
+	if c.InsecureSkipVerify {
+		cfg.InsecureSkipVerify = true
+	}
+	return cfg
+}
+
+// NovoPoolCA devolve as autoridades certificadoras do sistema acrescidas dos
+// certificados em formato PEM informados, para uso em Client.RootCAs
+func NovoPoolCA(pems ...[]byte) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for i, pem := range pems {
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("sigep: nenhum certificado válido no PEM %d", i+1)
+		}
+	}
+	return pool, nil
+}
+
+// erroContexto converte estouros de prazo, do contexto ou do cliente HTTP, em ErrTimeout.
+// Cancelamentos são devolvidos como recebidos, satisfazendo errors.Is(err, context.Canceled).
+func erroContexto(ctx context.Context, operacao string, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &erroTimeout{operacao: operacao, err: ctx.Err()}
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return &erroTimeout{operacao: operacao, err: err}
+	}
+	return err
+}
+
+// cancelarObjeto requisição do método cancelarObjeto
+type cancelarObjeto struct {
+	XMLName        xml.Name `xml:"cli:cancelarObjeto"`
+	IDPlp          string   `xml:"idPlp"`
+	NumeroEtiqueta string   `xml:"numeroEtiqueta"`
+	Usuario        string   `xml:"usuario"`
+	Senha          string   `xml:"senha"`
+}
+
+// estrutura para conter o retorno do método cancelarObjeto
+type cancelarObjetoResponse struct {
+	XMLName xml.Name `xml:"cancelarObjetoResponse"`
+	Retorno bool     `xml:"return"`
+}
+
+// CancelarObjeto faz a chamada ao SIGEPWEB para cancelar uma etiqueta obtida anteriormente
+func (c *Client) CancelarObjeto(etiqueta string, plp string) error {
+	return c.CancelarObjetoContext(context.Background(), etiqueta, plp)
+}
+
+// CancelarObjetoContext é a variante de CancelarObjeto que respeita o prazo e o cancelamento de ctx
+func (c *Client) CancelarObjetoContext(ctx context.Context, etiqueta string, plp string) error {
+	req := cancelarObjeto{
+		IDPlp:          plp,
+		NumeroEtiqueta: etiqueta,
+		Usuario:        c.Usuario,
+		Senha:          c.Senha,
+	}
+	sucesso := cancelarObjetoResponse{}
+	if err := c.chama(ctx, "cancelarObjeto", req, &sucesso); err != nil {
+		return err
+	}
+	if !sucesso.Retorno {
+		return errors.New("erro desconhecido ao cancelar etiqueta")
+	}
+	return nil
+}
+
+// solicitaEtiquetas requisição do método solicitaEtiquetas
+type solicitaEtiquetas struct {
+	XMLName          xml.Name `xml:"cli:solicitaEtiquetas"`
+	TipoDestinatario string   `xml:"tipoDestinatario"`
+	Identificador    string   `xml:"identificador"`
+	IDServico        string   `xml:"idServico"`
+	QtdEtiquetas     int      `xml:"qtdEtiquetas"`
+	Usuario          string   `xml:"usuario"`
+	Senha            string   `xml:"senha"`
+}
+
+// estrutura para conter o retorno do método solicitaEtiquetas
+type solicitaEtiquetasResponse struct {
+	XMLName        xml.Name `xml:"solicitaEtiquetasResponse"`
+	FaixaEtiquetas string   `xml:"return"`
+}
+
+// SolicitaEtiquetas faz a chamada ao SIGEPWEB e obtém uma faixa de etiquetas
+func (c *Client) SolicitaEtiquetas(codigo string, identificador string, qtdEtiquetas int) (string, error) {
+	return c.SolicitaEtiquetasContext(context.Background(), codigo, identificador, qtdEtiquetas)
+}
+
+// SolicitaEtiquetasContext é a variante de SolicitaEtiquetas que respeita o prazo e o cancelamento de ctx
+func (c *Client) SolicitaEtiquetasContext(ctx context.Context, codigo string, identificador string, qtdEtiquetas int) (string, error) {
+	req := solicitaEtiquetas{
+		TipoDestinatario: "C",
+		Identificador:    identificador,
+		IDServico:        codigo,
+		QtdEtiquetas:     qtdEtiquetas,
+		Usuario:          c.Usuario,
+		Senha:            c.Senha,
+	}
+	faixa := solicitaEtiquetasResponse{}
+	if err := c.chama(ctx, "solicitaEtiquetas", req, &faixa); err != nil {
+		return "", err
+	}
+	return faixa.FaixaEtiquetas, nil
+}
+
+// geraDigitoVerificadorEtiquetas requisição do método geraDigitoVerificadorEtiquetas
+type geraDigitoVerificadorEtiquetas struct {
+	XMLName   xml.Name `xml:"cli:geraDigitoVerificadorEtiquetas"`
+	Etiquetas string   `xml:"etiquetas"`
+	Usuario   string   `xml:"usuario"`
+	Senha     string   `xml:"senha"`
+}
+
+// estrutura para conter o retorno do método geraDigitoVerificadorEtiquetas
+type geraDigitoVerificadorEtiquetasResponse struct {
+	XMLName           xml.Name `xml:"geraDigitoVerificadorEtiquetasResponse"`
+	DigitoVerificador int      `xml:"return"`
+}
+
+// GeraDigitoVerificadorEtiquetas faz a chamada ao SIGPEWEB e gera o dígito verificador de uma etiqueta
+func (c *Client) GeraDigitoVerificadorEtiquetas(etiqueta string) (int, error) {
+	return c.GeraDigitoVerificadorEtiquetasContext(context.Background(), etiqueta)
+}
+
+// GeraDigitoVerificadorEtiquetasContext é a variante de GeraDigitoVerificadorEtiquetas que respeita o prazo e o cancelamento de ctx
+func (c *Client) GeraDigitoVerificadorEtiquetasContext(ctx context.Context, etiqueta string) (int, error) {
+	req := geraDigitoVerificadorEtiquetas{
+		Etiquetas: etiqueta,
+		Usuario:   c.Usuario,
+		Senha:     c.Senha,
+	}
+	digito := geraDigitoVerificadorEtiquetasResponse{}
+	if err := c.chama(ctx, "geraDigitoVerificadorEtiquetas", req, &digito); err != nil {
+		return 99, err
+	}
+	return digito.DigitoVerificador, nil
+}
+
+// Servico serviço contratado por um cliente, conforme retornado pelo buscaServicos
+type Servico struct {
+	Codigo    string `xml:"codigo"`
+	ID        int    `xml:"id"`
+	Descricao string `xml:"descricao"`
+}
+
+// buscaServicos requisição do método buscaServicos
+type buscaServicos struct {
+	XMLName          xml.Name `xml:"cli:buscaServicos"`
+	IDContrato       string   `xml:"idContrato"`
+	IDCartaoPostagem string   `xml:"idCartaoPostagem"`
+	Usuario          string   `xml:"usuario"`
+	Senha            string   `xml:"senha"`
+}
+
+// estrutura para conter o retorno do método buscaServicos
+type buscaServicosRetorno struct {
+	XMLName xml.Name  `xml:"buscaServicosResponse"`
+	Return  []Servico `xml:"return"`
+}
+
+// BuscaServicos faz a chamada ao SIGEPWEB e obtém os serviços do contrato de um cliente
+func (c *Client) BuscaServicos(contrato string, cartao string) ([]Servico, error) {
+	return c.BuscaServicosContext(context.Background(), contrato, cartao)
+}
+
+// BuscaServicosContext é a variante de BuscaServicos que respeita o prazo e o cancelamento de ctx
+func (c *Client) BuscaServicosContext(ctx context.Context, contrato string, cartao string) ([]Servico, error) {
+	req := buscaServicos{
+		IDContrato:       contrato,
+		IDCartaoPostagem: cartao,
+		Usuario:          c.Usuario,
+		Senha:            c.Senha,
+	}
+	servicos := buscaServicosRetorno{}
+	if err := c.chama(ctx, "buscaServicos", req, &servicos); err != nil {
+		return nil, err
+	}
+	return servicos.Return, nil
+}
+
+// Endereco endereço correspondente a um CEP, conforme retornado pelo consultaCEP
+type Endereco struct {
+	Bairro      string `xml:"bairro"`
+	Cep         string `xml:"cep"`
+	Cidade      string `xml:"cidade"`
+	Complemento string `xml:"complemento2"`
+	Endereco    string `xml:"end"`
+	UF          string `xml:"uf"`
+}
+
+// consultaCEP requisição do método consultaCEP
+type consultaCEP struct {
+	XMLName xml.Name `xml:"cli:consultaCEP"`
+	Cep     string   `xml:"cep"`
+}
+
+// estrutura para conter o retorno do método consultaCEP
+type consultaCEPRetorno struct {
+	XMLName xml.Name `xml:"consultaCEPResponse"`
+	Return  Endereco `xml:"return"`
+}
+
+// ConsultaCEP faz a chamada ao SIGEPWEB e obtem o endereco correspondente a um CEP
+func (c *Client) ConsultaCEP(cep string) (Endereco, error) {
+	return c.ConsultaCEPContext(context.Background(), cep)
+}
+
+// ConsultaCEPContext é a variante de ConsultaCEP que respeita o prazo e o cancelamento de ctx
+func (c *Client) ConsultaCEPContext(ctx context.Context, cep string) (Endereco, error) {
+	endereco := consultaCEPRetorno{}
+	if err := c.chama(ctx, "consultaCEP", consultaCEP{Cep: cep}, &endereco); err != nil {
+		return Endereco{}, err
+	}
+	return endereco.Return, nil
+}
+
+// solicitaPLP requisição do método solicitaPLP
+type solicitaPLP struct {
+	XMLName     xml.Name `xml:"cli:solicitaPLP"`
+	IDPlpMaster string   `xml:"idPlpMaster"`
+	NumEtiqueta string   `xml:"numEtiqueta"`
+	Usuario     string   `xml:"usuario"`
+	Senha       string   `xml:"senha"`
+}
+
+// estrutura para conter o retorno do método solicitaPLP
+type solicitaPLPResponse struct {
+	XMLName xml.Name `xml:"solicitaPLPResponse"`
+	XML     string   `xml:"return"`
+}
+
+// SolicitaPLP faz a chamada ao SIGEPWEB e obtem o xml de uma PLP
+func (c *Client) SolicitaPLP(plp string, etiqueta string) (string, error) {
+	return c.SolicitaPLPContext(context.Background(), plp, etiqueta)
+}
+
+// SolicitaPLPContext é a variante de SolicitaPLP que respeita o prazo e o cancelamento de ctx
+func (c *Client) SolicitaPLPContext(ctx context.Context, plp string, etiqueta string) (string, error) {
+	req := solicitaPLP{
+		IDPlpMaster: plp,
+		NumEtiqueta: etiqueta,
+		Usuario:     c.Usuario,
+		Senha:       c.Senha,
+	}
+	ret := solicitaPLPResponse{}
+	if err := c.chama(ctx, "solicitaPLP", req, &ret); err != nil {
+		return "", err
+	}
+	return ret.XML, nil
+}
+
+// fechaPlpVariosServicos requisição do método fechaPlpVariosServicos
+type fechaPlpVariosServicos struct {
+	XMLName xml.Name `xml:"cli:fechaPlpVariosServicos"`
+	XML     struct {
+		CData string `xml:",cdata"`
+	} `xml:"xml"`
+	IDPlpCliente   string `xml:"idPlpCliente"`
+	CartaoPostagem string `xml:"cartaoPostagem"`
+	ListaEtiquetas string `xml:"listaEtiquetas"`
+	Usuario        string `xml:"usuario"`
+	Senha          string `xml:"senha"`
+}
+
+// estrutura para conter o numero de uma PLP
+type fechaPlpVariosServicosResponse struct {
+	XMLName   xml.Name `xml:"fechaPlpVariosServicosResponse"`
+	NumeroPLP string   `xml:"return"`
+}
+
+// FechaPlpVariosServicos faz a chamada ao SIGPEWEB, fecha uma PLP
+func (c *Client) FechaPlpVariosServicos(xmlPLP string, etiqueta string, etiquetaSemVerificador string, idPlpCliente string, cartao string) (string, error) {
+	return c.FechaPlpVariosServicosContext(context.Background(), xmlPLP, etiqueta, etiquetaSemVerificador, idPlpCliente, cartao)
+}
+
+// FechaPlpVariosServicosContext é a variante de FechaPlpVariosServicos que respeita o prazo e o cancelamento de ctx
+func (c *Client) FechaPlpVariosServicosContext(ctx context.Context, xmlPLP string, etiqueta string, etiquetaSemVerificador string, idPlpCliente string, cartao string) (string, error) {
+	req := fechaPlpVariosServicos{
+		IDPlpCliente:   idPlpCliente,
+		CartaoPostagem: cartao,
+		ListaEtiquetas: etiquetaSemVerificador,
+		Usuario:        c.Usuario,
+		Senha:          c.Senha,
+	}
+	req.XML.CData = strings.Replace(xmlPLP, "XX000000000XX", etiqueta, 1)
+	plp := fechaPlpVariosServicosResponse{}
+	if err := c.chama(ctx, "fechaPlpVariosServicos", req, &plp); err != nil {
+		return "", err
+	}
+	return plp.NumeroPLP, nil
+}
@@ -0,0 +1,209 @@
+package plp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RogerioML/plp/sigeptest"
+)
+
+// xmlPlpCiclo PLP mínima com id_plp a ser preenchido pelo SIGEPWEB
+const xmlPlpCiclo = `<?xml version="1.0" encoding="UTF-8"?><correioslog><tipo_arquivo>Postagem</tipo_arquivo><versao_arquivo>2.3</versao_arquivo>` +
+	`<plp><id_plp/><valor_global/><mcu_unidade_postagem/><nome_unidade_postagem/><cartao_postagem>0067599079</cartao_postagem></plp>` +
+	`%s</correioslog>`
+
+func objetoCiclo(etiqueta string) string {
+	return fmt.Sprintf(`<objeto_postal><numero_etiqueta>%s</numero_etiqueta><codigo_servico_postagem>03220</codigo_servico_postagem><peso>300</peso></objeto_postal>`, etiqueta)
+}
+
+func TestClientCicloDeVida(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	c := NewClient(srv.URL, srv.Usuario, srv.Senha)
+
+	retorno, err := c.SolicitaEtiquetas("03220", "34028316000103", 2)
+	if err != nil {
+		t.Fatalf("SolicitaEtiquetas: %v", err)
+	}
+	faixa, err := ParseFaixaEtiquetas(retorno)
+	if err != nil {
+		t.Fatalf("ParseFaixaEtiquetas(%q): %v", retorno, err)
+	}
+	if faixa.Len() != 2 {
+		t.Fatalf("faixa com %d etiquetas, esperado 2", faixa.Len())
+	}
+	for _, e := range []Etiqueta{faixa.Inicio, faixa.Fim} {
+		dv, err := c.GeraDigitoVerificadorEtiquetas(e.SemDV())
+		if err != nil {
+			t.Fatalf("GeraDigitoVerificadorEtiquetas: %v", err)
+		}
+		if dv != e.DV {
+			t.Errorf("dígito verificador de %s = %d, esperado %d", e.SemDV(), dv, e.DV)
+		}
+	}
+
+	etiquetas := faixa.Etiquetas()
+	xmlPLP := fmt.Sprintf(xmlPlpCiclo, objetoCiclo(etiquetas[0])+objetoCiclo(etiquetas[1]))
+	lista := faixa.Inicio.SemDV() + "," + faixa.Fim.SemDV()
+	numero, err := c.FechaPlpVariosServicos(xmlPLP, etiquetas[0], lista, "123", "0067599079")
+	if err != nil {
+		t.Fatalf("FechaPlpVariosServicos: %v", err)
+	}
+	for _, e := range []Etiqueta{faixa.Inicio, faixa.Fim} {
+		if estado, _ := srv.Etiqueta(e.SemDV()); estado != sigeptest.EtiquetaUsada {
+			t.Errorf("etiqueta %s no estado %v, esperado usada", e, estado)
+		}
+	}
+
+	xmlFechado, err := c.SolicitaPLP(numero, etiquetas[0])
+	if err != nil {
+		t.Fatalf("SolicitaPLP: %v", err)
+	}
+	p, err := NewPlp([]byte(xmlFechado))
+	if err != nil {
+		t.Fatalf("NewPlp: %v", err)
+	}
+	if strconv.Itoa(p.Plp.IDPlp) != numero {
+		t.Errorf("id_plp = %d, esperado %s", p.Plp.IDPlp, numero)
+	}
+	if len(p.Objetos) != 2 || p.Objetos[1].NumeroEtiqueta != etiquetas[1] {
+		t.Errorf("objetos da PLP solicitada = %+v", p.Objetos)
+	}
+
+	if err := c.CancelarObjeto(etiquetas[1], numero); err != nil {
+		t.Fatalf("CancelarObjeto: %v", err)
+	}
+	if estado, _ := srv.Etiqueta(faixa.Fim.SemDV()); estado != sigeptest.EtiquetaCancelada {
+		t.Errorf("etiqueta cancelada no estado %v", estado)
+	}
+	if estado, _ := srv.Etiqueta(faixa.Inicio.SemDV()); estado != sigeptest.EtiquetaUsada {
+		t.Errorf("etiqueta não cancelada no estado %v", estado)
+	}
+
+	var fe *FaultError
+	if err := c.CancelarObjeto(etiquetas[1], numero); !errors.As(err, &fe) {
+		t.Errorf("segundo CancelarObjeto = %v, esperado *FaultError", err)
+	}
+	if _, err := c.FechaPlpVariosServicos(xmlPLP, etiquetas[0], lista, "124", "0067599079"); !errors.Is(err, ErrEtiquetaUtilizada) {
+		t.Errorf("FechaPlpVariosServicos com etiquetas usadas = %v, esperado ErrEtiquetaUtilizada", err)
+	}
+	if srv.Plps() != 1 {
+		t.Errorf("%d PLPs fechadas, esperado 1", srv.Plps())
+	}
+}
+
+func TestClientFalhas(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	c := NewClient(srv.URL, srv.Usuario, srv.Senha)
+
+	_, err := c.SolicitaPLP("999", "SZ000000015BR")
+	var fe *FaultError
+	if !errors.As(err, &fe) || fe.Operation != "solicitaPLP" || fe.FaultString == "" {
+		t.Fatalf("SolicitaPLP inexistente = %v, esperado *FaultError", err)
+	}
+	if !errors.Is(err, ErrPlpNaoEncontrada) {
+		t.Errorf("SolicitaPLP inexistente = %v, esperado ErrPlpNaoEncontrada", err)
+	}
+	if err := c.CancelarObjeto("SZ000000015BR", "999"); !errors.Is(err, ErrPlpNaoEncontrada) {
+		t.Errorf("CancelarObjeto em PLP inexistente = %v, esperado ErrPlpNaoEncontrada", err)
+	}
+
+	c.Senha = "errada"
+	if _, err := c.SolicitaEtiquetas("03220", "34028316000103", 1); !errors.Is(err, ErrCredenciaisInvalidas) {
+		t.Errorf("SolicitaEtiquetas com senha errada = %v, esperado ErrCredenciaisInvalidas", err)
+	}
+	c.Senha = srv.Senha
+
+	srv.DefineFalha("solicitaPLP", sigeptest.Falha{Codigo: "soap:Server", Mensagem: "Erro interno", Status: http.StatusInternalServerError})
+	_, err = c.SolicitaPLP("100000000", "SZ000000015BR")
+	if !errors.As(err, &fe) || fe.StatusCode != http.StatusInternalServerError || fe.Unwrap() != nil {
+		t.Errorf("SolicitaPLP com falha desconhecida = %v, esperado *FaultError sem classificação", err)
+	}
+
+	srv.DefineFalha("cancelarObjeto", sigeptest.Falha{Status: http.StatusServiceUnavailable})
+	var se *StatusError
+	if err := c.CancelarObjeto("SZ000000015BR", "100000000"); !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("CancelarObjeto com serviço fora = %v, esperado *StatusError 503", err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	srv.DefineLatencia("solicitaPLP", 200*time.Millisecond)
+	srv.DefineLatencia("fechaPlpVariosServicos", 200*time.Millisecond)
+
+	c := NewClient(srv.URL, srv.Usuario, srv.Senha)
+	c.Timeout = 20 * time.Millisecond
+	if _, err := c.SolicitaPLP("100000000", "SZ000000015BR"); !errors.Is(err, ErrTimeout) {
+		t.Errorf("SolicitaPLP com Timeout = %v, esperado ErrTimeout", err)
+	}
+
+	// o http.Client já foi criado com o Timeout anterior: o prazo vem só do contexto
+	c = NewClient(srv.URL, srv.Usuario, srv.Senha)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.FechaPlpVariosServicosContext(ctx, strings.Replace(xmlPlpCiclo, "%s", "", 1), "SZ000000015BR", "SZ00000001BR", "1", "0067599079")
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("FechaPlpVariosServicosContext com prazo = %v, esperado ErrTimeout do contexto", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.SolicitaPLPContext(ctx, "100000000", "SZ000000015BR"); !errors.Is(err, context.Canceled) {
+		t.Errorf("SolicitaPLPContext cancelado = %v, esperado context.Canceled", err)
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	srv := sigeptest.NewTLSServer()
+	defer srv.Close()
+	// os handshakes recusados são esperados
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+
+	c := NewClient(srv.URL, srv.Usuario, srv.Senha)
+	if v := c.tlsConfig().MinVersion; v != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %x, esperado TLS 1.2", v)
+	}
+	var ua x509.UnknownAuthorityError
+	if _, err := c.BuscaServicos("9912208555", "0067599079"); !errors.As(err, &ua) {
+		t.Fatalf("BuscaServicos sem RootCAs = %v, esperado erro de certificado", err)
+	}
+
+	// as funções do pacote usam o mesmo transporte padrão
+	if cfg := httpLegado.Transport.(*http.Transport).TLSClientConfig; cfg.InsecureSkipVerify || cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("TLS das funções do pacote = %+v", cfg)
+	}
+	defer func(wsdl string) { Wsdl = wsdl }(Wsdl)
+	Wsdl = srv.URL
+	if _, err := SolicitaEtiquetas("03220", "34028316000103", 1, srv.Usuario, srv.Senha); !errors.As(err, &ua) {
+		t.Errorf("SolicitaEtiquetas do pacote = %v, esperado erro de certificado", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	c = NewClient(srv.URL, srv.Usuario, srv.Senha)
+	c.RootCAs = pool
+	if _, err := c.BuscaServicos("9912208555", "0067599079"); err != nil {
+		t.Errorf("BuscaServicos com RootCAs: %v", err)
+	}
+	c = NewClient(srv.URL, srv.Usuario, srv.Senha)
+	c.InsecureSkipVerify = true
+	if _, err := c.BuscaServicos("9912208555", "0067599079"); err != nil {
+		t.Errorf("BuscaServicos com InsecureSkipVerify: %v", err)
+	}
+	if srv.Chamadas("buscaServicos") != 2 || srv.Chamadas("solicitaEtiquetas") != 0 {
+		t.Error("chamadas com certificado recusado chegaram ao servidor")
+	}
+}
@@ -1,17 +1,17 @@
 package plp
 
 import (
+	"context"
 	"database/sql"
-	"sync"
-	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
 
 var (
-	db   *sql.DB
-	muRd sync.Mutex
-	rd   redis.Conn
+	db      *sql.DB
+	dialeto Dialeto
+	// Pool conexões do RedisStore criado por IniRedis, mantido para os
+	// programas que o usam diretamente
 	Pool *redis.Pool
 )
 
@@ -20,37 +20,46 @@ func IniDb(
 	dsn string,
 	maxConn int,
 ) error {
-	var err error
-	db, err = sql.Open("godror", dsn)
+	return IniDbDialeto(Oracle, dsn, maxConn)
+}
+
+// IniDbDialeto incia as variáveis do DB em um banco do dialeto d, cujo driver
+// deve ser importado pelo programa
+func IniDbDialeto(d Dialeto, dsn string, maxConn int) error {
+	conn, err := sql.Open(d.Driver(), dsn)
 	if err != nil {
 		return err
 	}
-	if err := db.Ping(); err != nil {
+	if err := conn.Ping(); err != nil {
+		conn.Close()
 		return err
 	}
-	db.SetMaxOpenConns(maxConn)
+	conn.SetMaxOpenConns(maxConn)
+	db, dialeto = conn, d
+	DefineRepositorio(NewSQLRepository(db, d))
 	return nil
 }
 
 // IniRedis inicia as variáveis do REDIS
 func IniRedis(address string) error {
-	var err error
-	rd, err = redis.Dial("tcp", address)
+	return IniRedisConfig(ConfigRedis{Endereco: address})
+}
+
+// IniRedisConfig cria o RedisStore da configuração e o define como padrão
+func IniRedisConfig(cfg ConfigRedis) error {
+	s, err := NewRedisStore(cfg)
 	if err != nil {
 		return err
 	}
-	Pool = &redis.Pool{
-		MaxIdle:         64,
-		IdleTimeout:     240 * time.Second,
-		MaxConnLifetime: 300 * time.Second,
-		Wait:            true,
-		Dial: func() (conn redis.Conn, e error) {
-			return redis.Dial("tcp", address)
-		},
-	}
-	return rd.Err()
+	DefineRedis(s)
+	Pool = s.Pool
+	return nil
 }
 
-func toDate(t time.Time) string {
-	return t.Format("02012006150405")
+// SavePlp grava a PLP e seus objetos no banco aberto por IniDb, veja SQLRepository.SavePlp
+func SavePlp(ctx context.Context, tx *sql.Tx, p *Plp) error {
+	if db == nil {
+		return ErrBancoNaoIniciado
+	}
+	return NewSQLRepository(db, dialeto).SavePlp(ctx, tx, p)
 }
@@ -0,0 +1,75 @@
+package plp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// bomUTF8 marca de ordem de bytes gravada por alguns editores no início de arquivos UTF-8
+var bomUTF8 = []byte{0xEF, 0xBB, 0xBF}
+
+// ReadPlp lê uma PLP no layout correioslog de r, convertendo o documento para
+// UTF-8 conforme a codificação declarada no prólogo: UTF-8, com ou sem BOM,
+// ISO-8859-1 ou Windows-1252. Espaços no início e no fim dos campos de texto
+// são removidos e as etiquetas recebem o dígito verificador.
+func ReadPlp(r io.Reader) (Plp, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Plp{}, fmt.Errorf("plp readplp 1: %w", err)
+	}
+	return lePlp(b, false)
+}
+
+// lePlp decodifica o documento b. Com utf8Declarado, documentos em UTF-8 válido
+// são lidos sem conversão mesmo que declarem ISO-8859-1 ou Windows-1252, caso do
+// texto devolvido por SolicitaPLP.
+func lePlp(b []byte, utf8Declarado bool) (Plp, error) {
+	b = bytes.TrimPrefix(b, bomUTF8)
+	d := xml.NewDecoder(bytes.NewReader(b))
+	d.CharsetReader = leitorCharset(utf8Declarado && utf8.Valid(b))
+	plp := Plp{}
+	if err := d.Decode(&plp); err != nil {
+		return Plp{}, fmt.Errorf("plp readplp 2: %w", err)
+	}
+	aparaTextos(reflect.ValueOf(&plp))
+	for _, o := range plp.Objetos {
+		etiqueta, err := EtiquetaDV(o.NumeroEtiqueta)
+		if err != nil {
+			return Plp{}, fmt.Errorf("plp readplp 3: %w", err)
+		}
+		o.NumeroEtiqueta = etiqueta
+	}
+	return plp, nil
+}
+
+// leitorCharset converte para UTF-8 o documento na codificação declarada no
+// prólogo. Com utf8Valido o documento é lido sem conversão, desde que a
+// codificação declarada seja uma das suportadas.
+func leitorCharset(utf8Valido bool) func(charset string, input io.Reader) (io.Reader, error) {
+	return func(charset string, input io.Reader) (io.Reader, error) {
+		var dec *encoding.Decoder
+		switch strings.ToLower(strings.TrimSpace(charset)) {
+		case "utf-8", "utf8":
+			return input, nil
+		case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "l1", "iso-ir-100", "cp819", "ibm819":
+			dec = charmap.ISO8859_1.NewDecoder()
+		case "windows-1252", "cp1252", "x-cp1252":
+			dec = charmap.Windows1252.NewDecoder()
+		default:
+			return nil, fmt.Errorf("codificação %s não suportada", charset)
+		}
+		if utf8Valido {
+			return input, nil
+		}
+		return dec.Reader(input), nil
+	}
+}
@@ -0,0 +1,149 @@
+package plp
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lePlpTeste lê a PLP de testdata. plp_utf8_declarado_iso.xml, como o texto
+// devolvido por SolicitaPLP, é lido por NewPlp
+func lePlpTeste(t *testing.T, nome string) Plp {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", nome))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lePlp := NewPlp
+	if nome != "plp_utf8_declarado_iso.xml" {
+		lePlp = func(b []byte) (Plp, error) { return ReadPlp(bytes.NewReader(b)) }
+	}
+	p, err := lePlp(b)
+	if err != nil {
+		t.Fatalf("ReadPlp(%s): %v", nome, err)
+	}
+	return p
+}
+
+func TestReadPlpCodificacoes(t *testing.T) {
+	casos := []struct {
+		arquivo   string
+		descricao string
+	}{
+		{"plp_iso88591.xml", `Coleção "Memórias" <1ª edição> & anexos`},
+		{"plp_utf8_declarado_iso.xml", `Coleção "Memórias" <1ª edição> & anexos`},
+		{"plp_utf8_bom.xml", `Coleção "Memórias" <1ª edição> & anexos`},
+		{"plp_windows1252.xml", `Coleção “Memórias” – R$ 10 ou €2 <1ª edição> & anexos`},
+	}
+	for _, caso := range casos {
+		t.Run(caso.arquivo, func(t *testing.T) {
+			p := lePlpTeste(t, caso.arquivo)
+			if got := p.Remetente.NomeRemetente.CData; got != "Comércio São João Ltda" {
+				t.Errorf("nome_remetente = %q", got)
+			}
+			if len(p.Objetos) != 2 {
+				t.Fatalf("%d objetos, esperado 2", len(p.Objetos))
+			}
+			o := p.Objetos[0]
+			if got := o.Destinatario.NomeDestinatario.CData; got != "José da Conceição" {
+				t.Errorf("nome_destinatario = %q", got)
+			}
+			if got := o.Nacional.CidadeDestinatario.CData; got != "Brasília" {
+				t.Errorf("cidade_destinatario = %q", got)
+			}
+			if got := o.Nacional.DescricaoObjeto.CData; got != caso.descricao {
+				t.Errorf("descricao_objeto = %q, esperado %q", got, caso.descricao)
+			}
+			if got := p.Objetos[1].Destinatario.NomeDestinatario.CData; got != "Márcia Gonçalves" {
+				t.Errorf("nome_destinatario aparado = %q", got)
+			}
+		})
+	}
+}
+
+func TestNewPlpUTF8DeclaradoISO(t *testing.T) {
+	// como o texto devolvido por SolicitaPLP: declarado em ISO-8859-1, mas em UTF-8
+	s := `<?xml version="1.0" encoding="ISO-8859-1" ?><correioslog><remetente>` +
+		`<nome_remetente><![CDATA[José]]></nome_remetente></remetente></correioslog>`
+	p, err := NewPlp([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Remetente.NomeRemetente.CData; got != "José" {
+		t.Errorf("nome_remetente = %q, esperado José", got)
+	}
+
+	iso, err := ioutil.ReadFile(filepath.Join("testdata", "plp_iso88591.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = NewPlp(iso)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Remetente.CidadeRemetente.CData; got != "São Paulo" {
+		t.Errorf("cidade_remetente em ISO-8859-1 = %q, esperado São Paulo", got)
+	}
+}
+
+func TestReadPlpObedeceCodificacaoDeclarada(t *testing.T) {
+	// "Ã©" em ISO-8859-1 e em Windows-1252 são os bytes de "é" em UTF-8
+	for _, charset := range []string{"ISO-8859-1", "windows-1252"} {
+		s := `<?xml version="1.0" encoding="` + charset + `"?><correioslog><remetente>` +
+			"<nome_remetente><![CDATA[Jos\xc3\xa9]]></nome_remetente></remetente></correioslog>"
+		p, err := ReadPlp(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Remetente.NomeRemetente.CData; got != "JosÃ©" {
+			t.Errorf("nome_remetente em %s = %q, esperado JosÃ©", charset, got)
+		}
+	}
+
+	f, err := os.Open(filepath.Join("testdata", "plp_utf8_declarado_iso.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := ReadPlp(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Remetente.NomeRemetente.CData; got != "ComÃ©rcio SÃ£o JoÃ£o Ltda" {
+		t.Errorf("nome_remetente = %q, esperado a leitura em ISO-8859-1", got)
+	}
+}
+
+func TestReadPlpMensagensDeErro(t *testing.T) {
+	casos := map[string]string{
+		"<correioslog><plp>": "plp readplp 2: ",
+		"<correioslog><objeto_postal><numero_etiqueta>SZ1BR":                                                 "plp readplp 2: ",
+		"<correioslog><objeto_postal><numero_etiqueta>SZ1BR</numero_etiqueta></objeto_postal></correioslog>": "plp readplp 3: ",
+	}
+	for doc, prefixo := range casos {
+		if _, err := ReadPlp(strings.NewReader(doc)); err == nil || !strings.HasPrefix(err.Error(), prefixo) {
+			t.Errorf("ReadPlp(%q) = %v, esperado %s...", doc, err, prefixo)
+		}
+	}
+	if _, err := ReadPlp(leitorFalho{}); err == nil || !strings.HasPrefix(err.Error(), "plp readplp 1: ") {
+		t.Errorf("ReadPlp com falha de leitura = %v", err)
+	}
+}
+
+// leitorFalho io.Reader que sempre falha
+type leitorFalho struct{}
+
+func (leitorFalho) Read(p []byte) (int, error) {
+	return 0, errors.New("leitura interrompida")
+}
+
+func TestReadPlpCodificacaoNaoSuportada(t *testing.T) {
+	_, err := NewPlp([]byte(`<?xml version="1.0" encoding="EBCDIC"?><correioslog/>`))
+	if err == nil || !strings.Contains(err.Error(), "EBCDIC") {
+		t.Errorf("erro = %v, esperado codificação não suportada", err)
+	}
+}
@@ -0,0 +1,322 @@
+package plp
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Dialeto diferenças de SQL entre os bancos suportados pelo SQLRepository. As
+// datas trafegam como texto no formato LayoutData, convertidas pelo próprio banco.
+type Dialeto interface {
+	// Nome nome do banco, usado nas mensagens de erro
+	Nome() string
+	// Driver nome do driver de database/sql, que deve ser importado pelo programa
+	Driver() string
+	// Parametro marcador do parâmetro de posição n, a partir de 1
+	Parametro(n int) string
+	// Data expressão que converte o parâmetro texto em data
+	Data(parametro string) string
+	// Texto expressão que converte a coluna de data em texto
+	Texto(coluna string) string
+	// LayoutData formato das datas em texto, no layout do pacote time
+	LayoutData() string
+	// Migracoes comandos de criação e alteração do esquema, em ordem
+	Migracoes() []string
+	// ConsultaTabela consulta que conta as tabelas de nome ?, usada por Migra
+	ConsultaTabela() string
+	// DDLTransacional indica se os comandos de esquema podem ser desfeitos em
+	// transação, caso em que Migra aplica cada migração e o seu registro juntos
+	DDLTransacional() bool
+}
+
+// Dialetos suportados
+var (
+	Oracle   Dialeto = dialetoOracle{}
+	Postgres Dialeto = dialetoPostgres{}
+	SQLite   Dialeto = dialetoSQLite{}
+	MySQL    Dialeto = dialetoMySQL{}
+)
+
+type dialetoOracle struct{}
+
+func (dialetoOracle) Nome() string           { return "oracle" }
+func (dialetoOracle) Driver() string         { return "godror" }
+func (dialetoOracle) Parametro(n int) string { return fmt.Sprintf(":%d", n) }
+func (dialetoOracle) Data(p string) string   { return "to_date(" + p + ",'ddmmyyyyhh24miss')" }
+func (dialetoOracle) Texto(c string) string  { return "to_char(" + c + ",'ddmmyyyyhh24miss')" }
+func (dialetoOracle) LayoutData() string     { return "02012006150405" }
+func (dialetoOracle) Migracoes() []string    { return migracoesOracle }
+func (dialetoOracle) DDLTransacional() bool  { return false }
+func (dialetoOracle) ConsultaTabela() string {
+	return "SELECT COUNT(*) FROM user_tables WHERE table_name = UPPER(?)"
+}
+
+type dialetoPostgres struct{}
+
+func (dialetoPostgres) Nome() string           { return "postgres" }
+func (dialetoPostgres) Driver() string         { return "postgres" }
+func (dialetoPostgres) Parametro(n int) string { return fmt.Sprintf("$%d", n) }
+func (dialetoPostgres) Data(p string) string   { return "CAST(" + p + " AS TIMESTAMP)" }
+func (dialetoPostgres) Texto(c string) string  { return "to_char(" + c + ",'YYYY-MM-DD HH24:MI:SS')" }
+func (dialetoPostgres) LayoutData() string     { return LayoutMysql }
+func (dialetoPostgres) Migracoes() []string    { return migracoesPostgres }
+func (dialetoPostgres) DDLTransacional() bool  { return true }
+func (dialetoPostgres) ConsultaTabela() string {
+	return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = LOWER(?)"
+}
+
+type dialetoSQLite struct{}
+
+func (dialetoSQLite) Nome() string           { return "sqlite" }
+func (dialetoSQLite) Driver() string         { return "sqlite3" }
+func (dialetoSQLite) Parametro(n int) string { return "?" }
+func (dialetoSQLite) Data(p string) string   { return p }
+func (dialetoSQLite) Texto(c string) string  { return c }
+func (dialetoSQLite) LayoutData() string     { return LayoutMysql }
+func (dialetoSQLite) Migracoes() []string    { return migracoesSQLite }
+func (dialetoSQLite) DDLTransacional() bool  { return true }
+func (dialetoSQLite) ConsultaTabela() string {
+	return "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ? COLLATE NOCASE"
+}
+
+type dialetoMySQL struct{}
+
+func (dialetoMySQL) Nome() string           { return "mysql" }
+func (dialetoMySQL) Driver() string         { return "mysql" }
+func (dialetoMySQL) Parametro(n int) string { return "?" }
+func (dialetoMySQL) Data(p string) string   { return "STR_TO_DATE(" + p + ",'%Y-%m-%d %H:%i:%s')" }
+func (dialetoMySQL) Texto(c string) string  { return "DATE_FORMAT(" + c + ",'%Y-%m-%d %H:%i:%s')" }
+func (dialetoMySQL) LayoutData() string     { return LayoutMysql }
+func (dialetoMySQL) Migracoes() []string    { return migracoesMySQL }
+func (dialetoMySQL) DDLTransacional() bool  { return false }
+func (dialetoMySQL) ConsultaTabela() string {
+	return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND UPPER(table_name) = UPPER(?)"
+}
+
+// traduz reescreve a consulta para o dialeto: cada ? vira o marcador do parâmetro,
+// @data(?) converte o parâmetro em data e @texto(COLUNA) converte a coluna em texto.
+// Literais entre aspas simples são copiados sem alteração.
+func traduz(d Dialeto, consulta string) string {
+	var b strings.Builder
+	n := 0
+	literal := false
+	for i := 0; i < len(consulta); i++ {
+		switch {
+		case consulta[i] == '\'':
+			// '' dentro do literal fecha e reabre, mantendo o estado correto
+			literal = !literal
+			b.WriteByte(consulta[i])
+		case literal:
+			b.WriteByte(consulta[i])
+		case strings.HasPrefix(consulta[i:], "@data(?)"):
+			n++
+			b.WriteString(d.Data(d.Parametro(n)))
+			i += len("@data(?)") - 1
+		case strings.HasPrefix(consulta[i:], "@texto("):
+			fim := strings.IndexByte(consulta[i:], ')')
+			b.WriteString(d.Texto(consulta[i+len("@texto(") : i+fim]))
+			i += fim
+		case consulta[i] == '?':
+			n++
+			b.WriteString(d.Parametro(n))
+		default:
+			b.WriteByte(consulta[i])
+		}
+	}
+	return b.String()
+}
+
+// dataOuNulo data em texto no formato do dialeto, ou nulo para a data zero
+func dataOuNulo(d Dialeto, t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.In(time.Local).Format(d.LayoutData())
+}
+
+// leData lê a data em texto no formato do dialeto, devolvendo a data zero para nulo
+func leData(d Dialeto, s sql.NullString) (time.Time, error) {
+	if !s.Valid || s.String == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(d.LayoutData(), s.String, time.Local)
+}
+
+// Migra aplica em db as migrações do dialeto ainda não aplicadas, registrando cada
+// uma na tabela NEP_MIGRACAO. Nos dialetos com DDLTransacional a migração e o seu
+// registro são gravados na mesma transação.
+func Migra(ctx context.Context, db *sql.DB, d Dialeto) error {
+	var tabelas int
+	if err := db.QueryRowContext(ctx, traduz(d, d.ConsultaTabela()), "NEP_MIGRACAO").Scan(&tabelas); err != nil {
+		return fmt.Errorf("plp migra %s: %w", d.Nome(), err)
+	}
+	aplicadas := 0
+	if tabelas == 0 {
+		if _, err := db.ExecContext(ctx, "CREATE TABLE NEP_MIGRACAO (MIG_NU INTEGER NOT NULL PRIMARY KEY)"); err != nil {
+			return fmt.Errorf("plp migra %s: %w", d.Nome(), err)
+		}
+	} else if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM NEP_MIGRACAO").Scan(&aplicadas); err != nil {
+		return fmt.Errorf("plp migra %s: %w", d.Nome(), err)
+	}
+	for i, m := range d.Migracoes() {
+		if i < aplicadas {
+			continue
+		}
+		if err := aplicaMigracao(ctx, db, d, i+1, m); err != nil {
+			return fmt.Errorf("plp migra %s %d: %w", d.Nome(), i+1, err)
+		}
+	}
+	return nil
+}
+
+// aplicaMigracao executa a migração n e a registra em NEP_MIGRACAO
+func aplicaMigracao(ctx context.Context, db *sql.DB, d Dialeto, n int, m string) error {
+	var ex executor = db
+	if d.DDLTransacional() {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		ex = tx
+	}
+	if _, err := ex.ExecContext(ctx, m); err != nil {
+		return err
+	}
+	if _, err := ex.ExecContext(ctx, traduz(d, "INSERT INTO NEP_MIGRACAO (MIG_NU) VALUES (?)"), n); err != nil {
+		return err
+	}
+	if tx, ok := ex.(*sql.Tx); ok {
+		return tx.Commit()
+	}
+	return nil
+}
+
+// migracoesOracle também servem às bases que já possuem NEP_OBJETO_POSTAL, com
+// OBJ_NU_ETIQUETA, PLP_NU, OBJ_DT_INCLUSAO e OBJ_IN_STATUS: cada comando ignora
+// o erro de tabela, coluna ou índice já existente, e as colunas que faltam são
+// acrescentadas.
+var migracoesOracle = []string{
+	ignorandoOracle(`CREATE TABLE NEP_PLP (
+		PLP_NU NUMBER(10) NOT NULL PRIMARY KEY,
+		PLP_NU_SIGEP NUMBER(10),
+		PLP_NU_CLIENTE NUMBER(10),
+		PLP_IN_STATUS NUMBER(2) DEFAULT 0 NOT NULL,
+		PLP_DT_POSTAGEM DATE,
+		PLP_DT_POSTAGEM_SARA DATE,
+		PLP_DT_FECHAMENTO DATE,
+		PLP_DT_ATUALIZACAO_CLIENTE DATE,
+		PLP_TX_XML CLOB
+	)`, oracleNomeEmUso),
+	ignorandoOracle(`ALTER TABLE NEP_PLP ADD (PLP_NU_SIGEP NUMBER(10))`, oracleColunaExistente),
+	ignorandoOracle(`ALTER TABLE NEP_PLP ADD (PLP_NU_CLIENTE NUMBER(10))`, oracleColunaExistente),
+	ignorandoOracle(`ALTER TABLE NEP_PLP ADD (PLP_IN_STATUS NUMBER(2) DEFAULT 0 NOT NULL)`, oracleColunaExistente),
+	ignorandoOracle(`ALTER TABLE NEP_PLP ADD (PLP_DT_POSTAGEM DATE)`, oracleColunaExistente),
+	ignorandoOracle(`ALTER TABLE NEP_PLP ADD (PLP_DT_POSTAGEM_SARA DATE)`, oracleColunaExistente),
+	ignorandoOracle(`ALTER TABLE NEP_PLP ADD (PLP_DT_FECHAMENTO DATE)`, oracleColunaExistente),
+	ignorandoOracle(`ALTER TABLE NEP_PLP ADD (PLP_DT_ATUALIZACAO_CLIENTE DATE)`, oracleColunaExistente),
+	ignorandoOracle(`ALTER TABLE NEP_PLP ADD (PLP_TX_XML CLOB)`, oracleColunaExistente),
+	ignorandoOracle(`CREATE TABLE NEP_OBJETO_POSTAL (
+		OBJ_NU_ETIQUETA VARCHAR2(12) NOT NULL PRIMARY KEY,
+		PLP_NU NUMBER(10) NOT NULL,
+		OBJ_DT_INCLUSAO DATE NOT NULL,
+		OBJ_IN_STATUS NUMBER(2) DEFAULT 0 NOT NULL,
+		OBJ_TX_XML CLOB
+	)`, oracleNomeEmUso),
+	ignorandoOracle(`ALTER TABLE NEP_OBJETO_POSTAL ADD (OBJ_IN_STATUS NUMBER(2) DEFAULT 0 NOT NULL)`, oracleColunaExistente),
+	ignorandoOracle(`ALTER TABLE NEP_OBJETO_POSTAL ADD (OBJ_TX_XML CLOB)`, oracleColunaExistente),
+	ignorandoOracle(`CREATE INDEX NEP_OBJETO_POSTAL_PLP ON NEP_OBJETO_POSTAL (PLP_NU)`, oracleNomeEmUso, oracleIndiceExistente),
+}
+
+// Erros do Oracle ignorados pelas migrações de esquemas existentes
+const (
+	oracleNomeEmUso       = -955  // ORA-00955: nome já usado por um objeto existente
+	oracleColunaExistente = -1430 // ORA-01430: coluna já existe na tabela
+	oracleIndiceExistente = -1408 // ORA-01408: lista de colunas já indexada
+)
+
+// ignorandoOracle bloco PL/SQL que executa o comando ddl ignorando os erros
+// Oracle de códigos informados
+func ignorandoOracle(ddl string, codigos ...int) string {
+	condicoes := make([]string, len(codigos))
+	for i, c := range codigos {
+		condicoes[i] = fmt.Sprintf("SQLCODE != %d", c)
+	}
+	return "BEGIN\n" +
+		"\tEXECUTE IMMEDIATE '" + strings.Replace(ddl, "'", "''", -1) + "';\n" +
+		"EXCEPTION\n" +
+		"\tWHEN OTHERS THEN\n" +
+		"\t\tIF " + strings.Join(condicoes, " AND ") + " THEN\n" +
+		"\t\t\tRAISE;\n" +
+		"\t\tEND IF;\n" +
+		"END;"
+}
+
+var migracoesPostgres = []string{
+	`CREATE TABLE NEP_PLP (
+		PLP_NU INTEGER NOT NULL PRIMARY KEY,
+		PLP_NU_SIGEP INTEGER,
+		PLP_NU_CLIENTE INTEGER,
+		PLP_IN_STATUS SMALLINT DEFAULT 0 NOT NULL,
+		PLP_DT_POSTAGEM TIMESTAMP,
+		PLP_DT_POSTAGEM_SARA TIMESTAMP,
+		PLP_DT_FECHAMENTO TIMESTAMP,
+		PLP_DT_ATUALIZACAO_CLIENTE TIMESTAMP,
+		PLP_TX_XML TEXT
+	)`,
+	`CREATE TABLE NEP_OBJETO_POSTAL (
+		OBJ_NU_ETIQUETA VARCHAR(12) NOT NULL PRIMARY KEY,
+		PLP_NU INTEGER NOT NULL,
+		OBJ_DT_INCLUSAO TIMESTAMP NOT NULL,
+		OBJ_IN_STATUS SMALLINT DEFAULT 0 NOT NULL,
+		OBJ_TX_XML TEXT
+	)`,
+	`CREATE INDEX NEP_OBJETO_POSTAL_PLP ON NEP_OBJETO_POSTAL (PLP_NU)`,
+}
+
+var migracoesSQLite = []string{
+	`CREATE TABLE NEP_PLP (
+		PLP_NU INTEGER NOT NULL PRIMARY KEY,
+		PLP_NU_SIGEP INTEGER,
+		PLP_NU_CLIENTE INTEGER,
+		PLP_IN_STATUS INTEGER DEFAULT 0 NOT NULL,
+		PLP_DT_POSTAGEM TEXT,
+		PLP_DT_POSTAGEM_SARA TEXT,
+		PLP_DT_FECHAMENTO TEXT,
+		PLP_DT_ATUALIZACAO_CLIENTE TEXT,
+		PLP_TX_XML TEXT
+	)`,
+	`CREATE TABLE NEP_OBJETO_POSTAL (
+		OBJ_NU_ETIQUETA TEXT NOT NULL PRIMARY KEY,
+		PLP_NU INTEGER NOT NULL,
+		OBJ_DT_INCLUSAO TEXT NOT NULL,
+		OBJ_IN_STATUS INTEGER DEFAULT 0 NOT NULL,
+		OBJ_TX_XML TEXT
+	)`,
+	`CREATE INDEX NEP_OBJETO_POSTAL_PLP ON NEP_OBJETO_POSTAL (PLP_NU)`,
+}
+
+var migracoesMySQL = []string{
+	`CREATE TABLE NEP_PLP (
+		PLP_NU INT NOT NULL PRIMARY KEY,
+		PLP_NU_SIGEP INT,
+		PLP_NU_CLIENTE INT,
+		PLP_IN_STATUS SMALLINT DEFAULT 0 NOT NULL,
+		PLP_DT_POSTAGEM DATETIME,
+		PLP_DT_POSTAGEM_SARA DATETIME,
+		PLP_DT_FECHAMENTO DATETIME,
+		PLP_DT_ATUALIZACAO_CLIENTE DATETIME,
+		PLP_TX_XML LONGTEXT
+	) DEFAULT CHARSET=utf8mb4`,
+	`CREATE TABLE NEP_OBJETO_POSTAL (
+		OBJ_NU_ETIQUETA VARCHAR(12) NOT NULL PRIMARY KEY,
+		PLP_NU INT NOT NULL,
+		OBJ_DT_INCLUSAO DATETIME NOT NULL,
+		OBJ_IN_STATUS SMALLINT DEFAULT 0 NOT NULL,
+		OBJ_TX_XML LONGTEXT
+	) DEFAULT CHARSET=utf8mb4`,
+	`CREATE INDEX NEP_OBJETO_POSTAL_PLP ON NEP_OBJETO_POSTAL (PLP_NU)`,
+}
@@ -0,0 +1,103 @@
+package plp
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTraduz(t *testing.T) {
+	casos := []struct {
+		dialeto  Dialeto
+		consulta string
+		esperado string
+	}{
+		{Oracle, "SELECT A FROM T WHERE B = ? AND C = ?", "SELECT A FROM T WHERE B = :1 AND C = :2"},
+		{Postgres, "UPDATE T SET A = @data(?) WHERE B = ?", "UPDATE T SET A = CAST($1 AS TIMESTAMP) WHERE B = $2"},
+		{Oracle, "SELECT @texto(A) FROM T", "SELECT to_char(A,'ddmmyyyyhh24miss') FROM T"},
+		{Oracle, "SELECT A FROM T WHERE B = '?' AND C = ?", "SELECT A FROM T WHERE B = '?' AND C = :1"},
+		{Postgres, "SELECT 'a''?b' || ?, '@data(?)'", "SELECT 'a''?b' || $1, '@data(?)'"},
+	}
+	for _, c := range casos {
+		if r := traduz(c.dialeto, c.consulta); r != c.esperado {
+			t.Errorf("traduz(%s, %q) = %q, esperado %q", c.dialeto.Nome(), c.consulta, r, c.esperado)
+		}
+	}
+}
+
+// dialetoMigracoesTeste SQLite com migrações próprias
+type dialetoMigracoesTeste struct {
+	dialetoSQLite
+	migracoes []string
+}
+
+func (d dialetoMigracoesTeste) Migracoes() []string { return d.migracoes }
+
+// contaLinhas quantidade de linhas da consulta de contagem, ou -1 em caso de erro
+func contaLinhas(t *testing.T, ctx context.Context, ex executor, consulta string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := ex.QueryRowContext(ctx, consulta, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestMigraSQLite(t *testing.T) {
+	ctx := context.Background()
+	db := bancoSQLite(t)
+	for i := 0; i < 2; i++ {
+		if err := Migra(ctx, db, SQLite); err != nil {
+			t.Fatalf("Migra %d: %v", i+1, err)
+		}
+	}
+	if n := contaLinhas(t, ctx, db, "SELECT COUNT(*) FROM NEP_MIGRACAO"); n != len(SQLite.Migracoes()) {
+		t.Errorf("%d migrações registradas, esperado %d", n, len(SQLite.Migracoes()))
+	}
+	for _, tabela := range []string{"NEP_PLP", "NEP_OBJETO_POSTAL"} {
+		if n := contaLinhas(t, ctx, db, SQLite.ConsultaTabela(), tabela); n != 1 {
+			t.Errorf("tabela %s não criada", tabela)
+		}
+	}
+}
+
+func TestMigraDesfazMigracaoComFalha(t *testing.T) {
+	ctx := context.Background()
+	db := bancoSQLite(t)
+	d := dialetoMigracoesTeste{migracoes: []string{
+		"CREATE TABLE NEP_A (A INTEGER)",
+		"CREATE TABLE NEP_B (B INTEGER); CREATE TABLE NEP_A (A INTEGER)",
+	}}
+	if err := Migra(ctx, db, d); err == nil {
+		t.Fatal("Migra sem erro com migração inválida")
+	}
+	if n := contaLinhas(t, ctx, db, "SELECT COUNT(*) FROM NEP_MIGRACAO"); n != 1 {
+		t.Errorf("%d migrações registradas, esperado 1", n)
+	}
+	if n := contaLinhas(t, ctx, db, d.ConsultaTabela(), "NEP_B"); n != 0 {
+		t.Error("migração com falha não desfeita")
+	}
+
+	d.migracoes[1] = "CREATE TABLE NEP_B (B INTEGER)"
+	if err := Migra(ctx, db, d); err != nil {
+		t.Fatalf("Migra após correção: %v", err)
+	}
+	if n := contaLinhas(t, ctx, db, "SELECT COUNT(*) FROM NEP_MIGRACAO"); n != 2 {
+		t.Errorf("%d migrações registradas, esperado 2", n)
+	}
+}
+
+func TestMigraNaoRecriaControleEmErro(t *testing.T) {
+	ctx := context.Background()
+	db := bancoSQLite(t)
+	if err := Migra(ctx, db, SQLite); err != nil {
+		t.Fatal(err)
+	}
+	cancelado, cancela := context.WithCancel(ctx)
+	cancela()
+	if err := Migra(cancelado, db, SQLite); err == nil {
+		t.Fatal("Migra sem erro com contexto cancelado")
+	}
+	if n := contaLinhas(t, ctx, db, "SELECT COUNT(*) FROM NEP_MIGRACAO"); n != len(SQLite.Migracoes()) {
+		t.Errorf("%d migrações registradas após a falha, esperado %d", n, len(SQLite.Migracoes()))
+	}
+}
@@ -0,0 +1,150 @@
+package plp
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ausente valor informado em Diferenca quando o elemento só existe em uma das PLPs
+const ausente = "(ausente)"
+
+// Diferenca campo do layout correioslog com valores diferentes entre duas PLPs
+type Diferenca struct {
+	// Campo caminho do elemento, como objeto_postal[0].destinatario.nome_destinatario
+	Campo  string
+	Antes  string
+	Depois string
+}
+
+func (d Diferenca) String() string {
+	return fmt.Sprintf("%s: %q -> %q", d.Campo, d.Antes, d.Depois)
+}
+
+// Diff compara os campos do layout correioslog das PLPs a e b e devolve os que
+// mudaram, na ordem do documento. Os objetos postais são comparados pela posição;
+// objetos a mais ou a menos aparecem como "(ausente)". Campos fora do layout,
+// como ID, Status e as datas, não são comparados.
+func Diff(a, b *Plp) []Diferenca {
+	return comparaCampos("", reflect.ValueOf(a), reflect.ValueOf(b), nil)
+}
+
+// comparaCampos acrescenta a difs as diferenças entre os valores a e b, do mesmo tipo
+func comparaCampos(caminho string, a, b reflect.Value, difs []Diferenca) []Diferenca {
+	switch a.Kind() {
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				difs = append(difs, Diferenca{caminho, resumo(a), resumo(b)})
+			}
+			return difs
+		}
+		return comparaCampos(caminho, a.Elem(), b.Elem(), difs)
+	case reflect.Struct:
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			nome, ok := nomeElemento(t.Field(i))
+			if !ok {
+				continue
+			}
+			difs = comparaCampos(juntaCaminho(caminho, nome), a.Field(i), b.Field(i), difs)
+		}
+		return difs
+	case reflect.Slice:
+		n := a.Len()
+		if b.Len() > n {
+			n = b.Len()
+		}
+		for i := 0; i < n; i++ {
+			c := fmt.Sprintf("%s[%d]", caminho, i)
+			switch {
+			case i >= a.Len():
+				difs = append(difs, Diferenca{c, ausente, resumo(b.Index(i))})
+			case i >= b.Len():
+				difs = append(difs, Diferenca{c, resumo(a.Index(i)), ausente})
+			default:
+				difs = comparaCampos(c, a.Index(i), b.Index(i), difs)
+			}
+		}
+		return difs
+	}
+	if va, vb := valorCampo(a), valorCampo(b); va != vb {
+		difs = append(difs, Diferenca{caminho, va, vb})
+	}
+	return difs
+}
+
+// aparaTextos remove os espaços do início e do fim de todos os campos de texto do layout em v
+func aparaTextos(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			aparaTextos(v.Elem())
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if _, ok := nomeElemento(t.Field(i)); ok {
+				aparaTextos(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			aparaTextos(v.Index(i))
+		}
+	case reflect.String:
+		v.SetString(strings.TrimSpace(v.String()))
+	}
+}
+
+// nomeElemento nome do elemento XML do campo, vazio para o texto de campos CDATA.
+// Campos fora do layout devolvem false.
+func nomeElemento(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("xml")
+	if tag == "-" || f.Name == "XMLName" || f.PkgPath != "" {
+		return "", false
+	}
+	nome := strings.Split(tag, ",")[0]
+	if nome == "" && !strings.Contains(tag, ",cdata") {
+		nome = f.Name
+	}
+	return nome, true
+}
+
+func juntaCaminho(caminho, nome string) string {
+	if caminho == "" || nome == "" {
+		return caminho + nome
+	}
+	return caminho + "." + nome
+}
+
+// valorCampo texto do valor como escrito no XML
+func valorCampo(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// resumo valor de um elemento que só existe em uma das PLPs
+func resumo(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return ausente
+		}
+		if o, ok := v.Interface().(*Objeto); ok {
+			return o.NumeroEtiqueta
+		}
+		return "(presente)"
+	case reflect.Struct, reflect.Slice:
+		return "(presente)"
+	}
+	return valorCampo(v)
+}
@@ -0,0 +1,300 @@
+package plp
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// Declarações do documento correioslog escrito por WriteXML e por XML
+const (
+	declaracaoXML     = `<?xml version="1.0" encoding="ISO-8859-1" ?>`
+	declaracaoXMLUTF8 = `<?xml version="1.0" encoding="UTF-8" ?>`
+)
+
+// Regras de escrita dos campos da PLP, adotadas por todos os campos:
+//   - campos de texto vazios e numéricos zerados, exceto o peso, viram elementos vazios, como <rt1/>;
+//   - campos CDATA são sempre escritos em CDATA, mesmo vazios, como <complemento_remetente><![CDATA[]]></complemento_remetente>;
+//   - valor_declarado e endereco_vizinho são omitidos quando vazios.
+//
+// Ida e volta: para toda PLP p lida por ReadPlp ou NewPlp, ReadPlp aplicado ao
+// documento escrito por WriteXML devolve uma PLP sem diferenças para p segundo
+// Diff. O texto devolvido por XML, declarado em UTF-8, pode ser lido diretamente
+// por NewPlp. Os elementos omitidos e os elementos vazios são lidos como o
+// valor zero, e por isso não são diferenças. Campos fora do layout, como ID,
+// Status e as datas, não fazem parte do documento.
+
+// WriteXML escreve a PLP no layout correioslog em w, codificada em ISO-8859-1
+// conforme a declaração do documento. Caracteres fora do ISO-8859-1 são escritos
+// como referências numéricas, como &#8364;. Os objetos são escritos um a um, sem
+// montar o documento inteiro em memória.
+func (p *Plp) WriteXML(w io.Writer) error {
+	iso := transform.NewWriter(w, charmap.ISO8859_1.NewEncoder())
+	if err := p.escreveXML(iso, true); err != nil {
+		return fmt.Errorf("plp writexml: %s", err)
+	}
+	if err := iso.Close(); err != nil {
+		return fmt.Errorf("plp writexml: %s", err)
+	}
+	return nil
+}
+
+// XML monta o xml da PLP. O texto devolvido tem o mesmo conteúdo escrito por
+// WriteXML, mas como string Go em UTF-8 e com a declaração encoding="UTF-8",
+// pronto para ser enviado em FechaPlpVariosServicos.
+func (p *Plp) XML() (string, error) {
+	var b strings.Builder
+	if err := p.escreveXML(&b, false); err != nil {
+		return "", fmt.Errorf("plp xml 1: %s", err)
+	}
+	return b.String(), nil
+}
+
+// escreveXML escreve o documento em w. Com latin1, o documento é declarado em
+// ISO-8859-1 e os caracteres fora dele são convertidos em referências numéricas;
+// sem latin1, é declarado em UTF-8.
+func (p *Plp) escreveXML(w io.Writer, latin1 bool) error {
+	e := &escritorXML{w: bufio.NewWriter(w), latin1: latin1}
+	if latin1 {
+		e.bruto(declaracaoXML)
+	} else {
+		e.bruto(declaracaoXMLUTF8)
+	}
+	e.abre("correioslog")
+	e.texto("tipo_arquivo", p.TipoArquivo)
+	e.texto("versao_arquivo", p.VersaoArquivo)
+
+	e.abre("plp")
+	e.inteiro("id_plp", p.Plp.IDPlp)
+	e.decimal("valor_global", p.Plp.ValorGlobal)
+	e.texto("mcu_unidade_postagem", p.Plp.McuUnidadePostagem)
+	e.texto("nome_unidade_postagem", p.Plp.NmeUnidadePostagem)
+	e.texto("cartao_postagem", p.Plp.CartaoPostagem)
+	e.fecha("plp")
+
+	r := &p.Remetente
+	e.abre("remetente")
+	e.texto("numero_contrato", r.NumeroContrato)
+	e.texto("numero_diretoria", r.NumeroDiretoria)
+	e.texto("codigo_administrativo", r.CodigoAdministrativo)
+	e.cdata("nome_remetente", r.NomeRemetente.CData)
+	e.cdata("logradouro_remetente", r.LogradouroRemetente.CData)
+	e.cdata("numero_remetente", r.NumeroRemetente.CData)
+	e.cdata("complemento_remetente", r.ComplementoRemetente.CData)
+	e.cdata("bairro_remetente", r.BairroRemetente.CData)
+	e.cdata("cep_remetente", r.CepRemetente.CData)
+	e.cdata("cidade_remetente", r.CidadeRemetente.CData)
+	e.texto("uf_remetente", r.UfRemetente)
+	e.cdata("telefone_remetente", r.TelefoneRemetente.CData)
+	e.cdata("fax_remetente", r.FaxRemetente.CData)
+	e.cdata("email_remetente", r.EmailRemetente.CData)
+	e.cdata("celular_remetente", r.CelularRemetente.CData)
+	e.texto("cpf_cnpj_remetente", r.CpfCnpjRemetente)
+	e.texto("ciencia_conteudo_proibido", r.CienciaConteudoProibido)
+	e.fecha("remetente")
+
+	e.texto("forma_pagamento", p.FormaPagamento)
+	for _, o := range p.Objetos {
+		o.escreveXML(e)
+		if e.err != nil {
+			return e.err
+		}
+	}
+	e.fecha("correioslog")
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// escreveXML escreve o elemento objeto_postal
+func (o *Objeto) escreveXML(e *escritorXML) {
+	e.abre("objeto_postal")
+	e.texto("numero_etiqueta", o.NumeroEtiqueta)
+	e.texto("codigo_objeto_cliente", o.CodigoObjetoCliente)
+	e.texto("codigo_servico_postagem", o.CodigoServicoPostagem)
+	e.texto("cubagem", o.Cubagem)
+	e.bruto("<peso>" + strconv.Itoa(o.Peso) + "</peso>")
+	e.texto("rt1", o.Rt1)
+	e.texto("rt2", o.Rt2)
+	e.texto("restricao_anac", o.RestricaoANAC)
+
+	d := &o.Destinatario
+	e.abre("destinatario")
+	e.cdata("nome_destinatario", d.NomeDestinatario.CData)
+	e.cdata("telefone_destinatario", d.TelefoneDestinatario.CData)
+	e.cdata("celular_destinatario", d.CelularDestinatario.CData)
+	e.cdata("email_destinatario", d.EmailDestinatario.CData)
+	e.cdata("logradouro_destinatario", d.LogradouroDestinatario.CData)
+	e.cdata("complemento_destinatario", d.ComplementoDestinatario.CData)
+	e.cdata("numero_end_destinatario", d.NumeroEndDestinatario.CData)
+	e.texto("cpf_cnpj_destinatario", d.CpfCnpjDestinatario)
+	e.fecha("destinatario")
+
+	n := &o.Nacional
+	e.abre("nacional")
+	e.cdata("bairro_destinatario", n.BairroDestinatario.CData)
+	e.cdata("cidade_destinatario", n.CidadeDestinatario.CData)
+	e.texto("uf_destinatario", n.UfDestinatario)
+	e.cdata("cep_destinatario", n.CepDestinatario.CData)
+	e.texto("codigo_usuario_postal", n.CodigoUsuarioPostal)
+	e.texto("centro_custo_cliente", n.CentroCustoCliente)
+	e.texto("numero_nota_fiscal", n.NumeroNotaFiscal)
+	e.texto("serie_nota_fiscal", n.SerieNotaFiscal)
+	e.texto("valor_nota_fiscal", n.ValorNotaFiscal)
+	e.texto("natureza_nota_fiscal", n.NaturezaNotaFiscal)
+	e.cdata("descricao_objeto", n.DescricaoObjeto.CData)
+	e.texto("valor_a_cobrar", n.ValorACobrar)
+	e.fecha("nacional")
+
+	for _, sa := range o.ServicoAdicional {
+		e.abre("servico_adicional")
+		for _, c := range sa.CodigoServicoAdicional {
+			e.texto("codigo_servico_adicional", c)
+		}
+		if sa.ValorDeclarado != "" {
+			e.texto("valor_declarado", sa.ValorDeclarado)
+		}
+		if sa.EnderecoVizinho.CData != "" {
+			e.cdata("endereco_vizinho", sa.EnderecoVizinho.CData)
+		}
+		e.fecha("servico_adicional")
+	}
+
+	dim := &o.Dimensoes
+	e.abre("dimensao_objeto")
+	e.texto("tipo_objeto", dim.Tipo)
+	e.texto("dimensao_altura", dim.Altura)
+	e.texto("dimensao_largura", dim.Largura)
+	e.texto("dimensao_comprimento", dim.Comprimento)
+	e.texto("dimensao_diametro", dim.Diametro)
+	e.fecha("dimensao_objeto")
+
+	e.texto("data_postagem_sara", o.DataPostagemSara)
+	e.texto("status_processamento", o.StatusProcessamento)
+	e.texto("numero_comprovante_postagem", o.NumeroComprovantePostagem)
+	e.decimal("valor_cobrado", o.ValorCobrado)
+	e.fecha("objeto_postal")
+}
+
+// escritorXML escreve os elementos do layout correioslog guardando o primeiro erro
+type escritorXML struct {
+	w      *bufio.Writer
+	latin1 bool
+	err    error
+}
+
+func (e *escritorXML) bruto(s string) {
+	if e.err == nil {
+		_, e.err = e.w.WriteString(s)
+	}
+}
+
+func (e *escritorXML) abre(nome string) {
+	e.bruto("<" + nome + ">")
+}
+
+func (e *escritorXML) fecha(nome string) {
+	e.bruto("</" + nome + ">")
+}
+
+// texto escreve o elemento com o valor escapado, ou o elemento vazio
+func (e *escritorXML) texto(nome string, valor string) {
+	if valor == "" {
+		e.bruto("<" + nome + "/>")
+		return
+	}
+	e.abre(nome)
+	e.escapa(valor)
+	e.fecha(nome)
+}
+
+// inteiro escreve o elemento com o número, ou o elemento vazio quando zero
+func (e *escritorXML) inteiro(nome string, valor int) {
+	if valor == 0 {
+		e.texto(nome, "")
+		return
+	}
+	e.texto(nome, strconv.Itoa(valor))
+}
+
+// decimal escreve o elemento com o número, ou o elemento vazio quando zero
+func (e *escritorXML) decimal(nome string, valor float64) {
+	if valor == 0 {
+		e.texto(nome, "")
+		return
+	}
+	e.texto(nome, strconv.FormatFloat(valor, 'g', -1, 64))
+}
+
+// escapa escreve o texto escapado, com referências numéricas para os caracteres
+// fora do ISO-8859-1 quando necessário
+func (e *escritorXML) escapa(valor string) {
+	if e.err != nil {
+		return
+	}
+	if !e.latin1 || apenasLatin1(valor) {
+		e.err = xml.EscapeText(e.w, []byte(valor))
+		return
+	}
+	for _, r := range valor {
+		if r > 0xFF {
+			e.bruto("&#" + strconv.Itoa(int(r)) + ";")
+			continue
+		}
+		if e.err == nil {
+			e.err = xml.EscapeText(e.w, []byte(string(r)))
+		}
+	}
+}
+
+// cdata escreve o elemento com o valor em uma seção CDATA, mesmo vazio. As
+// sequências "]]>" e, quando necessário, os caracteres fora do ISO-8859-1 são
+// escritos fora da seção, que é reaberta em seguida.
+func (e *escritorXML) cdata(nome string, valor string) {
+	e.abre(nome)
+	e.bruto("<![CDATA[")
+	for valor != "" {
+		i := strings.Index(valor, "]]>")
+		j := -1
+		if e.latin1 {
+			j = indiceForaLatin1(valor)
+		}
+		switch {
+		case i < 0 && j < 0:
+			e.bruto(valor)
+			valor = ""
+		case j < 0 || (i >= 0 && i < j):
+			e.bruto(valor[:i+2] + "]]><![CDATA[")
+			valor = valor[i+2:]
+		default:
+			r, tam := utf8.DecodeRuneInString(valor[j:])
+			e.bruto(valor[:j] + "]]>&#" + strconv.Itoa(int(r)) + ";<![CDATA[")
+			valor = valor[j+tam:]
+		}
+	}
+	e.bruto("]]>")
+	e.fecha(nome)
+}
+
+// apenasLatin1 indica se todos os caracteres estão no ISO-8859-1
+func apenasLatin1(s string) bool {
+	return indiceForaLatin1(s) < 0
+}
+
+// indiceForaLatin1 posição do primeiro caractere fora do ISO-8859-1, ou -1
+func indiceForaLatin1(s string) int {
+	for i, r := range s {
+		if r > 0xFF {
+			return i
+		}
+	}
+	return -1
+}
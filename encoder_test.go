@@ -0,0 +1,117 @@
+package plp
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// atualiza regrava os arquivos de testdata/golden com a saída atual de WriteXML
+var atualiza = flag.Bool("atualiza", false, "regrava os arquivos de testdata/golden")
+
+// plpAcentuada PLP com textos acentuados e caracteres fora do ISO-8859-1
+func plpAcentuada() *Plp {
+	p := &Plp{TipoArquivo: "Postagem", VersaoArquivo: "2.3"}
+	p.Plp.CartaoPostagem = "0067599079"
+	p.Remetente.NomeRemetente.CData = "Ação & Cia"
+	o := &Objeto{NumeroEtiqueta: "SZ000000015BR", CodigoServicoPostagem: "03220", Peso: 300}
+	o.Destinatario.NomeDestinatario.CData = "José Conceição"
+	o.Nacional.DescricaoObjeto.CData = "Livro de R$ 10 ou € 2"
+	p.Objetos = []*Objeto{o}
+	return p
+}
+
+func TestXMLDeclaraUTF8(t *testing.T) {
+	p := plpAcentuada()
+	s, err := p.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(s, declaracaoXMLUTF8) {
+		t.Errorf("XML() começa com %.45q, esperado a declaração UTF-8", s)
+	}
+	if !utf8.ValidString(s) || !strings.Contains(s, "José Conceição") || !strings.Contains(s, "€ 2") {
+		t.Errorf("XML() sem os textos em UTF-8: %s", s)
+	}
+	lida, err := NewPlp([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if difs := Diff(p, &lida); len(difs) != 0 {
+		t.Errorf("NewPlp(XML()) com diferenças: %v", difs)
+	}
+}
+
+func TestWriteXMLISO88591(t *testing.T) {
+	var b bytes.Buffer
+	if err := plpAcentuada().WriteXML(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b.Bytes(), []byte(declaracaoXML)) {
+		t.Errorf("WriteXML começa com %.45q, esperado a declaração ISO-8859-1", b.Bytes())
+	}
+	if !bytes.Contains(b.Bytes(), []byte("Jos\xe9 Concei\xe7\xe3o")) || !bytes.Contains(b.Bytes(), []byte("]]>&#8364;<![CDATA[")) {
+		t.Errorf("WriteXML sem os textos em ISO-8859-1: %q", b.Bytes())
+	}
+}
+
+// TestIdaEVolta lê cada PLP de testdata e confere que WriteXML seguido de
+// ReadPlp, e XML seguido de NewPlp, devolvem uma PLP sem diferenças segundo
+// Diff. A saída de WriteXML é comparada com testdata/golden.
+func TestIdaEVolta(t *testing.T) {
+	arquivos, err := filepath.Glob(filepath.Join("testdata", "*.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arquivos) == 0 {
+		t.Fatal("testdata sem PLPs")
+	}
+	for _, arquivo := range arquivos {
+		nome := filepath.Base(arquivo)
+		t.Run(nome, func(t *testing.T) {
+			p := lePlpTeste(t, nome)
+
+			var b bytes.Buffer
+			if err := p.WriteXML(&b); err != nil {
+				t.Fatal(err)
+			}
+			lida, err := ReadPlp(bytes.NewReader(b.Bytes()))
+			if err != nil {
+				t.Fatalf("ReadPlp(WriteXML): %v", err)
+			}
+			if difs := Diff(&p, &lida); len(difs) != 0 {
+				t.Errorf("WriteXML/ReadPlp com diferenças: %v", difs)
+			}
+
+			s, err := p.XML()
+			if err != nil {
+				t.Fatal(err)
+			}
+			lida, err = NewPlp([]byte(s))
+			if err != nil {
+				t.Fatalf("NewPlp(XML): %v", err)
+			}
+			if difs := Diff(&p, &lida); len(difs) != 0 {
+				t.Errorf("XML/NewPlp com diferenças: %v", difs)
+			}
+
+			golden := filepath.Join("testdata", "golden", nome)
+			if *atualiza {
+				if err := ioutil.WriteFile(golden, b.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			esperado, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (gere com go test -run TestIdaEVolta -atualiza)", err)
+			}
+			if !bytes.Equal(b.Bytes(), esperado) {
+				t.Errorf("WriteXML difere de %s:\n%s", golden, b.Bytes())
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package plp
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// EstadoObjeto estado de um objeto postal, com os valores das constantes EstadoObjeto*
+type EstadoObjeto int
+
+// Erros da máquina de estados dos objetos postais
+var (
+	ErrEstadoObjetoInvalido = errors.New("negocio: estado de objeto inválido")
+	ErrTransicaoInvalida    = errors.New("negocio: mudança de estado do objeto não permitida")
+)
+
+var nomesEstadoObjeto = map[EstadoObjeto]string{
+	EstadoObjetoEmAberto:              "em aberto",
+	EstadoObjetoPostado:               "postado",
+	EstadoObjetoCancelado:             "cancelado",
+	EstadoObjetoEmConferencia:         "em conferência",
+	EstadoObjetoConferido:             "conferido",
+	EstadoObjetoConferenciaFinalizada: "conferência finalizada",
+	EstadoObjetoRemovidoDaConferencia: "removido da conferência",
+}
+
+func (e EstadoObjeto) String() string {
+	if nome, ok := nomesEstadoObjeto[e]; ok {
+		return nome
+	}
+	return fmt.Sprintf("EstadoObjeto(%d)", int(e))
+}
+
+// Valido indica se e é um dos estados conhecidos
+func (e EstadoObjeto) Valido() bool {
+	_, ok := nomesEstadoObjeto[e]
+	return ok
+}
+
+// Final indica se o objeto não pode mais mudar de estado
+func (e EstadoObjeto) Final() bool {
+	return e.Valido() && len(transicoesObjeto[e]) == 0
+}
+
+// PodeMudarPara indica se a mudança de e para o estado novo é permitida
+func (e EstadoObjeto) PodeMudarPara(novo EstadoObjeto) bool {
+	for _, t := range transicoesObjeto[e] {
+		if t == novo {
+			return true
+		}
+	}
+	return false
+}
+
+// transicoesObjeto mudanças de estado permitidas a partir de cada estado
+var transicoesObjeto = map[EstadoObjeto][]EstadoObjeto{
+	EstadoObjetoEmAberto:              {EstadoObjetoPostado, EstadoObjetoCancelado},
+	EstadoObjetoPostado:               {EstadoObjetoEmConferencia, EstadoObjetoCancelado},
+	EstadoObjetoEmConferencia:         {EstadoObjetoConferido, EstadoObjetoRemovidoDaConferencia},
+	EstadoObjetoConferido:             {EstadoObjetoConferenciaFinalizada, EstadoObjetoRemovidoDaConferencia},
+	EstadoObjetoRemovidoDaConferencia: {EstadoObjetoEmConferencia},
+	EstadoObjetoCancelado:             nil,
+	EstadoObjetoConferenciaFinalizada: nil,
+}
+
+// ErroTransicao mudança de estado recusada
+type ErroTransicao struct {
+	Etiqueta string
+	De       EstadoObjeto
+	Para     EstadoObjeto
+	// Err ErrTransicaoInvalida ou o erro devolvido por um hook Antes
+	Err error
+}
+
+func (e *ErroTransicao) Error() string {
+	if e.Err == ErrTransicaoInvalida {
+		return fmt.Sprintf("negocio: objeto %s não pode passar de %s para %s", e.Etiqueta, e.De, e.Para)
+	}
+	return fmt.Sprintf("negocio: objeto %s de %s para %s: %s", e.Etiqueta, e.De, e.Para, e.Err)
+}
+
+// Unwrap devolve ErrTransicaoInvalida ou o erro do hook
+func (e *ErroTransicao) Unwrap() error {
+	return e.Err
+}
+
+// HookEstado função chamada na mudança de estado do objeto de para para
+type HookEstado func(o *Objeto, de, para EstadoObjeto) error
+
+// MaquinaEstados aplica as mudanças de estado dos objetos postais, chamando os
+// hooks registrados. Hooks Antes podem recusar a mudança devolvendo erro; hooks
+// Depois são chamados com o estado já alterado, e seus erros são devolvidos sem
+// desfazer a mudança.
+type MaquinaEstados struct {
+	mu     sync.RWMutex
+	antes  []HookEstado
+	depois []HookEstado
+}
+
+var maquinaPadrao = &MaquinaEstados{}
+
+// MaquinaEstadosPadrao devolve a máquina usada por Objeto.MudaEstado e pelo
+// AtualizaEstadoObjeto dos repositórios
+func MaquinaEstadosPadrao() *MaquinaEstados {
+	return maquinaPadrao
+}
+
+// Antes registra um hook chamado antes de cada mudança de estado
+func (m *MaquinaEstados) Antes(h HookEstado) {
+	m.mu.Lock()
+	m.antes = append(m.antes, h)
+	m.mu.Unlock()
+}
+
+// Depois registra um hook chamado após cada mudança de estado
+func (m *MaquinaEstados) Depois(h HookEstado) {
+	m.mu.Lock()
+	m.depois = append(m.depois, h)
+	m.mu.Unlock()
+}
+
+// Muda passa o objeto para o estado novo, devolvendo *ErroTransicao quando a
+// mudança não é permitida ou é recusada por um hook Antes
+func (m *MaquinaEstados) Muda(o *Objeto, novo EstadoObjeto) error {
+	return m.muda(o, novo, nil)
+}
+
+// muda aplica a mudança como Muda. Depois dos hooks Antes, grava, quando não
+// nil, persiste a mudança; se falhar, o objeto mantém o estado, os hooks Depois
+// não são chamados e o erro de grava é devolvido.
+func (m *MaquinaEstados) muda(o *Objeto, novo EstadoObjeto, grava func() error) error {
+	de := o.Estado()
+	if !de.PodeMudarPara(novo) {
+		return &ErroTransicao{Etiqueta: o.NumeroEtiqueta, De: de, Para: novo, Err: ErrTransicaoInvalida}
+	}
+	m.mu.RLock()
+	antes, depois := m.antes, m.depois
+	m.mu.RUnlock()
+	for _, h := range antes {
+		if err := h(o, de, novo); err != nil {
+			return &ErroTransicao{Etiqueta: o.NumeroEtiqueta, De: de, Para: novo, Err: err}
+		}
+	}
+	if grava != nil {
+		if err := grava(); err != nil {
+			return err
+		}
+	}
+	o.StatusTabela = int(novo)
+	for _, h := range depois {
+		if err := h(o, de, novo); err != nil {
+			return fmt.Errorf("negocio: objeto %s de %s para %s: %w", o.NumeroEtiqueta, de, novo, err)
+		}
+	}
+	return nil
+}
+
+// Estado estado do objeto guardado em StatusTabela
+func (o *Objeto) Estado() EstadoObjeto {
+	return EstadoObjeto(o.StatusTabela)
+}
+
+// MudaEstado passa o objeto para o estado novo usando a MaquinaEstadosPadrao
+func (o *Objeto) MudaEstado(novo EstadoObjeto) error {
+	return maquinaPadrao.Muda(o, novo)
+}
@@ -0,0 +1,142 @@
+package plp
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// isolaHooks devolve uma função que restaura os hooks da máquina padrão
+func isolaHooks() func() {
+	m := maquinaPadrao
+	m.mu.Lock()
+	antes, depois := m.antes, m.depois
+	m.mu.Unlock()
+	return func() {
+		m.mu.Lock()
+		m.antes, m.depois = antes, depois
+		m.mu.Unlock()
+	}
+}
+
+// isolaRepositorio devolve uma função que restaura o repositório padrão
+func isolaRepositorio() func() {
+	muRepositorio.RLock()
+	r := repositorioPadrao
+	muRepositorio.RUnlock()
+	return func() { DefineRepositorio(r) }
+}
+
+func TestEstadoObjetoTransicoes(t *testing.T) {
+	o := &Objeto{NumeroEtiqueta: "SZ000000015BR"}
+	if err := o.MudaEstado(EstadoObjetoPostado); err != nil {
+		t.Fatal(err)
+	}
+	// as constantes comparam com o campo int e com EstadoObjeto
+	if o.StatusTabela != EstadoObjetoPostado || o.ToJSON(nil).Status != EstadoObjetoPostado || o.Estado() != EstadoObjetoPostado {
+		t.Errorf("estado após MudaEstado = %d", o.StatusTabela)
+	}
+	if err := o.MudaEstado(EstadoObjetoConferido); !errors.Is(err, ErrTransicaoInvalida) {
+		t.Errorf("postado -> conferido = %v, esperado ErrTransicaoInvalida", err)
+	}
+	for _, e := range []EstadoObjeto{EstadoObjetoCancelado, EstadoObjetoConferenciaFinalizada} {
+		if !e.Final() {
+			t.Errorf("%s não é final", e)
+		}
+	}
+	if EstadoObjeto(9).Valido() {
+		t.Error("EstadoObjeto(9) válido")
+	}
+}
+
+func TestAtualizaEstadoObjetoChamaHooks(t *testing.T) {
+	defer isolaHooks()()
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	if err := repo.InsereObjeto(ctx, 1, &Objeto{NumeroEtiqueta: "SZ000000015BR"}); err != nil {
+		t.Fatal(err)
+	}
+
+	recusa := errors.New("conferência fechada")
+	var chamadas []string
+	maquinaPadrao.Antes(func(o *Objeto, de, para EstadoObjeto) error {
+		chamadas = append(chamadas, "antes "+de.String()+" -> "+para.String())
+		if para == EstadoObjetoEmConferencia {
+			return recusa
+		}
+		return nil
+	})
+	maquinaPadrao.Depois(func(o *Objeto, de, para EstadoObjeto) error {
+		if o.Estado() != para {
+			t.Errorf("hook Depois com o objeto %s, esperado %s", o.Estado(), para)
+		}
+		chamadas = append(chamadas, "depois "+para.String())
+		return nil
+	})
+
+	if err := repo.AtualizaEstadoObjeto(ctx, "SZ000000015BR", EstadoObjetoEmAberto, EstadoObjetoPostado); err != nil {
+		t.Fatal(err)
+	}
+	if len(chamadas) != 2 || chamadas[0] != "antes em aberto -> postado" || chamadas[1] != "depois postado" {
+		t.Errorf("hooks chamados = %q", chamadas)
+	}
+
+	var et *ErroTransicao
+	err := repo.AtualizaEstadoObjeto(ctx, "SZ000000015BR", EstadoObjetoPostado, EstadoObjetoEmConferencia)
+	if !errors.As(err, &et) || !errors.Is(err, recusa) {
+		t.Errorf("mudança recusada pelo hook = %v, esperado *ErroTransicao", err)
+	}
+	if o, _ := repo.BuscaObjeto(ctx, "SZ000000015BR"); o.Estado() != EstadoObjetoPostado {
+		t.Errorf("estado gravado após recusa = %s, esperado postado", o.Estado())
+	}
+
+	if err := repo.AtualizaEstadoObjeto(ctx, "SZ000000015BR", EstadoObjetoPostado, EstadoObjetoConferido); !errors.Is(err, ErrTransicaoInvalida) {
+		t.Errorf("postado -> conferido = %v, esperado ErrTransicaoInvalida", err)
+	}
+	if err := repo.AtualizaEstadoObjeto(ctx, "SZ000000015BR", EstadoObjetoEmAberto, EstadoObjetoCancelado); !errors.Is(err, ErrEstadoObjetoAlterado) {
+		t.Errorf("mudança a partir de estado antigo = %v, esperado ErrEstadoObjetoAlterado", err)
+	}
+	if err := repo.AtualizaEstadoObjeto(ctx, "SZ000000029BR", EstadoObjetoEmAberto, EstadoObjetoPostado); !errors.Is(err, ErrObjetoNaoEncontrado) {
+		t.Errorf("objeto não cadastrado = %v, esperado ErrObjetoNaoEncontrado", err)
+	}
+}
+
+func TestObjetoJSONValidaUsaMaquinaEstados(t *testing.T) {
+	defer isolaRepositorio()()
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	DefineRepositorio(repo)
+
+	estados := map[string]EstadoObjeto{
+		"SZ000000015BR": EstadoObjetoEmAberto,
+		"SZ000000029BR": EstadoObjetoPostado,
+		"SZ000000032BR": EstadoObjetoEmConferencia,
+		"SZ000000046BR": EstadoObjetoCancelado,
+	}
+	for etiqueta, e := range estados {
+		if err := repo.InsereObjeto(ctx, 1, &Objeto{NumeroEtiqueta: etiqueta, StatusTabela: int(e)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	casos := []struct {
+		etiqueta string
+		valido   bool
+		err      error
+	}{
+		{"SZ000000015BR", true, nil},
+		{"SZ000000050BR", true, nil},
+		{"SZ000000029BR", false, ErrObjetoPostado},
+		{"SZ000000032BR", false, ErrObjetoPostado},
+		{"SZ000000046BR", false, ErrTransicaoInvalida},
+	}
+	for _, c := range casos {
+		err := (&ObjetoJSON{Etiqueta: c.etiqueta}).Valida()
+		if c.valido && err != nil {
+			t.Errorf("Valida(%s) = %v, esperado nil", c.etiqueta, err)
+		}
+		if !c.valido && !errors.Is(err, c.err) {
+			t.Errorf("Valida(%s) = %v, esperado %v", c.etiqueta, err, c.err)
+		}
+	}
+}
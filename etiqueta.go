@@ -0,0 +1,248 @@
+package plp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Erros das etiquetas e faixas de etiquetas
+var (
+	ErrFaixaEtiquetasInvalida = errors.New("negocio: faixa de etiquetas inválida")
+	ErrEtiquetasEsgotadas     = errors.New("negocio: número máximo de etiqueta atingido")
+)
+
+// maxNumeroEtiqueta maior número de oito dígitos de uma etiqueta
+const maxNumeroEtiqueta = 99999999
+
+// Etiqueta etiqueta de objeto postal, como SZ000001006BR: prefixo de duas
+// letras, número de oito dígitos, dígito verificador e sufixo de duas letras
+type Etiqueta struct {
+	Prefixo string
+	Numero  int
+	DV      int
+	Sufixo  string
+}
+
+// NovaEtiqueta monta a etiqueta calculando o dígito verificador
+func NovaEtiqueta(prefixo string, numero int, sufixo string) (Etiqueta, error) {
+	e := Etiqueta{Prefixo: strings.ToUpper(prefixo), Numero: numero, Sufixo: strings.ToUpper(sufixo)}
+	if !letras(e.Prefixo) || !letras(e.Sufixo) || numero < 0 || numero > maxNumeroEtiqueta {
+		return Etiqueta{}, fmt.Errorf("%w: %s%d%s", ErrEtiquetaInvalida, prefixo, numero, sufixo)
+	}
+	e.DV = digitoVerificador(numero)
+	return e, nil
+}
+
+// ParseEtiqueta lê a etiqueta com ou sem dígito verificador, ignorando espaços
+// e maiúsculas, como "SZ00000100 BR" ou "sz000001006br". Quando informado, o
+// dígito verificador é conferido.
+func ParseEtiqueta(s string) (Etiqueta, error) {
+	t := normalizaEtiqueta(s)
+	if len(t) != 12 && len(t) != 13 {
+		return Etiqueta{}, fmt.Errorf("%w: %s", ErrEtiquetaInvalida, s)
+	}
+	digitos := t[2 : len(t)-2]
+	for i := 0; i < len(digitos); i++ {
+		if digitos[i] < '0' || digitos[i] > '9' {
+			return Etiqueta{}, fmt.Errorf("%w: %s", ErrEtiquetaInvalida, s)
+		}
+	}
+	numero, _ := strconv.Atoi(digitos[:8])
+	e, err := NovaEtiqueta(t[:2], numero, t[len(t)-2:])
+	if err != nil {
+		return Etiqueta{}, fmt.Errorf("%w: %s", ErrEtiquetaInvalida, s)
+	}
+	if len(digitos) == 9 && int(digitos[8]-'0') != e.DV {
+		return Etiqueta{}, fmt.Errorf("%w: %s", ErrDVEtiqueta, s)
+	}
+	return e, nil
+}
+
+// String etiqueta com o dígito verificador, como SZ000001006BR
+func (e Etiqueta) String() string {
+	return fmt.Sprintf("%s%08d%d%s", e.Prefixo, e.Numero, e.DV, e.Sufixo)
+}
+
+// SemDV etiqueta sem o dígito verificador, como SZ00000100BR
+func (e Etiqueta) SemDV() string {
+	return fmt.Sprintf("%s%08d%s", e.Prefixo, e.Numero, e.Sufixo)
+}
+
+// Proxima etiqueta seguinte de mesmo prefixo e sufixo
+func (e Etiqueta) Proxima() (Etiqueta, error) {
+	if e.Numero >= maxNumeroEtiqueta {
+		return Etiqueta{}, fmt.Errorf("%w: %s", ErrEtiquetasEsgotadas, e)
+	}
+	return NovaEtiqueta(e.Prefixo, e.Numero+1, e.Sufixo)
+}
+
+// mesmaSerie indica se as etiquetas têm o mesmo prefixo e sufixo
+func (e Etiqueta) mesmaSerie(o Etiqueta) bool {
+	return e.Prefixo == o.Prefixo && e.Sufixo == o.Sufixo
+}
+
+// FaixaEtiquetas faixa contínua de etiquetas de mesmo prefixo e sufixo, com
+// Inicio e Fim incluídos
+type FaixaEtiquetas struct {
+	Inicio Etiqueta
+	Fim    Etiqueta
+}
+
+// NovaFaixaEtiquetas monta a faixa de ini a fim
+func NovaFaixaEtiquetas(ini, fim Etiqueta) (FaixaEtiquetas, error) {
+	if !ini.mesmaSerie(fim) {
+		return FaixaEtiquetas{}, fmt.Errorf("%w: prefixos ou sufixos inicial e final não coincidem", ErrFaixaEtiquetasInvalida)
+	}
+	if fim.Numero < ini.Numero {
+		return FaixaEtiquetas{}, fmt.Errorf("%w: inicial deve ser menor que final", ErrFaixaEtiquetasInvalida)
+	}
+	return FaixaEtiquetas{Inicio: ini, Fim: fim}, nil
+}
+
+// ParseFaixaEtiquetas lê a faixa no formato "SZ46641024 BR,SZ46642023 BR"
+// devolvido pelo solicitaEtiquetas do SIGEPWEB
+func ParseFaixaEtiquetas(s string) (FaixaEtiquetas, error) {
+	partes := strings.Split(s, ",")
+	if len(partes) != 2 {
+		return FaixaEtiquetas{}, fmt.Errorf("%w: %q", ErrFaixaEtiquetasInvalida, s)
+	}
+	ini, err := ParseEtiqueta(partes[0])
+	if err != nil {
+		return FaixaEtiquetas{}, err
+	}
+	fim, err := ParseEtiqueta(partes[1])
+	if err != nil {
+		return FaixaEtiquetas{}, err
+	}
+	return NovaFaixaEtiquetas(ini, fim)
+}
+
+// String faixa no formato do solicitaEtiquetas, como "SZ46641024 BR,SZ46642023 BR"
+func (f FaixaEtiquetas) String() string {
+	return fmt.Sprintf("%s%08d %s,%s%08d %s",
+		f.Inicio.Prefixo, f.Inicio.Numero, f.Inicio.Sufixo, f.Fim.Prefixo, f.Fim.Numero, f.Fim.Sufixo)
+}
+
+// Len quantidade de etiquetas da faixa
+func (f FaixaEtiquetas) Len() int {
+	return f.Fim.Numero - f.Inicio.Numero + 1
+}
+
+// Contem indica se a etiqueta pertence à faixa
+func (f FaixaEtiquetas) Contem(e Etiqueta) bool {
+	return e.mesmaSerie(f.Inicio) && e.Numero >= f.Inicio.Numero && e.Numero <= f.Fim.Numero
+}
+
+// Cada chama fn para cada etiqueta da faixa, em ordem, até fn devolver falso
+func (f FaixaEtiquetas) Cada(fn func(e Etiqueta) bool) {
+	for n := f.Inicio.Numero; n <= f.Fim.Numero; n++ {
+		e := Etiqueta{Prefixo: f.Inicio.Prefixo, Numero: n, DV: digitoVerificador(n), Sufixo: f.Inicio.Sufixo}
+		if !fn(e) {
+			return
+		}
+	}
+}
+
+// Etiquetas etiquetas da faixa com o dígito verificador
+func (f FaixaEtiquetas) Etiquetas() []string {
+	etiquetas := make([]string, 0, f.Len())
+	f.Cada(func(e Etiqueta) bool {
+		etiquetas = append(etiquetas, e.String())
+		return true
+	})
+	return etiquetas
+}
+
+// Divide divide a faixa em faixas de no máximo tamanho etiquetas
+func (f FaixaEtiquetas) Divide(tamanho int) []FaixaEtiquetas {
+	if tamanho <= 0 {
+		tamanho = 1
+	}
+	faixas := make([]FaixaEtiquetas, 0, (f.Len()+tamanho-1)/tamanho)
+	for ini := f.Inicio.Numero; ini <= f.Fim.Numero; ini += tamanho {
+		fim := ini + tamanho - 1
+		if fim > f.Fim.Numero {
+			fim = f.Fim.Numero
+		}
+		faixas = append(faixas, FaixaEtiquetas{
+			Inicio: Etiqueta{Prefixo: f.Inicio.Prefixo, Numero: ini, DV: digitoVerificador(ini), Sufixo: f.Inicio.Sufixo},
+			Fim:    Etiqueta{Prefixo: f.Inicio.Prefixo, Numero: fim, DV: digitoVerificador(fim), Sufixo: f.Inicio.Sufixo},
+		})
+	}
+	return faixas
+}
+
+// JuntaFaixas ordena as faixas e junta as contíguas ou sobrepostas de mesmo
+// prefixo e sufixo
+func JuntaFaixas(faixas []FaixaEtiquetas) []FaixaEtiquetas {
+	ordenadas := append([]FaixaEtiquetas(nil), faixas...)
+	sort.Slice(ordenadas, func(i, j int) bool {
+		a, b := ordenadas[i].Inicio, ordenadas[j].Inicio
+		if a.Prefixo != b.Prefixo {
+			return a.Prefixo < b.Prefixo
+		}
+		if a.Sufixo != b.Sufixo {
+			return a.Sufixo < b.Sufixo
+		}
+		return a.Numero < b.Numero
+	})
+	juntas := make([]FaixaEtiquetas, 0, len(ordenadas))
+	for _, f := range ordenadas {
+		if n := len(juntas); n > 0 {
+			ultima := &juntas[n-1]
+			if ultima.Inicio.mesmaSerie(f.Inicio) && f.Inicio.Numero <= ultima.Fim.Numero+1 {
+				if f.Fim.Numero > ultima.Fim.Numero {
+					ultima.Fim = f.Fim
+				}
+				continue
+			}
+		}
+		juntas = append(juntas, f)
+	}
+	return juntas
+}
+
+// digitoVerificador dígito verificador do número da etiqueta, calculado como no
+// SIGEPWEB
+func digitoVerificador(numero int) int {
+	multiplicadores := [...]int{8, 6, 4, 2, 3, 5, 9, 7}
+	soma := 0
+	for i := 7; i >= 0; i-- {
+		soma += numero % 10 * multiplicadores[i]
+		numero /= 10
+	}
+	switch resto := soma % 11; resto {
+	case 0:
+		return 5
+	case 1:
+		return 0
+	default:
+		return 11 - resto
+	}
+}
+
+// normalizaEtiqueta etiqueta em maiúsculas e sem espaços
+func normalizaEtiqueta(s string) string {
+	return strings.ToUpper(strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s))
+}
+
+func letras(s string) bool {
+	if len(s) != 2 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,200 @@
+package plp
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/RogerioML/plp/sigeptest"
+)
+
+func TestParseEtiqueta(t *testing.T) {
+	casos := []struct {
+		entrada string
+		semDV   string
+		com     string
+	}{
+		{"SZ000000014BR", "SZ00000001BR", "SZ000000014BR"},
+		{"SZ00000001BR", "SZ00000001BR", "SZ000000014BR"},
+		{"SZ00000100 BR", "SZ00000100BR", "SZ000001006BR"},
+		{" sz00000100\tbr ", "SZ00000100BR", "SZ000001006BR"},
+		{"SZ 00000002 8 BR", "SZ00000002BR", "SZ000000028BR"},
+		{"SZ00000000BR", "SZ00000000BR", "SZ000000005BR"},
+	}
+	for _, c := range casos {
+		e, err := ParseEtiqueta(c.entrada)
+		if err != nil {
+			t.Errorf("ParseEtiqueta(%q): %v", c.entrada, err)
+			continue
+		}
+		if e.SemDV() != c.semDV || e.String() != c.com {
+			t.Errorf("ParseEtiqueta(%q) = %s / %s, esperado %s / %s", c.entrada, e.SemDV(), e, c.semDV, c.com)
+		}
+	}
+}
+
+func TestParseEtiquetaInvalida(t *testing.T) {
+	casos := []struct {
+		entrada string
+		err     error
+	}{
+		{"", ErrEtiquetaInvalida},
+		{"SZ0000001BR", ErrEtiquetaInvalida},
+		{"SZ0000000145BR", ErrEtiquetaInvalida},
+		{"SZ0000000A4BR", ErrEtiquetaInvalida},
+		{"S1000000014BR", ErrEtiquetaInvalida},
+		{"SZ000000014B9", ErrEtiquetaInvalida},
+		{"SZ-00000001BR", ErrEtiquetaInvalida},
+		{"SZ000000015BR", ErrDVEtiqueta},
+		{"SZ000001005BR", ErrDVEtiqueta},
+	}
+	for _, c := range casos {
+		if _, err := ParseEtiqueta(c.entrada); !errors.Is(err, c.err) {
+			t.Errorf("ParseEtiqueta(%q) = %v, esperado %v", c.entrada, err, c.err)
+		}
+	}
+}
+
+func TestDigitoVerificador(t *testing.T) {
+	// restos 0 e 1 da soma ponderada têm dígitos próprios
+	esperados := map[int]int{1: 4, 100: 6, 101: 0, 46641024: 5, 0: 5}
+	for numero, dv := range esperados {
+		if d := digitoVerificador(numero); d != dv {
+			t.Errorf("digitoVerificador(%08d) = %d, esperado %d", numero, d, dv)
+		}
+	}
+	// mesmo cálculo do servidor de testes, que segue o SIGEPWEB
+	for numero := 0; numero < 100000; numero += 7 {
+		e := Etiqueta{Prefixo: "SZ", Numero: numero, Sufixo: "BR"}
+		if dv, _ := sigeptest.DigitoVerificador(e.SemDV()); dv != digitoVerificador(numero) {
+			t.Fatalf("digitoVerificador(%08d) = %d, SIGEPWEB %d", numero, digitoVerificador(numero), dv)
+		}
+	}
+}
+
+func TestEtiquetaDVUsaParseEtiqueta(t *testing.T) {
+	casos := map[string]string{
+		"SZ00000001BR":   "SZ000000014BR",
+		"sz00000100 br":  "SZ000001006BR",
+		"SZ000000014BR":  "SZ000000014BR",
+		"SZ000000015BR":  "SZ000000015BR", // dígito informado é mantido
+		"SZ 000000014BR": "SZ000000014BR",
+	}
+	for entrada, esperada := range casos {
+		if e, err := EtiquetaDV(entrada); err != nil || e != esperada {
+			t.Errorf("EtiquetaDV(%q) = %s, %v, esperado %s", entrada, e, err, esperada)
+		}
+	}
+	for _, entrada := range []string{"", "SZ0000000BR", "SZ0000000A4BR", "1Z00000001BR"} {
+		if _, err := EtiquetaDV(entrada); !errors.Is(err, ErrEtiquetaInvalida) {
+			t.Errorf("EtiquetaDV(%q) = %v, esperado ErrEtiquetaInvalida", entrada, err)
+		}
+	}
+}
+
+func TestValidaEtiquetaUsaParseEtiqueta(t *testing.T) {
+	casos := map[string]error{
+		"SZ000000014BR":    nil,
+		"SZ000000005BR":    nil,
+		etiquetaProvisoria: nil,
+		"SZ000000015BR":    ErrDVEtiqueta,
+		"SZ00000001BR":     ErrEtiquetaInvalida,
+		"sz000000014br":    ErrEtiquetaInvalida,
+		"SZ00000001 4BR":   ErrEtiquetaInvalida,
+	}
+	for etiqueta, esperado := range casos {
+		v := &validador{}
+		(&Objeto{NumeroEtiqueta: etiqueta}).validaEtiqueta(v)
+		err := v.erro()
+		if esperado == nil && err != nil || esperado != nil && !errors.Is(err, esperado) {
+			t.Errorf("validaEtiqueta(%q) = %v, esperado %v", etiqueta, err, esperado)
+		}
+	}
+}
+
+func TestParseFaixaEtiquetas(t *testing.T) {
+	f, err := ParseFaixaEtiquetas("SZ00000100 BR, SZ00000103 BR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Len() != 4 || f.String() != "SZ00000100 BR,SZ00000103 BR" {
+		t.Errorf("faixa = %s com %d etiquetas", f, f.Len())
+	}
+	esperadas := []string{"SZ000001006BR", "SZ000001010BR", "SZ000001023BR", "SZ000001037BR"}
+	if e := f.Etiquetas(); !reflect.DeepEqual(e, esperadas) {
+		t.Errorf("Etiquetas() = %v, esperado %v", e, esperadas)
+	}
+	if e, err := IntervaloEtiquetas("SZ00000100 BR,SZ00000103 BR"); err != nil || !reflect.DeepEqual(e, esperadas) {
+		t.Errorf("IntervaloEtiquetas = %v, %v", e, err)
+	}
+
+	invalidas := map[string]error{
+		"SZ00000100 BR":                             ErrFaixaEtiquetasInvalida,
+		"SZ00000100 BR;SZ00000103 BR":               ErrFaixaEtiquetasInvalida,
+		"SZ00000100 BR,SZ00000103 BR,SZ00000104 BR": ErrFaixaEtiquetasInvalida,
+		"SZ00000103 BR,SZ00000100 BR":               ErrFaixaEtiquetasInvalida,
+		"SZ00000100 BR,SX00000103 BR":               ErrFaixaEtiquetasInvalida,
+		"SZ00000100 BR,SZ0000010X BR":               ErrEtiquetaInvalida,
+	}
+	for entrada, esperado := range invalidas {
+		if _, err := ParseFaixaEtiquetas(entrada); !errors.Is(err, esperado) {
+			t.Errorf("ParseFaixaEtiquetas(%q) = %v, esperado %v", entrada, err, esperado)
+		}
+	}
+	if _, err := IntervaloEtiquetas("SZ00000100 BR"); !errors.Is(err, ErrFaixaEtiquetasInvalida) {
+		t.Errorf("IntervaloEtiquetas sem vírgula = %v, esperado ErrFaixaEtiquetasInvalida", err)
+	}
+}
+
+func TestEtiquetaProxima(t *testing.T) {
+	e, _ := ParseEtiqueta("SZ00000099BR")
+	p, err := e.Proxima()
+	if err != nil || p.String() != "SZ000001006BR" {
+		t.Errorf("Proxima() = %s, %v", p, err)
+	}
+	ultima := Etiqueta{Prefixo: "SZ", Numero: maxNumeroEtiqueta, Sufixo: "BR"}
+	if _, err := ultima.Proxima(); !errors.Is(err, ErrEtiquetasEsgotadas) {
+		t.Errorf("Proxima() da última = %v, esperado ErrEtiquetasEsgotadas", err)
+	}
+}
+
+func TestFaixaEtiquetasDivideEJunta(t *testing.T) {
+	f, _ := ParseFaixaEtiquetas("SZ00000001 BR,SZ00000010 BR")
+	partes := f.Divide(4)
+	if len(partes) != 3 || partes[2].Len() != 2 || partes[1].Inicio.Numero != 5 {
+		t.Fatalf("Divide(4) = %v", partes)
+	}
+	outra, _ := ParseFaixaEtiquetas("SX00000001 BR,SX00000002 BR")
+	juntas := JuntaFaixas([]FaixaEtiquetas{partes[2], outra, partes[0], partes[1]})
+	if len(juntas) != 2 || juntas[1] != f || juntas[0] != outra {
+		t.Errorf("JuntaFaixas = %v", juntas)
+	}
+
+	n := 0
+	f.Cada(func(e Etiqueta) bool {
+		n++
+		return e.Numero < 3
+	})
+	if n != 3 {
+		t.Errorf("Cada percorreu %d etiquetas, esperado 3", n)
+	}
+	if !f.Contem(partes[1].Fim) || f.Contem(outra.Inicio) {
+		t.Error("Contem incorreto")
+	}
+}
+
+func TestRegexEtiqueta(t *testing.T) {
+	casos := map[string]bool{
+		"SZ000000014BR":  true,
+		"SZ000001006BR":  true,
+		"SZ000000015BR":  true, // o dígito verificador só é conferido por ParseEtiqueta
+		"SZ00000001BR":   false,
+		"sz000000014br":  false,
+		"SZ 000000014BR": false,
+	}
+	for etiqueta, esperado := range casos {
+		if RegexEtiqueta.MatchString(etiqueta) != esperado {
+			t.Errorf("RegexEtiqueta(%q) = %v, esperado %v", etiqueta, !esperado, esperado)
+		}
+	}
+}
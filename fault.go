@@ -0,0 +1,105 @@
+package plp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Erros conhecidos do SIGEPWEB. Um *FaultError cuja mensagem corresponda a um
+// deles satisfaz errors.Is(err, ErrXxx).
+var (
+	ErrCredenciaisInvalidas = errors.New("sigep: usuário ou senha inválidos")
+	ErrEtiquetaUtilizada    = errors.New("sigep: etiqueta já utilizada")
+	ErrPlpNaoEncontrada     = errors.New("sigep: PLP não encontrada")
+	ErrCEPNaoEncontrado     = errors.New("sigep: CEP não encontrado")
+	// ErrCEPInvalido CEP mal formado, recusado antes da busca; não vai para o
+	// cache de CEPs não encontrados
+	ErrCEPInvalido = errors.New("sigep: CEP inválido")
+)
+
+// classificacaoFaults trechos, sem acentos e em minúsculas, das mensagens do
+// SIGEPWEB associadas a cada erro conhecido
+var classificacaoFaults = []struct {
+	trechos []string
+	err     error
+}{
+	{[]string{"usuario ou senha", "senha invalida", "usuario invalido", "nao autorizado", "autenticacao"}, ErrCredenciaisInvalidas},
+	{[]string{"ja utilizada", "ja foi utilizada", "ja esta em uso", "utilizada em outra plp"}, ErrEtiquetaUtilizada},
+	{[]string{"plp nao encontrada", "nao foi encontrada plp", "nao foi encontrada a plp", "plp inexistente", "nao existe plp"}, ErrPlpNaoEncontrada},
+	{[]string{"cep invalido", "formato do cep"}, ErrCEPInvalido},
+	{[]string{"cep nao encontrado", "cep inexistente"}, ErrCEPNaoEncontrado},
+}
+
+// FaultError falha SOAP devolvida pelo SIGEPWEB em uma operação
+type FaultError struct {
+	Operation   string
+	FaultCode   string
+	FaultString string
+	StatusCode  int
+	// Raw corpo da resposta, já convertido para UTF-8
+	Raw []byte
+
+	conhecido error
+}
+
+func (e *FaultError) Error() string {
+	return fmt.Sprintf("sigep %s: %s", e.Operation, e.FaultString)
+}
+
+// Unwrap devolve o erro conhecido correspondente à mensagem da falha, quando houver
+func (e *FaultError) Unwrap() error {
+	return e.conhecido
+}
+
+// StatusError resposta do SIGEPWEB com status HTTP de erro e sem falha SOAP,
+// como as devolvidas por balanceadores e proxies quando o serviço está fora
+type StatusError struct {
+	Operation  string
+	StatusCode int
+	Raw        []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("sigep %s: status HTTP %d", e.Operation, e.StatusCode)
+}
+
+// novoFaultError monta o *FaultError e classifica a mensagem da falha
+func novoFaultError(operacao string, f *soapFault, status int, raw []byte) *FaultError {
+	return &FaultError{
+		Operation:   operacao,
+		FaultCode:   f.FaultCode,
+		FaultString: f.FaultString,
+		StatusCode:  status,
+		Raw:         raw,
+		conhecido:   classificaFault(f.FaultString),
+	}
+}
+
+// classificaFault devolve o erro conhecido correspondente à mensagem ou nil
+func classificaFault(mensagem string) error {
+	m := normalizaMensagem(mensagem)
+	for _, c := range classificacaoFaults {
+		for _, t := range c.trechos {
+			if strings.Contains(m, t) {
+				return c.err
+			}
+		}
+	}
+	return nil
+}
+
+// normalizaMensagem remove acentos e converte a mensagem para minúsculas
+func normalizaMensagem(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	r, _, err := transform.String(t, s)
+	if err != nil {
+		r = s
+	}
+	return strings.ToLower(strings.Join(strings.Fields(r), " "))
+}
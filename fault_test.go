@@ -0,0 +1,43 @@
+package plp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/RogerioML/plp/sigeptest"
+)
+
+func TestClassificaFault(t *testing.T) {
+	casos := map[string]error{
+		"Usuário ou senha inválidos":               ErrCredenciaisInvalidas,
+		"A etiqueta SZ00000001BR já foi utilizada": ErrEtiquetaUtilizada,
+		"PLP não encontrada":                       ErrPlpNaoEncontrada,
+		"CEP NAO ENCONTRADO":                       ErrCEPNaoEncontrado,
+		"CEP inválido":                             ErrCEPInvalido,
+		"Formato do CEP incorreto":                 ErrCEPInvalido,
+		"Erro interno":                             nil,
+	}
+	for mensagem, esperado := range casos {
+		if err := classificaFault(mensagem); err != esperado {
+			t.Errorf("classificaFault(%q) = %v, esperado %v", mensagem, err, esperado)
+		}
+	}
+}
+
+func TestCEPInvalidoNaoVaiParaOCache(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	srv.DefineFalha("consultaCEP", sigeptest.Falha{Mensagem: "CEP INVALIDO", Vezes: 1})
+	c := clienteCache(srv)
+
+	_, err := c.ConsultaCEP("7000290")
+	if !errors.Is(err, ErrCEPInvalido) || errors.Is(err, ErrCEPNaoEncontrado) {
+		t.Fatalf("ConsultaCEP = %v, esperado apenas ErrCEPInvalido", err)
+	}
+	if _, err := c.ConsultaCEP("7000290"); !errors.Is(err, ErrCEPNaoEncontrado) {
+		t.Errorf("segunda ConsultaCEP = %v, esperado nova consulta ao SIGEPWEB", err)
+	}
+	if n := srv.Chamadas("consultaCEP"); n != 2 {
+		t.Errorf("chamadas = %d, esperado 2", n)
+	}
+}
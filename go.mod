@@ -4,6 +4,7 @@ go 1.14
 
 require (
 	github.com/gomodule/redigo v1.8.1
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/pkg/errors v0.9.1
 	golang.org/x/text v0.3.2
 )
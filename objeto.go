@@ -1,16 +1,15 @@
 package plp
 
 import (
+	"context"
 	"fmt"
-	"regexp"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
-//Estados possíveis para os objetos postais
+//Estados possíveis para os objetos postais. As constantes não têm tipo para que possam ser
+//comparadas tanto com EstadoObjeto quanto com os campos int, como StatusTabela e ObjetoJSON.Status
 const (
 	EstadoObjetoEmAberto              = 0
 	EstadoObjetoPostado               = 1
@@ -23,7 +22,36 @@ const (
 
 //Relação de erros possíveis para os objetos postais
 var (
-	ErrObjetoPostado = errors.New("negocio: objeto ja foi postado")
+	ErrObjetoPostado           = errors.New("negocio: objeto ja foi postado")
+	ErrEtiquetaInvalida        = errors.New("negocio: formato de etiqueta inválido")
+	ErrDVEtiqueta              = errors.New("negocio: dígito verificador da etiqueta inválido")
+	ErrServicoInvalido         = errors.New("negocio: código de serviço inválido")
+	ErrPesoInvalido            = errors.New("negocio: peso inválido para o serviço")
+	ErrTipoObjetoInvalido      = errors.New("negocio: tipo de objeto inválido")
+	ErrAlturaInvalida          = errors.New("negocio: altura inválida para o tipo de objeto")
+	ErrLarguraInvalida         = errors.New("negocio: largura inválida para o tipo de objeto")
+	ErrComprimentoInvalido     = errors.New("negocio: comprimento inválido para o tipo de objeto")
+	ErrDiametroInvalido        = errors.New("negocio: diâmetro inválido para o tipo de objeto")
+	ErrSomaDimensoes           = errors.New("negocio: soma das dimensões excede o limite")
+	ErrNomeDestinatario        = errors.New("negocio: formato de nome de destinatário inválido")
+	ErrTelefoneDestinatario    = errors.New("negocio: formato de telefone de destinatário inválido")
+	ErrCelularDestinatario     = errors.New("negocio: formato de celular de destinatário inválido")
+	ErrEmailDestinatario       = errors.New("negocio: formato de email de destinatário inválido")
+	ErrLogradouroDestinatario  = errors.New("negocio: formato de logradouro de destinatário inválido")
+	ErrComplementoDestinatario = errors.New("negocio: formato de complemento de destinatário inválido")
+	ErrNumeroDestinatario      = errors.New("negocio: formato de número de destinatário inválido")
+	ErrCpfCnpjDestinatario     = errors.New("negocio: formato de CPF/CNPJ de destinatário inválido")
+	ErrBairroDestinatario      = errors.New("negocio: formato de bairro de destinatário inválido")
+	ErrCidadeDestinatario      = errors.New("negocio: formato de cidade de destinatário inválido")
+	ErrUfDestinatario          = errors.New("negocio: formato de UF de destinatário inválido")
+	ErrCepDestinatario         = errors.New("negocio: formato de CEP de destinatário inválido")
+	ErrNumeroNotaFiscal        = errors.New("negocio: formato de número de nota fiscal inválido")
+	ErrSerieNotaFiscal         = errors.New("negocio: formato de série de nota fiscal inválido")
+	ErrValorNotaFiscal         = errors.New("negocio: formato de valor de nota fiscal inválido")
+	ErrDescricaoObjeto         = errors.New("negocio: formato de descrição do objeto inválido")
+	ErrValorACobrar            = errors.New("negocio: formato de valor a cobrar inválido")
+	ErrServicoAdicional        = errors.New("negocio: código de serviço adicional inválido")
+	ErrValorDeclarado          = errors.New("negocio: formato de valor declarado inválido")
 )
 
 // CodigoServicoAdicional complemento da estrutura Objeto XML
@@ -113,16 +141,28 @@ type CodigoServicoAdicionalJSON struct {
 	CodigoServicoAdicional string `json:"codigo_servico_adicional"`
 }
 
+// ServicoAdicionalJSON elemento servico_adicional do objeto em formato JSON, com
+// o valor declarado e o endereço do vizinho
+type ServicoAdicionalJSON struct {
+	Codigos         []string `json:"codigos"`
+	ValorDeclarado  string   `json:"valor_declarado,omitempty"`
+	EnderecoVizinho string   `json:"endereco_vizinho,omitempty"`
+}
+
 // ObjetoJSON estrutura do objeto com JSON
 type ObjetoJSON struct {
-	Etiqueta      string           `json:"etiqueta"`
-	Mcu           string           `json:"mcu"`
-	DataCriacao   time.Time        `json:"data_criacao"`
-	Status        int              `json:"status"`
-	CodigoServico string           `json:"codigo_servico"`
-	Cubagem       string           `json:"cubagem"`
-	Peso          int              `json:"peso"`
-	Plp           PlpRemetenteJSON `json:"plp"`
+	Etiqueta            string           `json:"etiqueta"`
+	Mcu                 string           `json:"mcu"`
+	DataCriacao         time.Time        `json:"data_criacao"`
+	Status              int              `json:"status"`
+	CodigoObjetoCliente string           `json:"codigo_objeto_cliente"`
+	CodigoServico       string           `json:"codigo_servico"`
+	Cubagem             string           `json:"cubagem"`
+	Peso                int              `json:"peso"`
+	Rt1                 string           `json:"rt1"`
+	Rt2                 string           `json:"rt2"`
+	RestricaoANAC       string           `json:"restricao_anac"`
+	Plp                 PlpRemetenteJSON `json:"plp"`
 
 	Destinatario struct {
 		Nome                string `json:"nome"`
@@ -132,12 +172,13 @@ type ObjetoJSON struct {
 		Logradouro          string `json:"logradouro"`
 		Complemento         string `json:"complemento"`
 		Numero              string `json:"numero"`
+		CpfCnpj             string `json:"cpf_cnpj"`
 		Bairro              string `json:"bairro"`
 		Cidade              string `json:"cidade"`
 		UF                  string `json:"uf"`
 		Cep                 string `json:"cep"`
-		CodigoUsuarioPostal string `json:"-"`
-		CentroCustoCliente  string `json:"-"`
+		CodigoUsuarioPostal string `json:"codigo_usuario_postal"`
+		CentroCustoCliente  string `json:"centro_custo_cliente"`
 		NotaFiscal          string `json:"numero_nota_fiscal"`
 		SerieNotaFiscal     string `json:"serie_nota_fiscal"`
 		ValorNotaFiscal     string `json:"valor_nota_fiscal"`
@@ -146,7 +187,10 @@ type ObjetoJSON struct {
 		ValorACobrar        string `json:"valor_a_cobrar"`
 	} `json:"destinatario"`
 	ServicoAdicional []CodigoServicoAdicionalJSON `json:"servico_adicional"`
-	Dimensoes        struct {
+	// ServicosAdicionais elementos servico_adicional completos; quando ausentes,
+	// os códigos de ServicoAdicional formam um único elemento
+	ServicosAdicionais []ServicoAdicionalJSON `json:"servicos_adicionais,omitempty"`
+	Dimensoes          struct {
 		Tipo        string `json:"tipo"`
 		Altura      string `json:"altura"`
 		Largura     string `json:"largura"`
@@ -154,401 +198,233 @@ type ObjetoJSON struct {
 		Diametro    string `json:"diametro"`
 	} `json:"dimensoes"`
 	DataPostagem              string  `json:"data_postagem"`
+	StatusProcessamento       string  `json:"status_processamento"`
 	NumeroComprovantePostagem string  `json:"comprovante_postagem"`
 	ValorCobrado              float64 `json:"valor_cobrado"`
 }
 
-var (
-	erEtiqueta *regexp.Regexp
-	// ErrPLPNaoRascunho unidade do MCU informado não encontrada
-	ErrPLPNaoRascunho = errors.New("objeto plp não rascunho: a plp não permite mais alteração")
-)
-
-func init() {
-	erEtiqueta = regexp.MustCompile(`[A-Z]{2}[0-9]{8}[ ]*[A-Z]{2}`)
+// ToJSON converte o objeto da PLP p para a estrutura JSON, com todos os códigos
+// de serviço adicional em ServicoAdicional e um ServicoAdicionalJSON por elemento
+// servico_adicional em ServicosAdicionais. Com p nil, Mcu e Plp ficam vazios.
+func (o *Objeto) ToJSON(p *Plp) ObjetoJSON {
+	j := ObjetoJSON{
+		Etiqueta:                  o.NumeroEtiqueta,
+		DataCriacao:               o.Inclusao,
+		Status:                    o.StatusTabela,
+		CodigoObjetoCliente:       o.CodigoObjetoCliente,
+		CodigoServico:             o.CodigoServicoPostagem,
+		Cubagem:                   o.Cubagem,
+		Peso:                      o.Peso,
+		Rt1:                       o.Rt1,
+		Rt2:                       o.Rt2,
+		RestricaoANAC:             o.RestricaoANAC,
+		DataPostagem:              o.DataPostagemSara,
+		StatusProcessamento:       o.StatusProcessamento,
+		NumeroComprovantePostagem: o.NumeroComprovantePostagem,
+		ValorCobrado:              o.ValorCobrado,
+	}
+	if p != nil {
+		j.Mcu = p.Plp.McuUnidadePostagem
+		j.Plp = p.remetenteJSON()
+	}
+	d := &j.Destinatario
+	d.Nome = o.Destinatario.NomeDestinatario.CData
+	d.Telefone = o.Destinatario.TelefoneDestinatario.CData
+	d.Celular = o.Destinatario.CelularDestinatario.CData
+	d.Email = o.Destinatario.EmailDestinatario.CData
+	d.Logradouro = o.Destinatario.LogradouroDestinatario.CData
+	d.Complemento = o.Destinatario.ComplementoDestinatario.CData
+	d.Numero = o.Destinatario.NumeroEndDestinatario.CData
+	d.CpfCnpj = o.Destinatario.CpfCnpjDestinatario
+	d.Bairro = o.Nacional.BairroDestinatario.CData
+	d.Cidade = o.Nacional.CidadeDestinatario.CData
+	d.UF = o.Nacional.UfDestinatario
+	d.Cep = o.Nacional.CepDestinatario.CData
+	d.CodigoUsuarioPostal = o.Nacional.CodigoUsuarioPostal
+	d.CentroCustoCliente = o.Nacional.CentroCustoCliente
+	d.NotaFiscal = o.Nacional.NumeroNotaFiscal
+	d.SerieNotaFiscal = o.Nacional.SerieNotaFiscal
+	d.ValorNotaFiscal = o.Nacional.ValorNotaFiscal
+	d.NaturezaNotaFiscal = o.Nacional.NaturezaNotaFiscal
+	d.Descricao = o.Nacional.DescricaoObjeto.CData
+	d.ValorACobrar = o.Nacional.ValorACobrar
+	for _, sa := range o.ServicoAdicional {
+		for _, c := range sa.CodigoServicoAdicional {
+			j.ServicoAdicional = append(j.ServicoAdicional, CodigoServicoAdicionalJSON{CodigoServicoAdicional: c})
+		}
+		j.ServicosAdicionais = append(j.ServicosAdicionais, ServicoAdicionalJSON{
+			Codigos:         append([]string(nil), sa.CodigoServicoAdicional...),
+			ValorDeclarado:  sa.ValorDeclarado,
+			EnderecoVizinho: sa.EnderecoVizinho.CData,
+		})
+	}
+	j.Dimensoes.Tipo = o.Dimensoes.Tipo
+	j.Dimensoes.Altura = o.Dimensoes.Altura
+	j.Dimensoes.Largura = o.Dimensoes.Largura
+	j.Dimensoes.Comprimento = o.Dimensoes.Comprimento
+	j.Dimensoes.Diametro = o.Dimensoes.Diametro
+	return j
 }
 
-//TrocaServico efetua a troca do serviço dentro do XML da PLP conforme critérios da nova política comercial
-func (o *Objeto) TrocaServico(pacoteOrigem string, pacoteDestino string) error {
-	switch pacoteOrigem {
-	case "2.0":
-		switch pacoteDestino {
-		case "bronze":
-			switch o.CodigoServicoPostagem {
-			case "04537":
-				o.CodigoServicoPostagem = "03042"
-				break
-			case "04553":
-				o.CodigoServicoPostagem = "03050"
-				break
-			case "04596":
-				o.CodigoServicoPostagem = "03085"
-				break
-			case "04618":
-				o.CodigoServicoPostagem = "03107"
-				break
-			case "40215":
-				o.CodigoServicoPostagem = "04790"
-				break
-			case "40169":
-				o.CodigoServicoPostagem = "04782"
-				break
-			case "40290":
-				o.CodigoServicoPostagem = "04804"
-				break
-			}
-
-		case "prata", "ouro", "platinum", "diamante", "infinite":
-			switch o.CodigoServicoPostagem {
-			case "04537":
-				o.CodigoServicoPostagem = "03212"
-				break
-			case "04553":
-				o.CodigoServicoPostagem = "03220"
-				break
-			case "04596":
-				o.CodigoServicoPostagem = "03298"
-				break
-			case "04618":
-				o.CodigoServicoPostagem = "03328"
-				break
-			case "40215":
-				o.CodigoServicoPostagem = "03158"
-				break
-			case "40169":
-				o.CodigoServicoPostagem = "03140"
-				break
-			case "40290":
-				o.CodigoServicoPostagem = "03204"
-				break
-			}
+// ToObjeto converte a estrutura JSON para o objeto do XML, com um elemento
+// servico_adicional por ServicoAdicionalJSON ou, sem ServicosAdicionais, um único
+// elemento com os códigos de ServicoAdicional. Mcu e Plp pertencem à PLP e não
+// são copiados.
+func (j ObjetoJSON) ToObjeto() *Objeto {
+	o := &Objeto{
+		NumeroEtiqueta:            j.Etiqueta,
+		Inclusao:                  j.DataCriacao,
+		StatusTabela:              j.Status,
+		CodigoObjetoCliente:       j.CodigoObjetoCliente,
+		CodigoServicoPostagem:     j.CodigoServico,
+		Cubagem:                   j.Cubagem,
+		Peso:                      j.Peso,
+		Rt1:                       j.Rt1,
+		Rt2:                       j.Rt2,
+		RestricaoANAC:             j.RestricaoANAC,
+		DataPostagemSara:          j.DataPostagem,
+		StatusProcessamento:       j.StatusProcessamento,
+		NumeroComprovantePostagem: j.NumeroComprovantePostagem,
+		ValorCobrado:              j.ValorCobrado,
+	}
+	d := &j.Destinatario
+	o.Destinatario.NomeDestinatario.CData = d.Nome
+	o.Destinatario.TelefoneDestinatario.CData = d.Telefone
+	o.Destinatario.CelularDestinatario.CData = d.Celular
+	o.Destinatario.EmailDestinatario.CData = d.Email
+	o.Destinatario.LogradouroDestinatario.CData = d.Logradouro
+	o.Destinatario.ComplementoDestinatario.CData = d.Complemento
+	o.Destinatario.NumeroEndDestinatario.CData = d.Numero
+	o.Destinatario.CpfCnpjDestinatario = d.CpfCnpj
+	o.Nacional.BairroDestinatario.CData = d.Bairro
+	o.Nacional.CidadeDestinatario.CData = d.Cidade
+	o.Nacional.UfDestinatario = d.UF
+	o.Nacional.CepDestinatario.CData = d.Cep
+	o.Nacional.CodigoUsuarioPostal = d.CodigoUsuarioPostal
+	o.Nacional.CentroCustoCliente = d.CentroCustoCliente
+	o.Nacional.NumeroNotaFiscal = d.NotaFiscal
+	o.Nacional.SerieNotaFiscal = d.SerieNotaFiscal
+	o.Nacional.ValorNotaFiscal = d.ValorNotaFiscal
+	o.Nacional.NaturezaNotaFiscal = d.NaturezaNotaFiscal
+	o.Nacional.DescricaoObjeto.CData = d.Descricao
+	o.Nacional.ValorACobrar = d.ValorACobrar
+	if j.ServicosAdicionais == nil && len(j.ServicoAdicional) > 0 {
+		sa := CodigoServicoAdicional{}
+		for _, c := range j.ServicoAdicional {
+			sa.CodigoServicoAdicional = append(sa.CodigoServicoAdicional, c.CodigoServicoAdicional)
 		}
-	case "2.1", "2.2", "2.3", "2.4", "2.5", "2.6", "2.7", "2.8", "2.9":
-		switch pacoteDestino {
-		case "bronze":
-			switch o.CodigoServicoPostagem {
-			case "40169":
-				o.CodigoServicoPostagem = "04782"
-				break
-			case "40215":
-				o.CodigoServicoPostagem = "04790"
-				break
-			case "40290":
-				o.CodigoServicoPostagem = "04804"
-				break
-			case "04138":
-				o.CodigoServicoPostagem = "03042"
-				break
-			case "04162":
-				o.CodigoServicoPostagem = "03050"
-				break
-			case "04669":
-				o.CodigoServicoPostagem = "03085"
-				break
-			case "04693":
-				o.CodigoServicoPostagem = "03107"
-				break
-			}
-		case "prata", "ouro", "platinum", "diamante", "infinite":
-			switch o.CodigoServicoPostagem {
-			case "40169":
-				o.CodigoServicoPostagem = "03140"
-				break
-			case "40215":
-				o.CodigoServicoPostagem = "03158"
-				break
-			case "40290":
-				o.CodigoServicoPostagem = "03204"
-				break
-			case "04138":
-				o.CodigoServicoPostagem = "03212"
-				break
-			case "04162":
-				o.CodigoServicoPostagem = "03220"
-				break
-			case "04669":
-				o.CodigoServicoPostagem = "03298"
-				break
-			case "04693":
-				o.CodigoServicoPostagem = "03328"
-				break
-			}
+		o.ServicoAdicional = append(o.ServicoAdicional, sa)
+	}
+	for _, sj := range j.ServicosAdicionais {
+		sa := CodigoServicoAdicional{
+			CodigoServicoAdicional: append([]string(nil), sj.Codigos...),
+			ValorDeclarado:         sj.ValorDeclarado,
 		}
-	case "5.1", "5.2", "5.3", "5.4", "5.5", "5.6", "5.7":
-		switch pacoteDestino {
-		case "bronze":
-			switch o.CodigoServicoPostagem {
-			case "40169":
-				o.CodigoServicoPostagem = "04782"
-				break
-			case "40215":
-				o.CodigoServicoPostagem = "04790"
-				break
-			case "40290":
-				o.CodigoServicoPostagem = "04804"
-				break
-			case "04138":
-				o.CodigoServicoPostagem = "03042"
-				break
-			case "04162":
-				o.CodigoServicoPostagem = "03050"
-				break
-			case "04669":
-				o.CodigoServicoPostagem = "03085"
-				break
-			case "04693":
-				o.CodigoServicoPostagem = "03107"
-				break
-			case "04316":
-				o.CodigoServicoPostagem = "03050"
-				break
-			case "04812":
-				o.CodigoServicoPostagem = "03085"
-				break
-			}
-		case "prata", "ouro", "platinum":
-			switch o.CodigoServicoPostagem {
-			case "40169":
-				o.CodigoServicoPostagem = "03140"
-				break
-			case "40215":
-				o.CodigoServicoPostagem = "03158"
-				break
-			case "40290":
-				o.CodigoServicoPostagem = "03204"
-				break
-			case "04138":
-				o.CodigoServicoPostagem = "03212"
-				break
-			case "04162":
-				o.CodigoServicoPostagem = "03220"
-				break
-			case "04669":
-				o.CodigoServicoPostagem = "03298"
-				break
-			case "04693":
-				o.CodigoServicoPostagem = "03328"
-				break
-			case "04316":
-				o.CodigoServicoPostagem = "03220"
-				break
-			case "04812":
-				o.CodigoServicoPostagem = "03298"
-				break
-			}
-		case "diamante", "infinite":
-			switch o.CodigoServicoPostagem {
-			case "40169":
-				o.CodigoServicoPostagem = "03140"
-				break
-			case "40215":
-				o.CodigoServicoPostagem = "03158"
-				break
-			case "40290":
-				o.CodigoServicoPostagem = "03204"
-				break
-			case "04138":
-				o.CodigoServicoPostagem = "03212"
-				break
-			case "04162":
-				o.CodigoServicoPostagem = "03220"
-				break
-			case "04669":
-				o.CodigoServicoPostagem = "03298"
-				break
-			case "04693":
-				o.CodigoServicoPostagem = "03328"
-				break
-			case "04316":
-				o.CodigoServicoPostagem = "03280"
-				break
-			case "04812":
-				o.CodigoServicoPostagem = "03336"
-				break
-			}
+		sa.EnderecoVizinho.CData = sj.EnderecoVizinho
+		o.ServicoAdicional = append(o.ServicoAdicional, sa)
+	}
+	o.Dimensoes.Tipo = j.Dimensoes.Tipo
+	o.Dimensoes.Altura = j.Dimensoes.Altura
+	o.Dimensoes.Largura = j.Dimensoes.Largura
+	o.Dimensoes.Comprimento = j.Dimensoes.Comprimento
+	o.Dimensoes.Diametro = j.Dimensoes.Diametro
+	return o
+}
 
-		}
-	case "bronze":
-		switch o.CodigoServicoPostagem {
-		case "04782":
-			o.CodigoServicoPostagem = "03140"
-			break
-		case "04790":
-			o.CodigoServicoPostagem = "03158"
-			break
-		case "04804":
-			o.CodigoServicoPostagem = "03204"
-			break
-		case "03042":
-			o.CodigoServicoPostagem = "03212"
-			break
-		case "03052":
-			o.CodigoServicoPostagem = "03220"
-			break
-		case "03085":
-			o.CodigoServicoPostagem = "03298"
-			break
-		case "03107":
-			o.CodigoServicoPostagem = "03328"
-			break
-		}
-	case "diamante", "infinite":
-		switch o.CodigoServicoPostagem {
-		case "03140":
-			o.CodigoServicoPostagem = "04782"
-			break
-		case "03158":
-			o.CodigoServicoPostagem = "04790"
-			break
-		case "03204":
-			o.CodigoServicoPostagem = "04804"
-			break
-		case "03212":
-			o.CodigoServicoPostagem = "03042"
-			break
-		case "03220":
-			o.CodigoServicoPostagem = "03050"
-			break
-		case "03298":
-			o.CodigoServicoPostagem = "03085"
-			break
-		case "03328":
-			o.CodigoServicoPostagem = "03107"
-			break
-		case "03282":
-			o.CodigoServicoPostagem = "03050"
-			break
-		case "03336":
-			o.CodigoServicoPostagem = "03085"
-			break
-		}
+// ObjetosToJSON converte os objetos da PLP p para a estrutura JSON
+func ObjetosToJSON(objetos []*Objeto, p *Plp) []ObjetoJSON {
+	js := make([]ObjetoJSON, 0, len(objetos))
+	for _, o := range objetos {
+		js = append(js, o.ToJSON(p))
 	}
-	return nil
+	return js
 }
 
-func (o *ObjetoJSON) isPostado() bool {
-	var status int
-	qry := `select OBJ_IN_STATUS from NEP_OBJETO_POSTAL where obj_nu_etiqueta = :plpnu`
-	if err := db.QueryRow(qry, o.Etiqueta).Scan(&status); err != nil {
-		return false
+// ObjetosFromJSON converte as estruturas JSON para os objetos do XML
+func ObjetosFromJSON(js []ObjetoJSON) []*Objeto {
+	objetos := make([]*Objeto, 0, len(js))
+	for _, j := range js {
+		objetos = append(objetos, j.ToObjeto())
 	}
-	return status == EstadoObjetoPostado
+	return objetos
 }
 
-//Valida os objetos postais
-func (o *ObjetoJSON) Valida() error {
-	if o.isPostado() {
-		return ErrObjetoPostado
+var (
+	// ErrPLPNaoRascunho unidade do MCU informado não encontrada
+	ErrPLPNaoRascunho = errors.New("objeto plp não rascunho: a plp não permite mais alteração")
+)
+
+//TrocaServico efetua a troca do serviço dentro do XML da PLP conforme critérios da nova política comercial,
+//usando a tabela definida em DefineTabelaServicos. Devolve ErrTrocaServicoSemRegra ou ErrTrocaServicoSemMapeamento
+//quando a tabela não prevê a troca. Veja ExplicaTrocaServico.
+func (o *Objeto) TrocaServico(pacoteOrigem string, pacoteDestino string) error {
+	res, err := o.ExplicaTrocaServico(pacoteOrigem, pacoteDestino)
+	if err != nil {
+		return err
 	}
+	o.CodigoServicoPostagem = res.ServicoNovo
 	return nil
 }
 
-// Insere objeto na estrutura xml
-/*
-func (o *Objeto) Insere(tx *sql.Tx) error {
-	var (
-		temTx bool
-		err   error
-	)
-	if tx != nil {
-		temTx = true
+// estadoCadastrado estado do objeto da etiqueta no repositório, e falso se não cadastrado
+func (o *ObjetoJSON) estadoCadastrado() (EstadoObjeto, bool, error) {
+	repo, err := repositorio()
+	if err != nil {
+		return 0, false, err
+	}
+	var e EstadoObjeto
+	if b, ok := repo.(buscadorEstado); ok {
+		e, err = b.BuscaEstadoObjeto(context.Background(), o.Etiqueta)
 	} else {
-		tx, err = db.Begin()
-		if err != nil {
-			return err
+		var obj *Objeto
+		if obj, err = repo.BuscaObjeto(context.Background(), o.Etiqueta); err == nil {
+			e = obj.Estado()
 		}
 	}
-	query := `
-		INSERT INTO NEP_OBJETO_POSTAL
-		(OBJ_NU_ETIQUETA, PLP_NU, OBJ_DT_INCLUSAO)
-		VALUES
-		(:etiqueta, :numero, to_date(:inclusao,'ddmmyyyyhh24miss'))
-	`
-	etiqueta := o.NumeroEtiqueta
-	if len(etiqueta) == 13 {
-		etiqueta = etiqueta[:10] + etiqueta[11:]
+	if errors.Is(err, ErrObjetoNaoEncontrado) {
+		return 0, false, nil
 	}
-	_, err = tx.Exec(query, etiqueta, o.PlpNu, toDate(o.Inclusao))
-	if err != nil {
+	return e, err == nil, err
+}
+
+//Valida os objetos postais, consultando o repositório definido por IniDb ou DefineRepositorio.
+//Um objeto já cadastrado só é válido se a máquina de estados permitir postá-lo; os
+//cancelados devolvem *ErroTransicao e os demais ErrObjetoPostado.
+func (o *ObjetoJSON) Valida() error {
+	e, cadastrado, err := o.estadoCadastrado()
+	if err != nil || !cadastrado {
 		return err
 	}
-	if !temTx {
-		return tx.Commit()
+	switch {
+	case e.PodeMudarPara(EstadoObjetoPostado):
+		return nil
+	case e == EstadoObjetoCancelado:
+		return &ErroTransicao{Etiqueta: o.Etiqueta, De: e, Para: EstadoObjetoPostado, Err: ErrTransicaoInvalida}
 	}
-	return nil
+	return ErrObjetoPostado
 }
-*/
-// EtiquetaDV func para criar o dígito verificados
+
+// EtiquetaDV func para criar o dígito verificados. Aceita a etiqueta nos formatos
+// de ParseEtiqueta; quando já informado, o dígito verificador é mantido sem
+// conferência, como nas PLPs gravadas. Para conferi-lo, use ParseEtiqueta.
 func EtiquetaDV(numero string) (string, error) {
-	numEti := strings.Replace(numero, " ", "", -1)
-	if len(numEti) == 13 {
-		return numEti, nil
-	}
-	if !erEtiqueta.MatchString(numEti) {
-		return "", errors.New(fmt.Sprintf("etiqueta %s inválida", numEti))
-	}
-	numeros := numEti[2:10]
-	multiplicadores := [...]int{8, 6, 4, 2, 3, 5, 9, 7}
-	soma := 0
-	for i := 0; i < 8; i++ {
-		numero, err := strconv.Atoi(numeros[i : i+1])
-		if err != nil {
-			return "", errors.New(fmt.Sprintf("etiqueta %s inválida", numEti))
-		}
-		soma += numero * multiplicadores[i]
+	e, err := ParseEtiqueta(numero)
+	if errors.Is(err, ErrDVEtiqueta) {
+		return normalizaEtiqueta(numero), nil
 	}
-	resto := soma % 11
-	var dv string
-	switch resto {
-	case 0:
-		dv = "5"
-	case 1:
-		dv = "0"
-	default:
-		dv = strconv.Itoa(11 - resto)
+	if err != nil {
+		return "", err
 	}
-	return fmt.Sprintf("%v%v%v", numEti[:10], dv, numEti[10:]), nil
+	return e.String(), nil
 }
 
 //IntervaloEtiquetas recebe uma string com um intervalo de etiquetas no formato "SZ46641024 BR,SZ46642023 BR"
 //proveniente do método solicitaEtiquetas do SIGEP Master e devolve um slice com as etiquetas correspondentes
-//com o dígito verificador
+//com o dígito verificador. Para percorrer a faixa sem montar o slice, veja ParseFaixaEtiquetas.
 func IntervaloEtiquetas(intervalo string) ([]string, error) {
-	partes := strings.Split(intervalo, ",")
-	ini, fim := partes[0], partes[1]
-	if !erEtiqueta.MatchString(ini) {
-		return nil, errors.New(fmt.Sprintf("intervaloetiquetas: etiqueta %s inválida", ini))
-	}
-	if !erEtiqueta.MatchString(fim) {
-		return nil, errors.New(fmt.Sprintf("intervaloetiquetas: etiqueta %s inválida", fim))
-	}
-	ini = strings.Replace(ini, " ", "", 1)
-	fim = strings.Replace(fim, " ", "", 1)
-	preIni := ini[0:2]
-	sufIni := ini[len(ini)-2:]
-	numIni := ini[2 : len(ini)-2]
-	preFim := fim[0:2]
-	sufFim := fim[len(fim)-2:]
-	numFim := fim[2 : len(fim)-2]
-	if preIni != preFim {
-		return nil, errors.New(fmt.Sprintf("intervaloetiquetas: prefixos inicial e final não coincidem"))
-	}
-	if sufIni != sufFim {
-		return nil, errors.New(fmt.Sprintf("intervaloetiquetas: sufixos inicial e final não coincidem"))
-	}
-	i, _ := strconv.Atoi(numIni)
-	f, _ := strconv.Atoi(numFim)
-	if f < i {
-		return nil, errors.New(fmt.Sprintf("intervaloetiquetas: inicial deve ser menor que final"))
-	}
-	etiquetas := make([]string, 0, f-i+1)
-	for i <= f {
-		e, err := EtiquetaDV(fmt.Sprintf("%v%v%v", preIni, i, sufIni))
-		if err != nil {
-			return nil, errors.New(fmt.Sprintf("intervaloetiquetas: %s", err))
-		}
-		etiquetas = append(etiquetas, e)
-		i++
+	f, err := ParseFaixaEtiquetas(intervalo)
+	if err != nil {
+		return nil, fmt.Errorf("intervaloetiquetas: %w", err)
 	}
-	return etiquetas, nil
+	return f.Etiquetas(), nil
 }
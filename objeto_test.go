@@ -0,0 +1,101 @@
+package plp
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// preenche atribui a cada campo de v um valor distinto e diferente de zero, com
+// dois elementos em cada slice, para que um campo esquecido em uma conversão
+// volte zerado
+func preenche(v reflect.Value, n *int) {
+	*n++
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("v" + strconv.Itoa(*n))
+	case reflect.Int, reflect.Int64:
+		v.SetInt(int64(*n))
+	case reflect.Float64:
+		v.SetFloat(float64(*n) + 0.5)
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		preenche(v.Elem(), n)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+		for i := 0; i < v.Len(); i++ {
+			preenche(v.Index(i), n)
+		}
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Date(2020, 1, 1, 0, 0, *n, 0, time.UTC)))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" && v.Type().Field(i).Name != "XMLName" {
+				preenche(v.Field(i), n)
+			}
+		}
+	}
+}
+
+func TestObjetoJSONIdaEVolta(t *testing.T) {
+	var o Objeto
+	preenche(reflect.ValueOf(&o).Elem(), new(int))
+
+	b, err := json.Marshal(o.ToJSON(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var j ObjetoJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		t.Fatal(err)
+	}
+	if volta := j.ToObjeto(); !reflect.DeepEqual(&o, volta) {
+		t.Errorf("ToJSON/ToObjeto perdeu campos:\nantes  %+v\ndepois %+v", o, *volta)
+	}
+}
+
+func TestObjetoJSONServicosAdicionais(t *testing.T) {
+	p := lePlpTeste(t, "plp_iso88591.xml")
+	j := p.Objetos[0].ToJSON(&p)
+	codigos := []CodigoServicoAdicionalJSON{{"025"}, {"001"}, {"019"}}
+	if !reflect.DeepEqual(j.ServicoAdicional, codigos) {
+		t.Errorf("servico_adicional = %+v, esperado %+v", j.ServicoAdicional, codigos)
+	}
+	esperado := []ServicoAdicionalJSON{
+		{Codigos: []string{"025", "001"}, ValorDeclarado: "150,00"},
+		{Codigos: []string{"019"}, EnderecoVizinho: "Casa ao lado, nº 14"},
+	}
+	if !reflect.DeepEqual(j.ServicosAdicionais, esperado) {
+		t.Errorf("servicos_adicionais = %+v, esperado %+v", j.ServicosAdicionais, esperado)
+	}
+}
+
+func TestObjetoJSONFormatoAnterior(t *testing.T) {
+	// como gerado antes de servicos_adicionais
+	doc := `{"etiqueta": "SZ000000014BR", "mcu": "", "servico_adicional": [` +
+		`{"codigo_servico_adicional": "025"}, {"codigo_servico_adicional": "019"}]}`
+	var j ObjetoJSON
+	if err := json.Unmarshal([]byte(doc), &j); err != nil {
+		t.Fatal(err)
+	}
+	o := j.ToObjeto()
+	if len(o.ServicoAdicional) != 1 || !reflect.DeepEqual(o.ServicoAdicional[0].CodigoServicoAdicional, []string{"025", "019"}) {
+		t.Errorf("servico_adicional = %+v, esperado um elemento com 025 e 019", o.ServicoAdicional)
+	}
+
+	var campos map[string]json.RawMessage
+	b, err := json.Marshal(o.ToJSON(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &campos); err != nil {
+		t.Fatal(err)
+	}
+	if string(campos["mcu"]) != `""` || string(campos["servico_adicional"]) != `[{"codigo_servico_adicional":"025"},{"codigo_servico_adicional":"019"}]` {
+		t.Errorf("mcu = %s, servico_adicional = %s", campos["mcu"], campos["servico_adicional"])
+	}
+}
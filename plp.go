@@ -1,15 +1,12 @@
 package plp
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
-	"fmt"
 	"io/ioutil"
-	"net/http"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
@@ -50,21 +47,31 @@ var (
 	erEmail                 *regexp.Regexp
 	ErrEmailRemetente       = errors.New("negocio: formato de email do remetente inválido")
 	ErrCelularRemetente     = errors.New("negocio: formato de celular de remetente inválido")
+	ErrFaxRemetente         = errors.New("negocio: formato de fax de remetente inválido")
+	erCpfCnpj               *regexp.Regexp
+	ErrCpfCnpjRemetente     = errors.New("negocio: formato de CPF/CNPJ de remetente inválido")
+	erContrato              *regexp.Regexp
+	ErrTipoArquivo          = errors.New("negocio: tipo de arquivo inválido")
+	ErrVersaoArquivo        = errors.New("negocio: versão de arquivo inválida")
+	ErrPlpSemObjetos        = errors.New("negocio: PLP sem objetos postais")
 	Wsdl                    string
 	User                    string
 	Pass                    string
-	RegexEtiqueta           *regexp.Regexp
+	// Deprecated: use ParseEtiqueta
+	RegexEtiqueta *regexp.Regexp
 )
 
 func init() {
 	erCartao = regexp.MustCompile(`^[0-9]{10}$`)
+	erContrato = regexp.MustCompile(`^[0-9]{10}$`)
 	erDr = regexp.MustCompile(`^[0-9]{2}$`)
 	erCodAdm = regexp.MustCompile(`^[0-9]{8}$`)
 	erCep = regexp.MustCompile(`^[0-9]{8}$`)
 	erUf = regexp.MustCompile(`^[a-zA-Z]{2}$`)
 	erTelefone = regexp.MustCompile(`^[0-9]*$`)
+	erCpfCnpj = regexp.MustCompile(`^([0-9]{11}|[0-9]{14})$`)
 	erEmail = regexp.MustCompile(`^[a-zA-Z0-9.!#$%&’*+/=?^_{|}~-]+@[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*$`)
-	RegexEtiqueta = regexp.MustCompile(`^[A-Z]{2}[1-9]{9}[A-Z]{2}$`)
+	RegexEtiqueta = regexp.MustCompile(`^[A-Z]{2}[0-9]{9}[A-Z]{2}$`)
 }
 
 // Plp estrutura da PLP
@@ -153,15 +160,128 @@ type PlpRemetenteJSON struct {
 			Email       string `json:"email"`
 			Celular     string `json:"celular"`
 		} `json:"endereco"`
+		CpfCnpj                 string `json:"cpf_cnpj"`
+		CienciaConteudoProibido string `json:"ciencia_conteudo_proibido"`
 	} `json:"remetente"`
 }
 
-// UnmarshalJSON converte a estrutura
+// PlpJSON representação completa da PLP em formato JSON, com os objetos postais.
+// Os campos de PlpRemetenteJSON ficam no primeiro nível do documento; no JSON
+// gerado por MarshalJSON eles não são repetidos nos objetos.
+type PlpJSON struct {
+	PlpRemetenteJSON
+	ID                  int          `json:"id"`
+	Status              int          `json:"status"`
+	NumeroCliente       int          `json:"numero_cliente"`
+	TipoArquivo         string       `json:"tipo_arquivo"`
+	VersaoArquivo       string       `json:"versao_arquivo"`
+	ValorGlobal         float64      `json:"valor_global"`
+	Mcu                 string       `json:"mcu"`
+	NomeUnidadePostagem string       `json:"nome_unidade_postagem"`
+	FormaPagamento      string       `json:"forma_pagamento"`
+	Postagem            time.Time    `json:"postagem"`
+	PostagemSara        time.Time    `json:"postagem_sara"`
+	Fechamento          time.Time    `json:"fechamento"`
+	AtualizacaoCliente  time.Time    `json:"atualizacao_cliente"`
+	Objetos             []ObjetoJSON `json:"objetos"`
+}
+
+// objetoPlpJSON objeto de PlpJSON sem o elemento plp, que já está no primeiro nível
+type objetoPlpJSON struct {
+	ObjetoJSON
+	Plp *struct{} `json:"plp,omitempty"`
+}
+
+// MarshalJSON converte a PLP para PlpJSON
+func (p Plp) MarshalJSON() ([]byte, error) {
+	wrap := struct {
+		PlpJSON
+		Objetos []objetoPlpJSON `json:"objetos"`
+	}{PlpJSON: p.plpJSON()}
+	if p.Objetos != nil {
+		wrap.Objetos = make([]objetoPlpJSON, 0, len(p.Objetos))
+		for _, o := range p.Objetos {
+			wrap.Objetos = append(wrap.Objetos, objetoPlpJSON{ObjetoJSON: o.ToJSON(nil)})
+		}
+	}
+	return json.Marshal(wrap)
+}
+
+// UnmarshalJSON converte a estrutura. Aceita tanto PlpJSON quanto o formato
+// resumido PlpRemetenteJSON. Os campos ausentes em b mantêm o valor atual de p;
+// os objetos só são substituídos quando b traz a lista objetos.
 func (p *Plp) UnmarshalJSON(b []byte) error {
-	var wrap PlpRemetenteJSON
+	wrap := p.plpJSON()
 	if err := json.Unmarshal(b, &wrap); err != nil {
 		return err
 	}
+	p.ID = wrap.ID
+	p.Status = wrap.Status
+	p.NumeroCliente = wrap.NumeroCliente
+	p.TipoArquivo = wrap.TipoArquivo
+	p.VersaoArquivo = wrap.VersaoArquivo
+	p.Plp.ValorGlobal = wrap.ValorGlobal
+	p.Plp.McuUnidadePostagem = wrap.Mcu
+	p.Plp.NmeUnidadePostagem = wrap.NomeUnidadePostagem
+	p.FormaPagamento = wrap.FormaPagamento
+	p.Postagem = wrap.Postagem
+	p.PostagemSara = wrap.PostagemSara
+	p.Fechamento = wrap.Fechamento
+	p.AtualizacaoCliente = wrap.AtualizacaoCliente
+	p.defineRemetente(wrap.PlpRemetenteJSON)
+	if wrap.Objetos != nil {
+		p.Objetos = ObjetosFromJSON(wrap.Objetos)
+	}
+	return nil
+}
+
+// plpJSON campos da PLP no formato PlpJSON, sem os objetos
+func (p *Plp) plpJSON() PlpJSON {
+	return PlpJSON{
+		PlpRemetenteJSON:    p.remetenteJSON(),
+		ID:                  p.ID,
+		Status:              p.Status,
+		NumeroCliente:       p.NumeroCliente,
+		TipoArquivo:         p.TipoArquivo,
+		VersaoArquivo:       p.VersaoArquivo,
+		ValorGlobal:         p.Plp.ValorGlobal,
+		Mcu:                 p.Plp.McuUnidadePostagem,
+		NomeUnidadePostagem: p.Plp.NmeUnidadePostagem,
+		FormaPagamento:      p.FormaPagamento,
+		Postagem:            p.Postagem,
+		PostagemSara:        p.PostagemSara,
+		Fechamento:          p.Fechamento,
+		AtualizacaoCliente:  p.AtualizacaoCliente,
+	}
+}
+
+// remetenteJSON número, cartão e remetente da PLP no formato PlpRemetenteJSON
+func (p *Plp) remetenteJSON() PlpRemetenteJSON {
+	var wrap PlpRemetenteJSON
+	wrap.IDPlp = p.Plp.IDPlp
+	wrap.CartaoPostagem = p.Plp.CartaoPostagem
+	wrap.Remetente.Contrato = p.Remetente.NumeroContrato
+	wrap.Remetente.Diretoria = p.Remetente.NumeroDiretoria
+	wrap.Remetente.CodigoAdministrativo = p.Remetente.CodigoAdministrativo
+	wrap.Remetente.Nome = p.Remetente.NomeRemetente.CData
+	wrap.Remetente.Endereco.Logradouro = p.Remetente.LogradouroRemetente.CData
+	wrap.Remetente.Endereco.Numero = p.Remetente.NumeroRemetente.CData
+	wrap.Remetente.Endereco.Complemento = p.Remetente.ComplementoRemetente.CData
+	wrap.Remetente.Endereco.Bairro = p.Remetente.BairroRemetente.CData
+	wrap.Remetente.Endereco.Cep = p.Remetente.CepRemetente.CData
+	wrap.Remetente.Endereco.Cidade = p.Remetente.CidadeRemetente.CData
+	wrap.Remetente.Endereco.UF = p.Remetente.UfRemetente
+	wrap.Remetente.Endereco.Telefone = p.Remetente.TelefoneRemetente.CData
+	wrap.Remetente.Endereco.Fax = p.Remetente.FaxRemetente.CData
+	wrap.Remetente.Endereco.Email = p.Remetente.EmailRemetente.CData
+	wrap.Remetente.Endereco.Celular = p.Remetente.CelularRemetente.CData
+	wrap.Remetente.CpfCnpj = p.Remetente.CpfCnpjRemetente
+	wrap.Remetente.CienciaConteudoProibido = p.Remetente.CienciaConteudoProibido
+	return wrap
+}
+
+// defineRemetente preenche número, cartão e remetente da PLP a partir de wrap
+func (p *Plp) defineRemetente(wrap PlpRemetenteJSON) {
 	p.Plp.IDPlp = wrap.IDPlp
 	p.Plp.CartaoPostagem = wrap.CartaoPostagem
 	p.Remetente.NumeroContrato = wrap.Remetente.Contrato
@@ -179,114 +299,15 @@ func (p *Plp) UnmarshalJSON(b []byte) error {
 	p.Remetente.FaxRemetente.CData = wrap.Remetente.Endereco.Fax
 	p.Remetente.EmailRemetente.CData = wrap.Remetente.Endereco.Email
 	p.Remetente.CelularRemetente.CData = wrap.Remetente.Endereco.Celular
-	return nil
-}
-
-// XML monta o xml da PLP
-func (p *Plp) XML() (string, error) {
-	replacer := strings.NewReplacer(
-		"<id_plp>0</id_plp>",
-		"<id_plp/>",
-		"<valor_global>0</valor_global>",
-		"<valor_global/>",
-		"<mcu_unidade_postagem></mcu_unidade_postagem>",
-		"<mcu_unidade_postagem/>",
-		"<nome_unidade_postagem></nome_unidade_postagem>",
-		"<nome_unidade_postagem/>",
-		"<codigo_objeto_cliente></codigo_objeto_cliente>",
-		"<codigo_objeto_cliente/>",
-		"<rt1></rt1>",
-		"<rt1/>",
-		"<rt2></rt2>",
-		"<rt2/>",
-		"<serie_nota_fiscal></serie_nota_fiscal>",
-		"<serie_nota_fiscal/>",
-		"<valor_nota_fiscal></valor_nota_fiscal>",
-		"<valor_nota_fiscal/>",
-		"<valor_nota_fiscal></valor_nota_fiscal>",
-		"<valor_nota_fiscal/>",
-		"<numero_comprovante_postagem></numero_comprovante_postagem>",
-		"<numero_comprovante_postagem/>",
-		"<forma_pagamento></forma_pagamento>",
-		"<forma_pagamento/>",
-		"<valor_cobrado>0</valor_cobrado>",
-		"<valor_cobrado/>",
-		"<complemento_remetente></complemento_remetente>",
-		"<complemento_remetente><![CDATA[]]></complemento_remetente>",
-		"<celular_remetente></celular_remetente>",
-		"<celular_remetente><![CDATA[]]></celular_remetente>",
-		"<complemento_destinatario></complemento_destinatario>",
-		"<complemento_destinatario><![CDATA[]]></complemento_destinatario>",
-		"<celular_destinatario></celular_destinatario>",
-		"<celular_destinatario><![CDATA[]]></celular_destinatario>",
-		"<codigo_usuario_postal></codigo_usuario_postal>",
-		"<codigo_usuario_postal/>",
-		"<centro_custo_cliente></centro_custo_cliente>",
-		"<centro_custo_cliente/>",
-		"<natureza_nota_fiscal></natureza_nota_fiscal>",
-		"<natureza_nota_fiscal/>",
-		"<descricao_objeto></descricao_objeto>",
-		"<descricao_objeto><![CDATA[]]></descricao_objeto>",
-		"<data_postagem_sara></data_postagem_sara>",
-		"<data_postagem_sara/>",
-		"<cpf_cnpj_remetente></cpf_cnpj_remetente>",
-		"<cpf_cnpj_remetente/>",
-		"<ciencia_conteudo_proibido></ciencia_conteudo_proibido>",
-		"<ciencia_conteudo_proibido/>",
-		"<restricao_anac></restricao_anac>",
-		"<restricao_anac/>",
-		"<valor_declarado></valor_declarado>", "",
-		"<endereco_vizinho><![CDATA[]]></endereco_vizinho>", "",
-		"<endereco_vizinho></endereco_vizinho>", "",
-		"<cpf_cnpj_destinatario></cpf_cnpj_destinatario>",
-		"<cpf_cnpj_destinatario/>",
-	)
-	b, err := xml.Marshal(p)
-	if err != nil {
-		return "", fmt.Errorf("plp xml 1: %s", err)
-	}
-	doc := string(b)
-	doc = `<?xml version="1.0" encoding="ISO-8859-1" ?>` + doc
-	doc = replacer.Replace(doc)
-	b = []byte(doc)
-	return string(b), nil
+	p.Remetente.CpfCnpjRemetente = wrap.Remetente.CpfCnpj
+	p.Remetente.CienciaConteudoProibido = wrap.Remetente.CienciaConteudoProibido
 }
 
-//NewPlp cria uma PLP com base nos bytes do XML.
+//NewPlp cria uma PLP com base nos bytes do XML. Como o texto devolvido por
+//SolicitaPLP declara ISO-8859-1 mas já está em UTF-8, documentos em UTF-8 válido
+//são lidos sem conversão qualquer que seja a codificação declarada. Veja ReadPlp.
 func NewPlp(b []byte) (Plp, error) {
-	var err error
-	doc := string(b)
-	doc = strings.Replace(doc, `<?xml version="1.0" encoding="ISO-8859-1" standalone="yes"?>`, "", 1)
-	doc = strings.Replace(doc, `<?xml version="1.0" encoding="ISO-8859-1" ?>`, "", 1)
-	doc = strings.Replace(doc, `<?xml version="1.0" encoding="ISO-8859-1"?>`, "", 1)
-	doc = strings.Replace(doc, `<?xml version='1.0' encoding='ISO-8859-1'?>`, "", 1)
-	doc = strings.Replace(doc, `<?xml version='1.0' encoding='ISO-8859-1' ?>`, "", 1)
-	doc = strings.Replace(doc, `<?xml version="1.0" encoding="iso-8859-1" ?>`, "", 1)
-	doc = strings.Replace(doc, `<?xml version="1.0" encoding="iso-8859-1"?>`, "", 1)
-	doc = strings.Replace(doc, `<?xml version='1.0' encoding='iso-8859-1'?>`, "", 1)
-	doc = strings.Replace(doc, `<?xml version='1.0' encoding='iso-8859-1' ?>`, "", 1)
-
-	doc = strings.Replace(doc, `<?xml version="1.0" encoding="UTF-8"?>`, "", 1)
-	plp := Plp{}
-	err = xml.Unmarshal([]byte(doc), &plp)
-	if plp.Plp.IDPlp != 0 {
-		//return Plp{}, ErrPlpNaoVazia
-	}
-	plp.Remetente.NomeRemetente.CData = strings.TrimSpace(plp.Remetente.NomeRemetente.CData)
-	plp.Remetente.LogradouroRemetente.CData = strings.TrimSpace(plp.Remetente.LogradouroRemetente.CData)
-	plp.Remetente.NumeroRemetente.CData = strings.TrimSpace(plp.Remetente.NumeroRemetente.CData)
-	plp.Remetente.BairroRemetente.CData = strings.TrimSpace(plp.Remetente.BairroRemetente.CData)
-	plp.Remetente.CepRemetente.CData = strings.TrimSpace(plp.Remetente.CepRemetente.CData)
-	plp.Remetente.CidadeRemetente.CData = strings.TrimSpace(plp.Remetente.CidadeRemetente.CData)
-	plp.Remetente.TelefoneRemetente.CData = strings.TrimSpace(plp.Remetente.TelefoneRemetente.CData)
-	for _, o := range plp.Objetos {
-		etiqueta, err := EtiquetaDV(o.NumeroEtiqueta)
-		if err != nil {
-			return Plp{}, fmt.Errorf("plp newplp 1: %s", err)
-		}
-		o.NumeroEtiqueta = etiqueta
-	}
-	return plp, err
+	return lePlp(b, true)
 }
 
 //IsoUtf8 converte de ISO para UTF-8
@@ -295,397 +316,89 @@ func IsoUtf8(b []byte) ([]byte, error) {
 	return ioutil.ReadAll(r)
 }
 
-//estrutura para tratar requests que tiverem erro
-type fault struct {
-	XMLName xml.Name `xml:"Envelope"`
-	Body    struct {
-		XMLName xml.Name
-		Fault   struct {
-			FaultCode   string `xml:"faultcode"`
-			FaultString string `xml:"faultstring"`
-		} `xml:"Fault"`
-	} `xml:"Body"`
-}
-
-//estrutura para conter o retorno do método cancelarObjeto
-type cancelarObjetoResponse struct {
-	XMLName xml.Name `xml:"Envelope"`
-	Body    struct {
-		CancelarObjetoResponse struct {
-			Retorno bool `xml:"return"`
-		} `xml:"cancelarObjetoResponse"`
-	} `xml:"Body"`
-}
+// httpLegado cliente HTTP compartilhado pelas funções do pacote que usam as
+// variáveis Wsdl, User e Pass, evitando alterar o http.DefaultClient
+var httpLegado = (&Client{}).httpClient()
 
-//estrutura para conter o retorno do método geraDigitoVeiricadorEtiquetas
-type solicitaEtiquetasResponse struct {
-	XMLName xml.Name `xml:"Envelope"`
-	Body    struct {
-		XMLName                   xml.Name
-		SolicitaEtiquetasResponse struct {
-			FaixaEtiquetas string `xml:"return"`
-		} `xml:"solicitaEtiquetasResponse"`
-	} `xml:"Body"`
+// clienteLegado monta um Client com o Wsdl do pacote e as credenciais informadas
+func clienteLegado(usuario string, senha string) *Client {
+	return &Client{
+		Wsdl:       Wsdl,
+		Usuario:    usuario,
+		Senha:      senha,
+		HTTPClient: httpLegado,
+	}
 }
 
-//CancelarObjeto faz a chamada ao SIGEPWEB para cancelar uma etiqueta obtida anteriormente
+// CancelarObjeto faz a chamada ao SIGEPWEB para cancelar uma etiqueta obtida anteriormente
 func CancelarObjeto(etiqueta string, plp string, user string, senha string) error {
-	payload := fmt.Sprintf(`
-			<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:cli="http://cliente.bean.master.sigep.bsb.correios.com.br/">
-			<soapenv:Header/>
-			<soapenv:Body>
-			<cli:cancelarObjeto>				
-				<idPlp>` + plp + `</idPlp>				
-				<numeroEtiqueta>` + etiqueta + `</numeroEtiqueta>				
-				<usuario>` + user + `</usuario>				
-				<senha>` + senha + `</senha>
-			</cli:cancelarObjeto>
-			</soapenv:Body>
-		</soapenv:Envelope>
-	`)
-	req, err := http.NewRequest("POST", Wsdl, strings.NewReader(payload))
-	if err != nil {
-		return err
-	}
-	http.DefaultClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	b, err := ioutil.ReadAll(res.Body)
-	defer res.Body.Close()
-	if err != nil {
-		return err
-	}
-	b, err = IsoUtf8(b)
-	if strings.Contains(string(b), "faultstring") {
-		respError := fault{}
-		_ = xml.Unmarshal([]byte(b), &respError)
-		return errors.New(respError.Body.Fault.FaultString)
-	}
-	sucesso := cancelarObjetoResponse{}
-	_ = xml.Unmarshal([]byte(b), &sucesso)
-	if !sucesso.Body.CancelarObjetoResponse.Retorno {
-		return errors.New("erro desconhecido ao cancelar etiqueta")
-	}
-	return nil
+	return clienteLegado(user, senha).CancelarObjeto(etiqueta, plp)
 }
 
-//SolicitaEtiquetas faz a chamada ao SIGEPWEB e obtém uma faixa de etiquetas
+// SolicitaEtiquetas faz a chamada ao SIGEPWEB e obtém uma faixa de etiquetas
 func SolicitaEtiquetas(codigo string, identificador string, qtdEtiquetas int, user string, senha string) (string, error) {
-	payload := fmt.Sprintf(`
-		<x:Envelope
-		xmlns:x="http://schemas.xmlsoap.org/soap/envelope/"
-		xmlns:cli="http://cliente.bean.master.sigep.bsb.correios.com.br/">
-		<x:Header/>
-		<x:Body>
-			<cli:solicitaEtiquetas>
-				<tipoDestinatario>C</tipoDestinatario>
-				<identificador>` + identificador + `</identificador>
-				<idServico>` + codigo + `</idServico>
-				<qtdEtiquetas>` + strconv.Itoa(qtdEtiquetas) + `</qtdEtiquetas>
-				<usuario>` + user + `</usuario>
-				<senha>` + senha + `</senha>
-			</cli:solicitaEtiquetas>
-		</x:Body>
-	</x:Envelope>
-	`)
-	req, err := http.NewRequest("POST", Wsdl, strings.NewReader(payload))
-	if err != nil {
-		return "", err
-	}
-	http.DefaultClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	b, err := ioutil.ReadAll(res.Body)
-	defer res.Body.Close()
-	if err != nil {
-		return "", err
-	}
-	b, err = IsoUtf8(b)
-	if strings.Contains(string(b), "faultstring") {
-		respError := fault{}
-		_ = xml.Unmarshal([]byte(b), &respError)
-		return "", errors.New(respError.Body.Fault.FaultString)
-	}
-	faixa := solicitaEtiquetasResponse{}
-	_ = xml.Unmarshal([]byte(b), &faixa)
-	return faixa.Body.SolicitaEtiquetasResponse.FaixaEtiquetas, nil
-}
-
-//estrutura para conter o retorno do método geraDigitoVeiricadorEtiquetas
-type geraDigitoVerificadorEtiquetasResponse struct {
-	XMLName xml.Name `xml:"Envelope"`
-	Body    struct {
-		XMLName                                xml.Name
-		GeraDigitoVerificadorEtiquetasResponse struct {
-			DigitoVerificador int `xml:"return"`
-		} `xml:"geraDigitoVerificadorEtiquetasResponse"`
-	} `xml:"Body"`
+	return clienteLegado(user, senha).SolicitaEtiquetas(codigo, identificador, qtdEtiquetas)
 }
 
-//GeraDigitoVerificadorEtiquetas faz a chamada ao SIGPEWEB e gera o dígito verificador de uma etiqueta
+// GeraDigitoVerificadorEtiquetas faz a chamada ao SIGPEWEB e gera o dígito verificador de uma etiqueta
 func GeraDigitoVerificadorEtiquetas(etiqueta string) (int, error) {
-	payload := fmt.Sprintf(
-		`<x:Envelope xmlns:x="http://schemas.xmlsoap.org/soap/envelope/" xmlns:cli="http://cliente.bean.master.sigep.bsb.correios.com.br/">
-		 <x:Header/>
-		 <x:Body>
-			<cli:geraDigitoVerificadorEtiquetas>
-				<etiquetas>` + etiqueta + `</etiquetas>
-				<usuario> ` + User + `</usuario>
-				<senha>` + Pass + `</senha>
-			</cli:geraDigitoVerificadorEtiquetas>
-		</x:Body>
-		</x:Envelope>
-		`)
-	req, err := http.NewRequest("POST", Wsdl, strings.NewReader(payload))
-	if err != nil {
-		return 99, err
-	}
-	http.DefaultClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return 99, err
-	}
-	b, err := ioutil.ReadAll(res.Body)
-	defer res.Body.Close()
-	if err != nil {
-		return 99, err
-	}
-	b, err = IsoUtf8(b)
-	if strings.Contains(string(b), "faultstring") {
-		respError := fault{}
-		_ = xml.Unmarshal([]byte(b), &respError)
-		return 99, errors.New(respError.Body.Fault.FaultString)
-	}
-	digito := geraDigitoVerificadorEtiquetasResponse{}
-	_ = xml.Unmarshal([]byte(b), &digito)
-	return digito.Body.GeraDigitoVerificadorEtiquetasResponse.DigitoVerificador, nil
+	return clienteLegado(User, Pass).GeraDigitoVerificadorEtiquetas(etiqueta)
 }
 
-//estrutura para obter dados do contrato de um cliente
+// estrutura para obter dados do contrato de um cliente, no formato do envelope
+// devolvido pelo SIGEPWEB
 type buscaServicosResponse struct {
 	XMLName xml.Name `xml:"Envelope"`
 	Body    struct {
 		XMLName               xml.Name
 		BuscaServicosResponse struct {
-			Return []struct {
-				Codigo    string `xml:"codigo"`
-				ID        int    `xml:"id"`
-				Descricao string `xml:"descricao"`
-			} `xml:"return"`
+			Return []Servico `xml:"return"`
 		} `xml:"buscaServicosResponse"`
 	}
 }
 
-//BuscaServicos faz a chamada ao SIGEPWEB e obtém dados de indentificao de um cliente
+// BuscaServicos faz a chamada ao SIGEPWEB e obtém dados de indentificao de um
+// cliente, passando pelo cache definido por DefineCache
 func BuscaServicos(contrato string, cartao string, usuario string, senha string) (buscaServicosResponse, error) {
 	servicos := buscaServicosResponse{}
-	payload := fmt.Sprintf(`
-		<x:Envelope xmlns:x="http://schemas.xmlsoap.org/soap/envelope/" xmlns:cli="http://cliente.bean.master.sigep.bsb.correios.com.br/">
-			<x:Header/>
-				<x:Body>
-					<cli:buscaServicos>
-						<idContrato> ` + contrato + `</idContrato>
-						<idCartaoPostagem>` + cartao + `</idCartaoPostagem>
-						<usuario>` + usuario + `</usuario>
-						<senha>` + senha + `</senha>
-					</cli:buscaServicos>
-			</x:Body>
-		</x:Envelope>
-	`)
-	req, err := http.NewRequest("POST", Wsdl, strings.NewReader(payload))
-	if err != nil {
-		return servicos, err
-	}
-	http.DefaultClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	res, err := http.DefaultClient.Do(req)
+	ret, err := clienteLegadoCache(usuario, senha).BuscaServicos(contrato, cartao)
 	if err != nil {
 		return servicos, err
 	}
-	b, err := ioutil.ReadAll(res.Body)
-	defer res.Body.Close()
-	if err != nil {
-		return servicos, err
-	}
-	b, err = IsoUtf8(b)
-	if strings.Contains(string(b), "faultstring") {
-		respError := fault{}
-		_ = xml.Unmarshal([]byte(b), &respError)
-		return servicos, errors.New(respError.Body.Fault.FaultString)
-	}
-
-	_ = xml.Unmarshal([]byte(b), &servicos)
+	servicos.Body.BuscaServicosResponse.Return = ret
 	return servicos, nil
 }
 
-//estrutura para conter os dados de um endereço a partir do CEP
+// ConsultaCEPResponse estrutura para conter os dados de um endereço a partir do CEP,
+// no formato do envelope devolvido pelo SIGEPWEB
 type ConsultaCEPResponse struct {
 	XMLName xml.Name `xml:"Envelope"`
 	Body    struct {
 		ConsultaCEPResponse struct {
-			Return struct {
-				Bairro      string `xml:"bairro"`
-				Cep         string `xml:"cep"`
-				Cidade      string `xml:"cidade"`
-				Complemento string `xml:"complemento2"`
-				Endereco    string `xml:"end"`
-				UF          string `xml:"uf"`
-			} `xml:"return"`
+			Return Endereco `xml:"return"`
 		} `xml:"consultaCEPResponse"`
 	} `xml:"Body"`
 }
 
-//ConsultaCEP faz a chamada ao SIGEPWEB e obtem o endereco correspondente a um CEP
+// ConsultaCEP faz a chamada ao SIGEPWEB e obtem o endereco correspondente a um
+// CEP, passando pelo cache definido por DefineCache
 func ConsultaCEP(cep string) (ConsultaCEPResponse, error) {
 	endereco := ConsultaCEPResponse{}
-	payload := fmt.Sprintf(
-		`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:cli="http://cliente.bean.master.sigep.bsb.correios.com.br/">
-		<soapenv:Header/>
-		<soapenv:Body>
-			<cli:consultaCEP>
-				<!--Optional:-->
-				<cep>` + cep + `</cep>
-			</cli:consultaCEP>
-		</soapenv:Body>
-		</soapenv:Envelope>`)
-	req, err := http.NewRequest("POST", Wsdl, strings.NewReader(payload))
-	if err != nil {
-		return endereco, err
-	}
-	http.DefaultClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return endereco, err
-	}
-	b, err := ioutil.ReadAll(res.Body)
-	defer res.Body.Close()
-	if err != nil {
-		return endereco, err
-	}
-	b, err = IsoUtf8(b)
-	if strings.Contains(string(b), "faultstring") {
-		respError := fault{}
-		_ = xml.Unmarshal([]byte(b), &respError)
-		return endereco, errors.New(respError.Body.Fault.FaultString)
-	}
-
-	err = xml.Unmarshal([]byte(b), &endereco)
+	ret, err := clienteLegadoCache(User, Pass).ConsultaCEP(cep)
 	if err != nil {
 		return endereco, err
 	}
+	endereco.Body.ConsultaCEPResponse.Return = ret
 	return endereco, nil
 }
 
-type solicitaPLPResponse struct {
-	XMLName xml.Name `xml:"Envelope"`
-	Body    struct {
-		XMLName             xml.Name
-		SolicitaPLPResponse struct {
-			XML string `xml:"return"`
-		} `xml:"solicitaPLPResponse"`
-	} `xml:"Body"`
-}
-
-//SolicitaPLP faz a chamada ao SIGEPWEB e obtem o xml de uma PLP
+// SolicitaPLP faz a chamada ao SIGEPWEB e obtem o xml de uma PLP
 func SolicitaPLP(plp string, etiqueta string, usuario string, senha string) (string, error) {
-	ret := solicitaPLPResponse{}
-	payload := fmt.Sprintf(`
-	<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:cli="http://cliente.bean.master.sigep.bsb.correios.com.br/">
-		<soapenv:Header/>
-			<soapenv:Body>
-					<cli:solicitaPLP>
-						<idPlpMaster>` + plp + `</idPlpMaster>
-						<numEtiqueta>` + etiqueta + `</numEtiqueta>
-						<usuario>` + usuario + `</usuario>
-						<senha>` + senha + `</senha>
-					</cli:solicitaPLP>
-			</soapenv:Body>
-		</soapenv:Envelope>`)
-	req, err := http.NewRequest("POST", Wsdl, strings.NewReader(payload))
-	if err != nil {
-		return "", err
-	}
-	http.DefaultClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	b, err := ioutil.ReadAll(res.Body)
-	defer res.Body.Close()
-	if err != nil {
-		return "", err
-	}
-	b, err = IsoUtf8(b)
-	if strings.Contains(string(b), "faultstring") {
-		respError := fault{}
-		_ = xml.Unmarshal([]byte(b), &respError)
-		return "", errors.New(respError.Body.Fault.FaultString)
-	}
-
-	err = xml.Unmarshal([]byte(b), &ret)
-	if err != nil {
-		return "", err
-	}
-	return ret.Body.SolicitaPLPResponse.XML, nil
-}
-
-//estrutura para conter o numero de uma PLP
-type fechaPlpVariosServicosResponse struct {
-	XMLName xml.Name `xml:"Envelope"`
-	Body    struct {
-		XMLName                        xml.Name
-		FechaPlpVariosServicosResponse struct {
-			NumeroPLP string `xml:"return"`
-		} `xml:"fechaPlpVariosServicosResponse"`
-	}
+	return clienteLegado(usuario, senha).SolicitaPLP(plp, etiqueta)
 }
 
-//FechaPlpVariosServicos faz a chamada ao SIGPEWEB, fecha uma PLP
+// FechaPlpVariosServicos faz a chamada ao SIGPEWEB, fecha uma PLP. Com
+// DefineFechamento, fecha cada idPlpCliente uma única vez.
 func FechaPlpVariosServicos(xmlPLP string, etiqueta string, etiquetaSemVerificador string, idPlpCliente string, cartao string, usuario string, senha string) (string, error) {
-	xmlPLP = strings.Replace(xmlPLP, "XX000000000XX", etiqueta, 1)
-
-	payload := fmt.Sprintf(
-		`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:cli="http://cliente.bean.master.sigep.bsb.correios.com.br/">
-			<soapenv:Header/>
-			<soapenv:Body>
-				<cli:fechaPlpVariosServicos>
-					<xml><![CDATA[` + xmlPLP + `]]></xml>
-					<idPlpCliente>` + idPlpCliente + `</idPlpCliente>
-					<cartaoPostagem>` + cartao + `</cartaoPostagem>
-					<listaEtiquetas>` + etiquetaSemVerificador + `</listaEtiquetas>
-					<usuario>` + usuario + `</usuario>
-					<senha>` + senha + `</senha>
-				</cli:fechaPlpVariosServicos>
-			</soapenv:Body>
-		</soapenv:Envelope>`)
-	req, err := http.NewRequest("POST", Wsdl, strings.NewReader(payload))
-	if err != nil {
-		return "", err
-	}
-	http.DefaultClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	b, err := ioutil.ReadAll(res.Body)
-	defer res.Body.Close()
-	if err != nil {
-		return "", err
-	}
-	b, err = IsoUtf8(b)
-	if strings.Contains(string(b), "faultstring") {
-		respError := fault{}
-		_ = xml.Unmarshal([]byte(b), &respError)
-		return "", errors.New(respError.Body.Fault.FaultString)
-	}
-	plp := fechaPlpVariosServicosResponse{}
-
-	err = xml.Unmarshal([]byte(b), &plp)
-	if err != nil {
-		return "", err
-	}
-	return plp.Body.FechaPlpVariosServicosResponse.NumeroPLP, nil
+	return fechamentoLegado(usuario, senha).FechaPlpVariosServicos(context.Background(), xmlPLP, etiqueta, etiquetaSemVerificador, idPlpCliente, cartao)
 }
@@ -0,0 +1,91 @@
+package plp
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestPlpJSONIdaEVolta(t *testing.T) {
+	for _, nome := range []string{"plp_iso88591.xml", "plp_referencias.xml", "plp_sem_objetos.xml"} {
+		t.Run(nome, func(t *testing.T) {
+			p := lePlpTeste(t, nome)
+			p.ID = 7
+			p.Status = 2
+			p.Fechamento = time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+
+			b, err := json.Marshal(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var volta Plp
+			if err := json.Unmarshal(b, &volta); err != nil {
+				t.Fatal(err)
+			}
+			if difs := Diff(&p, &volta); len(difs) != 0 {
+				t.Errorf("JSON com diferenças: %v", difs)
+			}
+			if volta.ID != p.ID || volta.Status != p.Status || !volta.Fechamento.Equal(p.Fechamento) {
+				t.Errorf("campos fora do layout perdidos: %+v", volta)
+			}
+			x1, err := p.XML()
+			if err != nil {
+				t.Fatal(err)
+			}
+			x2, err := volta.XML()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if x1 != x2 {
+				t.Errorf("XML depois do JSON difere:\n%s\n%s", x1, x2)
+			}
+		})
+	}
+}
+
+func TestPlpJSONSemRemetenteNosObjetos(t *testing.T) {
+	p := lePlpTeste(t, "plp_iso88591.xml")
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Objetos []map[string]json.RawMessage `json:"objetos"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for i, o := range doc.Objetos {
+		if _, ok := o["plp"]; ok {
+			t.Errorf("objeto %d repete o remetente da PLP", i)
+		}
+	}
+
+	j := p.Objetos[0].ToJSON(&p)
+	if j.Plp.IDPlp != p.Plp.IDPlp || j.Plp.Remetente.Nome != "Comércio São João Ltda" {
+		t.Errorf("ToJSON(&p) sem a PLP: %+v", j.Plp)
+	}
+	var obj map[string]json.RawMessage
+	if b, err := json.Marshal(j); err != nil || json.Unmarshal(b, &obj) != nil || obj["plp"] == nil {
+		t.Errorf("ObjetoJSON sem plp: %v", obj)
+	}
+}
+
+func TestPlpUnmarshalJSONParcial(t *testing.T) {
+	p := lePlpTeste(t, "plp_iso88591.xml")
+	antes := lePlpTeste(t, "plp_iso88591.xml")
+
+	if err := json.Unmarshal([]byte(`{"status": 3, "remetente": {"endereco": {"numero": "2000"}}}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != 3 {
+		t.Errorf("status = %d, esperado 3", p.Status)
+	}
+	difs := Diff(&antes, &p)
+	if len(difs) != 1 || difs[0].Campo != "remetente.numero_remetente" || difs[0].Depois != "2000" {
+		t.Errorf("diferenças = %v, esperado apenas remetente.numero_remetente", difs)
+	}
+	if len(p.Objetos) != 2 {
+		t.Errorf("objetos ausentes no JSON foram substituídos: %d objetos", len(p.Objetos))
+	}
+}
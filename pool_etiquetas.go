@@ -0,0 +1,365 @@
+package plp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Erros do pool de etiquetas
+var (
+	ErrPoolEtiquetasVazio   = errors.New("negocio: pool de etiquetas do serviço vazio")
+	ErrEtiquetaNaoReservada = errors.New("negocio: etiqueta não reservada no pool")
+)
+
+// valores padrão dos campos zerados do PoolEtiquetas
+const (
+	prefixoPoolEtiquetas = "plp:etiquetas"
+	minimoPoolEtiquetas  = 20
+	lotePoolEtiquetas    = 100
+	esperaPoolEtiquetas  = 30 * time.Second
+	// validadeAbastecimento tempo após o qual a trava de um reabastecimento
+	// interrompido expira
+	validadeAbastecimento = 2 * time.Minute
+	intervaloEspera       = 100 * time.Millisecond
+)
+
+// scriptReserva KEYS livres, reservadas; ARGV instante da reserva. Devolve a
+// etiqueta, vazia com o pool vazio, e quantas continuam livres.
+var scriptReserva = redis.NewScript(2, `
+local e = redis.call('RPOP', KEYS[1])
+if not e then
+	return {'', 0}
+end
+redis.call('HSET', KEYS[2], e, ARGV[1])
+return {e, redis.call('LLEN', KEYS[1])}
+`)
+
+// scriptUsa KEYS reservadas, usadas; ARGV etiqueta
+var scriptUsa = redis.NewScript(2, `
+if redis.call('HDEL', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('SADD', KEYS[2], ARGV[1])
+return 1
+`)
+
+// scriptCancela KEYS reservadas, usadas, canceladas; ARGV etiqueta
+var scriptCancela = redis.NewScript(3, `
+if redis.call('HDEL', KEYS[1], ARGV[1]) == 0 and redis.call('SREM', KEYS[2], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('SADD', KEYS[3], ARGV[1])
+return 1
+`)
+
+// scriptDevolve KEYS reservadas, livres; ARGV etiqueta. A etiqueta devolvida é
+// a próxima a ser reservada.
+var scriptDevolve = redis.NewScript(2, `
+if redis.call('HDEL', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('RPUSH', KEYS[2], ARGV[1])
+return 1
+`)
+
+// scriptRecupera KEYS reservadas, livres; ARGV limite. Devolve ao pool as
+// reservas feitas antes do limite.
+var scriptRecupera = redis.NewScript(2, `
+local reservas = redis.call('HGETALL', KEYS[1])
+local n = 0
+for i = 1, #reservas, 2 do
+	if tonumber(reservas[i + 1]) < tonumber(ARGV[1]) then
+		redis.call('HDEL', KEYS[1], reservas[i])
+		redis.call('RPUSH', KEYS[2], reservas[i])
+		n = n + 1
+	end
+end
+return n
+`)
+
+// scriptAbastece KEYS livres, conhecidas; ARGV etiquetas. Só acrescenta as
+// etiquetas que nunca passaram pelo pool.
+var scriptAbastece = redis.NewScript(2, `
+local n = 0
+for _, e in ipairs(ARGV) do
+	if redis.call('SADD', KEYS[2], e) == 1 then
+		redis.call('LPUSH', KEYS[1], e)
+		n = n + 1
+	end
+end
+return n
+`)
+
+// PoolEtiquetas pool de etiquetas por código de serviço guardado no REDIS e
+// compartilhado entre processos. As faixas são obtidas do SIGEPWEB com
+// SolicitaEtiquetas e cada etiqueta é entregue a um único chamador: reservada
+// por Reserva, passa a usada em Usa ou cancelada em Cancela, ou volta ao pool
+// em Devolve. Campos zerados assumem os valores padrão.
+type PoolEtiquetas struct {
+	// Redis conexões com o REDIS, nil para o RedisStore iniciado por IniRedis
+	Redis *RedisStore
+	// Client cliente usado para solicitar as faixas ao SIGEPWEB
+	Client *Client
+	// Identificador CNPJ do cliente nas solicitações de etiquetas
+	Identificador string
+	// Prefixo prefixo das chaves no REDIS, padrão "plp:etiquetas"
+	Prefixo string
+	// Minimo quantidade de etiquetas livres abaixo da qual o pool é
+	// reabastecido, padrão 20
+	Minimo int
+	// Lote quantidade de etiquetas solicitadas a cada reabastecimento, padrão 100
+	Lote int
+	// Espera tempo máximo de Reserva com o pool vazio aguardando o
+	// reabastecimento feito por outro processo, padrão 30s
+	Espera time.Duration
+}
+
+// SituacaoPool quantidade de etiquetas de um serviço em cada situação
+type SituacaoPool struct {
+	Livres     int
+	Reservadas int
+	Usadas     int
+	Canceladas int
+}
+
+// NewPoolEtiquetas cria um pool de etiquetas com os valores padrão
+func NewPoolEtiquetas(s *RedisStore, c *Client, identificador string) *PoolEtiquetas {
+	return &PoolEtiquetas{Redis: s, Client: c, Identificador: identificador}
+}
+
+// Reserva entrega uma etiqueta livre do serviço, com dígito verificador. Quando
+// as livres ficam abaixo do mínimo, reabastece o pool antes de devolver, de modo
+// que essa Reserva inclui a chamada a SolicitaEtiquetas e está sujeita ao prazo
+// de ctx; uma falha nesse reabastecimento é ignorada, pois a etiqueta já está
+// reservada, e volta a ser tentada na próxima Reserva. Com o pool vazio, o
+// erro do reabastecimento é devolvido e, se outro processo estiver
+// reabastecendo, Reserva aguarda até Espera.
+func (p *PoolEtiquetas) Reserva(ctx context.Context, codigo string) (string, error) {
+	limite := time.Now().Add(p.espera())
+	for {
+		e, livres, err := p.reserva(ctx, codigo)
+		if err != nil {
+			return "", err
+		}
+		if e != "" {
+			if livres < p.minimo() {
+				// a etiqueta já está reservada; uma falha aqui volta a aparecer
+				// na Reserva que encontrar o pool vazio
+				p.abastece(ctx, codigo)
+			}
+			return e, nil
+		}
+		n, obtido, err := p.abastece(ctx, codigo)
+		if err != nil {
+			return "", err
+		}
+		if obtido && n == 0 {
+			return "", fmt.Errorf("plp poolEtiquetas reserva %s: %w: faixa já utilizada", codigo, ErrPoolEtiquetasVazio)
+		}
+		if obtido {
+			continue
+		}
+		if time.Now().After(limite) {
+			return "", fmt.Errorf("plp poolEtiquetas reserva %s: %w", codigo, ErrPoolEtiquetasVazio)
+		}
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("plp poolEtiquetas reserva %s: %w", codigo, ctx.Err())
+		case <-time.After(intervaloEspera):
+		}
+	}
+}
+
+// Usa marca a etiqueta reservada como usada
+func (p *PoolEtiquetas) Usa(ctx context.Context, codigo string, etiqueta string) error {
+	return p.muda(ctx, "usa", scriptUsa, codigo, etiqueta, "reservadas", "usadas")
+}
+
+// Cancela marca a etiqueta reservada ou usada como cancelada
+func (p *PoolEtiquetas) Cancela(ctx context.Context, codigo string, etiqueta string) error {
+	return p.muda(ctx, "cancela", scriptCancela, codigo, etiqueta, "reservadas", "usadas", "canceladas")
+}
+
+// Devolve devolve ao pool a etiqueta reservada e não usada
+func (p *PoolEtiquetas) Devolve(ctx context.Context, codigo string, etiqueta string) error {
+	return p.muda(ctx, "devolve", scriptDevolve, codigo, etiqueta, "reservadas", "livres")
+}
+
+// Recupera devolve ao pool as etiquetas do serviço reservadas há mais de idade,
+// abandonadas por processos que terminaram sem usá-las ou devolvê-las
+func (p *PoolEtiquetas) Recupera(ctx context.Context, codigo string, idade time.Duration) (int, error) {
+	c, err := p.conexao(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+	limite := time.Now().Add(-idade).Unix()
+	n, err := redis.Int(scriptRecupera.Do(c, p.chave(codigo, "reservadas"), p.chave(codigo, "livres"), limite))
+	if err != nil {
+		return 0, fmt.Errorf("plp poolEtiquetas recupera %s: %w", codigo, err)
+	}
+	return n, nil
+}
+
+// Abastece solicita ao SIGEPWEB uma nova faixa de etiquetas do serviço e a
+// acrescenta ao pool, devolvendo quantas etiquetas foram acrescentadas. Não faz
+// nada quando outro processo já está reabastecendo o serviço.
+func (p *PoolEtiquetas) Abastece(ctx context.Context, codigo string) (int, error) {
+	n, _, err := p.abastece(ctx, codigo)
+	return n, err
+}
+
+// Situacao quantidade de etiquetas do serviço em cada situação
+func (p *PoolEtiquetas) Situacao(ctx context.Context, codigo string) (SituacaoPool, error) {
+	s := SituacaoPool{}
+	c, err := p.conexao(ctx)
+	if err != nil {
+		return s, err
+	}
+	defer c.Close()
+	c.Send("LLEN", p.chave(codigo, "livres"))
+	c.Send("HLEN", p.chave(codigo, "reservadas"))
+	c.Send("SCARD", p.chave(codigo, "usadas"))
+	c.Send("SCARD", p.chave(codigo, "canceladas"))
+	if err := c.Flush(); err != nil {
+		return s, fmt.Errorf("plp poolEtiquetas situacao %s: %w", codigo, err)
+	}
+	for _, n := range []*int{&s.Livres, &s.Reservadas, &s.Usadas, &s.Canceladas} {
+		if *n, err = redis.Int(c.Receive()); err != nil {
+			return s, fmt.Errorf("plp poolEtiquetas situacao %s: %w", codigo, err)
+		}
+	}
+	return s, nil
+}
+
+// reserva retira uma etiqueta das livres, vazia com o pool vazio, devolvendo
+// também quantas continuam livres
+func (p *PoolEtiquetas) reserva(ctx context.Context, codigo string) (string, int, error) {
+	c, err := p.conexao(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	defer c.Close()
+	r, err := redis.Values(scriptReserva.Do(c, p.chave(codigo, "livres"), p.chave(codigo, "reservadas"), time.Now().Unix()))
+	if err != nil {
+		return "", 0, fmt.Errorf("plp poolEtiquetas reserva %s: %w", codigo, err)
+	}
+	var e string
+	var livres int
+	if _, err := redis.Scan(r, &e, &livres); err != nil {
+		return "", 0, fmt.Errorf("plp poolEtiquetas reserva %s: %w", codigo, err)
+	}
+	return e, livres, nil
+}
+
+// muda executa o script de mudança de situação da etiqueta com as chaves do serviço
+func (p *PoolEtiquetas) muda(ctx context.Context, op string, s *redis.Script, codigo string, etiqueta string, chaves ...string) error {
+	c, err := p.conexao(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	args := make([]interface{}, 0, len(chaves)+1)
+	for _, k := range chaves {
+		args = append(args, p.chave(codigo, k))
+	}
+	args = append(args, etiqueta)
+	ok, err := redis.Bool(s.Do(c, args...))
+	if err != nil {
+		return fmt.Errorf("plp poolEtiquetas %s %s: %w", op, etiqueta, err)
+	}
+	if !ok {
+		return fmt.Errorf("plp poolEtiquetas %s %s: %w", op, etiqueta, ErrEtiquetaNaoReservada)
+	}
+	return nil
+}
+
+// abastece reabastece o pool se obtiver a trava do serviço, indicando se a obteve
+func (p *PoolEtiquetas) abastece(ctx context.Context, codigo string) (int, bool, error) {
+	if p.Client == nil {
+		return 0, false, fmt.Errorf("plp poolEtiquetas abastece %s: cliente não informado", codigo)
+	}
+	c, err := p.conexao(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer c.Close()
+	trava := p.chave(codigo, "abastecendo")
+	dono, err := donoTrava()
+	if err != nil {
+		return 0, false, fmt.Errorf("plp poolEtiquetas abastece %s: %w", codigo, err)
+	}
+	ok, err := tentaTrava(c, trava, dono, validadeAbastecimento)
+	if err != nil {
+		return 0, false, fmt.Errorf("plp poolEtiquetas abastece %s: %w", codigo, err)
+	}
+	if !ok {
+		return 0, false, nil
+	}
+	defer scriptLibera.Do(c, trava, dono)
+
+	faixa, err := p.Client.SolicitaEtiquetasContext(ctx, codigo, p.Identificador, p.lote())
+	if err != nil {
+		return 0, true, fmt.Errorf("plp poolEtiquetas abastece %s: %w", codigo, err)
+	}
+	f, err := ParseFaixaEtiquetas(faixa)
+	if err != nil {
+		return 0, true, fmt.Errorf("plp poolEtiquetas abastece %s: %w", codigo, err)
+	}
+	args := make([]interface{}, 0, f.Len()+2)
+	args = append(args, p.chave(codigo, "livres"), p.chave(codigo, "conhecidas"))
+	f.Cada(func(e Etiqueta) bool {
+		args = append(args, e.String())
+		return true
+	})
+	n, err := redis.Int(scriptAbastece.Do(c, args...))
+	if err != nil {
+		return 0, true, fmt.Errorf("plp poolEtiquetas abastece %s: %w", codigo, err)
+	}
+	return n, true, nil
+}
+
+func (p *PoolEtiquetas) conexao(ctx context.Context) (redis.Conn, error) {
+	s := p.Redis
+	if s == nil {
+		var err error
+		if s, err = redisAtual(); err != nil {
+			return nil, err
+		}
+	}
+	return s.Conn(ctx)
+}
+
+// chave chave do REDIS da situação das etiquetas do serviço
+func (p *PoolEtiquetas) chave(codigo string, situacao string) string {
+	prefixo := p.Prefixo
+	if prefixo == "" {
+		prefixo = prefixoPoolEtiquetas
+	}
+	return prefixo + ":" + codigo + ":" + situacao
+}
+
+func (p *PoolEtiquetas) minimo() int {
+	if p.Minimo <= 0 {
+		return minimoPoolEtiquetas
+	}
+	return p.Minimo
+}
+
+func (p *PoolEtiquetas) lote() int {
+	if p.Lote <= 0 {
+		return lotePoolEtiquetas
+	}
+	return p.Lote
+}
+
+func (p *PoolEtiquetas) espera() time.Duration {
+	if p.Espera <= 0 {
+		return esperaPoolEtiquetas
+	}
+	return p.Espera
+}
@@ -0,0 +1,282 @@
+package plp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/RogerioML/plp/sigeptest"
+)
+
+// redisStoresTeste RedisStore do redisTeste e, com PLP_REDIS_TESTE, do REDIS real
+func redisStoresTeste(t *testing.T) map[string]*RedisStore {
+	t.Helper()
+	stores := map[string]*RedisStore{}
+	enderecos := map[string]string{"redisTeste": novoRedisTeste(t).Endereco}
+	if e := os.Getenv(redisTesteEnv); e != "" {
+		enderecos["redis"] = e
+	}
+	for nome, endereco := range enderecos {
+		s, err := NewRedisStore(ConfigRedis{Endereco: endereco})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		stores[nome] = s
+	}
+	return stores
+}
+
+// poolTeste pool do serviço 03220 com prefixo próprio, cujas chaves são
+// removidas ao fim do teste
+func poolTeste(t *testing.T, s *RedisStore, srv *sigeptest.Server) *PoolEtiquetas {
+	t.Helper()
+	p := NewPoolEtiquetas(s, NewClient(srv.URL, srv.Usuario, srv.Senha), "34028316000103")
+	p.Prefixo = fmt.Sprintf("plp:teste:%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		c, err := s.Conn(context.Background())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for _, situacao := range []string{"livres", "reservadas", "usadas", "canceladas", "conhecidas", "abastecendo"} {
+			c.Do("DEL", p.chave("03220", situacao))
+		}
+	})
+	return p
+}
+
+// situacaoPool situação do serviço 03220 no pool
+func situacaoPool(t *testing.T, p *PoolEtiquetas) SituacaoPool {
+	t.Helper()
+	s, err := p.Situacao(context.Background(), "03220")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestPoolEtiquetasCiclo(t *testing.T) {
+	ctx := context.Background()
+	for nome, s := range redisStoresTeste(t) {
+		t.Run(nome, func(t *testing.T) {
+			srv := sigeptest.NewServer()
+			defer srv.Close()
+			p := poolTeste(t, s, srv)
+			p.Minimo, p.Lote = 2, 5
+
+			e1, err := p.Reserva(ctx, "03220")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e1 != "SZ000000014BR" {
+				t.Errorf("primeira etiqueta = %s, esperado SZ000000014BR", e1)
+			}
+			if s := situacaoPool(t, p); s != (SituacaoPool{Livres: 4, Reservadas: 1}) {
+				t.Errorf("situação após Reserva = %+v", s)
+			}
+
+			if err := p.Usa(ctx, "03220", e1); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Usa(ctx, "03220", e1); !errors.Is(err, ErrEtiquetaNaoReservada) {
+				t.Errorf("Usa repetido = %v, esperado ErrEtiquetaNaoReservada", err)
+			}
+
+			// a etiqueta devolvida é a próxima reservada
+			e2, _ := p.Reserva(ctx, "03220")
+			if err := p.Devolve(ctx, "03220", e2); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Devolve(ctx, "03220", e2); !errors.Is(err, ErrEtiquetaNaoReservada) {
+				t.Errorf("Devolve repetido = %v, esperado ErrEtiquetaNaoReservada", err)
+			}
+			if e, _ := p.Reserva(ctx, "03220"); e != e2 {
+				t.Errorf("Reserva após Devolve = %s, esperado %s", e, e2)
+			}
+
+			// cancela tanto reservadas quanto usadas
+			for _, e := range []string{e2, e1} {
+				if err := p.Cancela(ctx, "03220", e); err != nil {
+					t.Errorf("Cancela(%s): %v", e, err)
+				}
+			}
+			if err := p.Cancela(ctx, "03220", e1); !errors.Is(err, ErrEtiquetaNaoReservada) {
+				t.Errorf("Cancela repetido = %v, esperado ErrEtiquetaNaoReservada", err)
+			}
+			if s := situacaoPool(t, p); s != (SituacaoPool{Livres: 3, Canceladas: 2}) {
+				t.Errorf("situação final = %+v", s)
+			}
+
+			// etiquetas que já passaram pelo pool não voltam a ele
+			c, err := s.Conn(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			if n, err := scriptAbastece.Do(c, p.chave("03220", "livres"), p.chave("03220", "conhecidas"), e1, "SZ000001006BR"); err != nil || n != int64(1) {
+				t.Errorf("scriptAbastece = %v, %v, esperado 1", n, err)
+			}
+			if n := srv.Chamadas("solicitaEtiquetas"); n != 1 {
+				t.Errorf("solicitaEtiquetas chamado %d vezes, esperado 1", n)
+			}
+		})
+	}
+}
+
+func TestPoolEtiquetasAbasteceAbaixoDoMinimo(t *testing.T) {
+	ctx := context.Background()
+	for nome, s := range redisStoresTeste(t) {
+		t.Run(nome, func(t *testing.T) {
+			srv := sigeptest.NewServer()
+			defer srv.Close()
+			p := poolTeste(t, s, srv)
+			p.Minimo, p.Lote = 3, 5
+
+			for i := 0; i < 2; i++ {
+				if _, err := p.Reserva(ctx, "03220"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n := srv.Chamadas("solicitaEtiquetas"); n != 1 {
+				t.Fatalf("solicitaEtiquetas chamado %d vezes com o pool no mínimo, esperado 1", n)
+			}
+			// a terceira deixa 2 livres, abaixo do mínimo
+			if _, err := p.Reserva(ctx, "03220"); err != nil {
+				t.Fatal(err)
+			}
+			if n := srv.Chamadas("solicitaEtiquetas"); n != 2 {
+				t.Errorf("solicitaEtiquetas chamado %d vezes, esperado 2", n)
+			}
+			if s := situacaoPool(t, p); s != (SituacaoPool{Livres: 7, Reservadas: 3}) {
+				t.Errorf("situação = %+v", s)
+			}
+
+			// falhas do reabastecimento abaixo do mínimo não impedem a reserva
+			srv.DefineFalha("solicitaEtiquetas", sigeptest.Falha{Mensagem: "Serviço indisponível"})
+			p.Minimo = 10
+			if _, err := p.Reserva(ctx, "03220"); err != nil {
+				t.Errorf("Reserva com reabastecimento falho: %v", err)
+			}
+			if s := situacaoPool(t, p); s != (SituacaoPool{Livres: 6, Reservadas: 4}) {
+				t.Errorf("situação = %+v", s)
+			}
+		})
+	}
+}
+
+func TestPoolEtiquetasReservaAguardaAbastecimento(t *testing.T) {
+	ctx := context.Background()
+	for nome, s := range redisStoresTeste(t) {
+		t.Run(nome, func(t *testing.T) {
+			srv := sigeptest.NewServer()
+			defer srv.Close()
+			p := poolTeste(t, s, srv)
+			p.Espera = 2 * time.Second
+			c, err := s.Conn(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			// outro processo está reabastecendo
+			if ok, err := tentaTrava(c, p.chave("03220", "abastecendo"), "outro", time.Minute); !ok || err != nil {
+				t.Fatalf("trava = %v, %v", ok, err)
+			}
+
+			go func() {
+				time.Sleep(3 * intervaloEspera)
+				c, err := s.Conn(ctx)
+				if err != nil {
+					return
+				}
+				defer c.Close()
+				scriptAbastece.Do(c, p.chave("03220", "livres"), p.chave("03220", "conhecidas"), "SZ000001006BR")
+			}()
+			if e, err := p.Reserva(ctx, "03220"); err != nil || e != "SZ000001006BR" {
+				t.Errorf("Reserva = %s, %v, esperado a etiqueta do outro processo", e, err)
+			}
+
+			p.Espera = 3 * intervaloEspera
+			inicio := time.Now()
+			if _, err := p.Reserva(ctx, "03220"); !errors.Is(err, ErrPoolEtiquetasVazio) {
+				t.Errorf("Reserva sem reabastecimento = %v, esperado ErrPoolEtiquetasVazio", err)
+			}
+			if d := time.Since(inicio); d < p.Espera {
+				t.Errorf("Reserva desistiu após %s, antes de Espera", d)
+			}
+
+			cancelado, cancela := context.WithTimeout(ctx, intervaloEspera)
+			defer cancela()
+			p.Espera = time.Minute
+			if _, err := p.Reserva(cancelado, "03220"); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Reserva com contexto vencido = %v", err)
+			}
+			if n := srv.Chamadas("solicitaEtiquetas"); n != 0 {
+				t.Errorf("solicitaEtiquetas chamado %d vezes com a trava de outro processo", n)
+			}
+		})
+	}
+}
+
+func TestPoolEtiquetasRecupera(t *testing.T) {
+	ctx := context.Background()
+	for nome, s := range redisStoresTeste(t) {
+		t.Run(nome, func(t *testing.T) {
+			srv := sigeptest.NewServer()
+			defer srv.Close()
+			p := poolTeste(t, s, srv)
+			p.Minimo, p.Lote = 1, 3
+			for i := 0; i < 2; i++ {
+				if _, err := p.Reserva(ctx, "03220"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n, err := p.Recupera(ctx, "03220", time.Hour); err != nil || n != 0 {
+				t.Errorf("Recupera de reservas recentes = %d, %v", n, err)
+			}
+			// reservas feitas antes do limite, uma hora no futuro
+			if n, err := p.Recupera(ctx, "03220", -time.Hour); err != nil || n != 2 {
+				t.Errorf("Recupera = %d, %v, esperado 2", n, err)
+			}
+			if s := situacaoPool(t, p); s != (SituacaoPool{Livres: 3}) {
+				t.Errorf("situação após Recupera = %+v", s)
+			}
+		})
+	}
+}
+
+func TestPoolEtiquetasFaixaJaUtilizada(t *testing.T) {
+	ctx := context.Background()
+	for nome, s := range redisStoresTeste(t) {
+		t.Run(nome, func(t *testing.T) {
+			srv := sigeptest.NewServer()
+			defer srv.Close()
+			p := poolTeste(t, s, srv)
+			p.Minimo, p.Lote = 1, 1
+			// reserva SZ000000014BR e, abaixo do mínimo, abastece SZ000000028BR
+			if _, err := p.Reserva(ctx, "03220"); err != nil {
+				t.Fatal(err)
+			}
+
+			// um SIGEPWEB que devolve de novo as mesmas faixas não reabastece o pool
+			outro := sigeptest.NewServer()
+			defer outro.Close()
+			p.Client = NewClient(outro.URL, outro.Usuario, outro.Senha)
+			if e, err := p.Reserva(ctx, "03220"); err != nil || e != "SZ000000028BR" {
+				t.Fatalf("Reserva = %s, %v, esperado SZ000000028BR", e, err)
+			}
+			if _, err := p.Reserva(ctx, "03220"); !errors.Is(err, ErrPoolEtiquetasVazio) {
+				t.Errorf("Reserva com faixa já utilizada = %v, esperado ErrPoolEtiquetasVazio", err)
+			}
+
+			srv.DefineFalha("solicitaEtiquetas", sigeptest.Falha{Mensagem: "Serviço indisponível"})
+			p.Client = NewClient(srv.URL, srv.Usuario, srv.Senha)
+			if _, err := p.Reserva(ctx, "03220"); err == nil || !errors.As(err, new(*FaultError)) {
+				t.Errorf("Reserva com falha do SIGEPWEB = %v, esperado FaultError", err)
+			}
+		})
+	}
+}
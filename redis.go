@@ -0,0 +1,307 @@
+package plp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ErrRedisNaoIniciado nenhum RedisStore definido como padrão
+var ErrRedisNaoIniciado = errors.New("plp: redis não iniciado, veja IniRedis")
+
+// valores padrão dos campos zerados do ConfigRedis
+const (
+	maxIdleRedis         = 64
+	idleTimeoutRedis     = 240 * time.Second
+	maxConnLifetimeRedis = 300 * time.Second
+	timeoutConexaoRedis  = 5 * time.Second
+	// testeConexaoRedis conexões ociosas há mais tempo recebem um PING antes do uso
+	testeConexaoRedis = time.Minute
+)
+
+// ConfigRedis configuração da conexão com o REDIS. Campos zerados assumem os
+// valores padrão.
+type ConfigRedis struct {
+	// Endereco host:porta do REDIS, ignorado quando Sentinel é informado
+	Endereco string
+	// Senha senha do comando AUTH, vazia para REDIS sem autenticação
+	Senha string
+	// DB índice do banco selecionado em cada conexão
+	DB int
+	// TLS conecta com TLS, usando TLSConfig quando informada
+	TLS       bool
+	TLSConfig *tls.Config
+	// MaxIdle máximo de conexões ociosas mantidas no pool, padrão 64
+	MaxIdle int
+	// MaxActive máximo de conexões abertas, zero para ilimitado. Com o limite
+	// atingido, os chamadores aguardam uma conexão livre até o prazo do contexto.
+	MaxActive int
+	// IdleTimeout tempo após o qual conexões ociosas são fechadas, padrão 240s
+	IdleTimeout time.Duration
+	// MaxConnLifetime tempo máximo de vida de uma conexão, padrão 300s
+	MaxConnLifetime time.Duration
+	// TimeoutConexao prazo para abrir a conexão, padrão 5s
+	TimeoutConexao time.Duration
+	// TimeoutLeitura e TimeoutEscrita prazos de cada comando, zero para sem prazo
+	TimeoutLeitura time.Duration
+	TimeoutEscrita time.Duration
+	// Sentinel quando informado, o endereço do master é obtido dos sentinels
+	Sentinel *ConfigSentinel
+}
+
+// ConfigSentinel sentinels que monitoram o master do REDIS
+type ConfigSentinel struct {
+	// Enderecos host:porta dos sentinels, consultados em ordem
+	Enderecos []string
+	// Master nome do master monitorado
+	Master string
+	// Senha senha dos sentinels, vazia para sentinels sem autenticação
+	Senha string
+}
+
+// RedisStore pool de conexões com o REDIS, seguro para uso concorrente
+type RedisStore struct {
+	Pool *redis.Pool
+	cfg  ConfigRedis
+}
+
+var (
+	muRedis     sync.RWMutex
+	redisPadrao *RedisStore
+)
+
+// NewRedisStore cria o pool de conexões da configuração e testa a conexão
+func NewRedisStore(cfg ConfigRedis) (*RedisStore, error) {
+	if cfg.Endereco == "" && cfg.Sentinel == nil {
+		return nil, errors.New("plp redis: endereço não informado")
+	}
+	if cfg.Sentinel != nil && (len(cfg.Sentinel.Enderecos) == 0 || cfg.Sentinel.Master == "") {
+		return nil, errors.New("plp redis: sentinels ou master não informados")
+	}
+	cfg = cfg.normaliza()
+	s := &RedisStore{cfg: cfg}
+	s.Pool = &redis.Pool{
+		MaxIdle:         cfg.MaxIdle,
+		MaxActive:       cfg.MaxActive,
+		IdleTimeout:     cfg.IdleTimeout,
+		MaxConnLifetime: cfg.MaxConnLifetime,
+		Wait:            cfg.MaxActive > 0,
+		Dial:            s.dial,
+		TestOnBorrow:    s.testa,
+	}
+	if err := s.Ping(context.Background()); err != nil {
+		s.Pool.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// normaliza preenche os campos zerados com os valores padrão
+func (c ConfigRedis) normaliza() ConfigRedis {
+	if c.MaxIdle <= 0 {
+		c.MaxIdle = maxIdleRedis
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = idleTimeoutRedis
+	}
+	if c.MaxConnLifetime <= 0 {
+		c.MaxConnLifetime = maxConnLifetimeRedis
+	}
+	if c.TimeoutConexao <= 0 {
+		c.TimeoutConexao = timeoutConexaoRedis
+	}
+	return c
+}
+
+// Conn obtém uma conexão do pool, que deve ser fechada pelo chamador
+func (s *RedisStore) Conn(ctx context.Context) (redis.Conn, error) {
+	c, err := s.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("plp redis conn: %w", err)
+	}
+	return c, nil
+}
+
+// Ping testa a conexão com o REDIS
+func (s *RedisStore) Ping(ctx context.Context) error {
+	c, err := s.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if _, err := c.Do("PING"); err != nil {
+		return fmt.Errorf("plp redis ping: %w", err)
+	}
+	return nil
+}
+
+// Close fecha o pool e suas conexões
+func (s *RedisStore) Close() error {
+	return s.Pool.Close()
+}
+
+// dial abre uma conexão com o REDIS. Com sentinels, cada conexão é aberta com o
+// master indicado por eles e confirmada pelo ROLE, de modo que falhas e
+// failovers levam a uma nova consulta aos sentinels.
+func (s *RedisStore) dial() (redis.Conn, error) {
+	endereco := s.cfg.Endereco
+	if s.cfg.Sentinel != nil {
+		var err error
+		if endereco, err = s.master(); err != nil {
+			return nil, err
+		}
+	}
+	opcoes := []redis.DialOption{
+		redis.DialConnectTimeout(s.cfg.TimeoutConexao),
+		redis.DialReadTimeout(s.cfg.TimeoutLeitura),
+		redis.DialWriteTimeout(s.cfg.TimeoutEscrita),
+		redis.DialDatabase(s.cfg.DB),
+	}
+	if s.cfg.Senha != "" {
+		opcoes = append(opcoes, redis.DialPassword(s.cfg.Senha))
+	}
+	if s.cfg.TLS {
+		opcoes = append(opcoes, redis.DialUseTLS(true))
+		if s.cfg.TLSConfig != nil {
+			opcoes = append(opcoes, redis.DialTLSConfig(s.cfg.TLSConfig))
+		}
+	}
+	c, err := redis.Dial("tcp", endereco, opcoes...)
+	if err != nil || s.cfg.Sentinel == nil {
+		return c, err
+	}
+	if err := verificaMaster(c); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("plp redis %s: %w", endereco, err)
+	}
+	return &connMaster{Conn: c}, nil
+}
+
+// master consulta os sentinels em ordem e devolve o endereço do master
+func (s *RedisStore) master() (string, error) {
+	sentinel := s.cfg.Sentinel
+	var ultimo error
+	for _, endereco := range sentinel.Enderecos {
+		opcoes := []redis.DialOption{
+			redis.DialConnectTimeout(s.cfg.TimeoutConexao),
+			redis.DialReadTimeout(s.cfg.TimeoutConexao),
+		}
+		if sentinel.Senha != "" {
+			opcoes = append(opcoes, redis.DialPassword(sentinel.Senha))
+		}
+		c, err := redis.Dial("tcp", endereco, opcoes...)
+		if err != nil {
+			ultimo = err
+			continue
+		}
+		hostPorta, err := redis.Strings(c.Do("SENTINEL", "get-master-addr-by-name", sentinel.Master))
+		c.Close()
+		if err == nil && len(hostPorta) != 2 {
+			err = fmt.Errorf("resposta inesperada %v", hostPorta)
+		}
+		if err != nil {
+			ultimo = err
+			continue
+		}
+		return net.JoinHostPort(hostPorta[0], hostPorta[1]), nil
+	}
+	return "", fmt.Errorf("plp redis sentinel %s: %w", sentinel.Master, ultimo)
+}
+
+// testa verifica as conexões ociosas há mais tempo antes de entregá-las
+func (s *RedisStore) testa(c redis.Conn, t time.Time) error {
+	if time.Since(t) < testeConexaoRedis {
+		return nil
+	}
+	_, err := c.Do("PING")
+	return err
+}
+
+// verificaMaster confirma pelo ROLE que o servidor da conexão é o master
+func verificaMaster(c redis.Conn) error {
+	papel, err := redis.Values(c.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(papel) == 0 {
+		return errors.New("resposta vazia ao ROLE")
+	}
+	if r, _ := redis.String(papel[0], nil); r != "master" {
+		return fmt.Errorf("servidor não é o master (%s)", r)
+	}
+	return nil
+}
+
+// connMaster conexão com o master indicado pelos sentinels. Após um failover o
+// servidor vira réplica e responde às escritas com READONLY; a conexão passa
+// então a devolver o erro em Err, o pool a descarta e a próxima é aberta com o
+// novo master.
+type connMaster struct {
+	redis.Conn
+	mu  sync.Mutex
+	err error
+}
+
+// verifica guarda o erro READONLY da resposta e devolve err inalterado
+func (c *connMaster) verifica(err error) error {
+	if e, ok := err.(redis.Error); ok && strings.HasPrefix(string(e), "READONLY") {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+	}
+	return err
+}
+
+func (c *connMaster) Err() error {
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.Conn.Err()
+}
+
+func (c *connMaster) Do(cmd string, args ...interface{}) (interface{}, error) {
+	v, err := c.Conn.Do(cmd, args...)
+	return v, c.verifica(err)
+}
+
+func (c *connMaster) Receive() (interface{}, error) {
+	v, err := c.Conn.Receive()
+	return v, c.verifica(err)
+}
+
+func (c *connMaster) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	v, err := redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+	return v, c.verifica(err)
+}
+
+func (c *connMaster) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	v, err := redis.ReceiveWithTimeout(c.Conn, timeout)
+	return v, c.verifica(err)
+}
+
+// DefineRedis substitui o RedisStore usado por padrão, como o criado por IniRedis
+func DefineRedis(s *RedisStore) {
+	muRedis.Lock()
+	redisPadrao = s
+	muRedis.Unlock()
+}
+
+// redisAtual devolve o RedisStore padrão
+func redisAtual() (*RedisStore, error) {
+	muRedis.RLock()
+	defer muRedis.RUnlock()
+	if redisPadrao == nil {
+		return nil, ErrRedisNaoIniciado
+	}
+	return redisPadrao, nil
+}
@@ -0,0 +1,715 @@
+package plp
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// redisTesteEnv variável com o host:porta de um REDIS real para os testes, que
+// também executam os scripts Lua; sem ela os testes usam o redisTeste
+const redisTesteEnv = "PLP_REDIS_TESTE"
+
+// erroRedis resposta de erro do redisTeste
+type erroRedis string
+
+// statusRedis resposta simples do redisTeste, como OK
+type statusRedis string
+
+// scriptRedisTeste equivalente em Go de um script Lua, com as chaves e os argumentos
+type scriptRedisTeste func(r *redisTeste, chaves, args []string) interface{}
+
+// redisTeste servidor REDIS em memória com os comandos e os scripts usados pelo
+// pacote. Os scripts são reconhecidos pelo SHA1 do código e executados por
+// equivalentes em Go; com PLP_REDIS_TESTE os mesmos testes executam o Lua.
+type redisTeste struct {
+	Endereco string
+	ln       net.Listener
+
+	mu      sync.Mutex
+	dados   map[string]interface{}
+	expira  map[string]time.Time
+	scripts map[string]scriptRedisTeste
+	conns   map[net.Conn]bool
+	// Papel resposta ao ROLE, "master" por padrão
+	Papel string
+	// SomenteLeitura responde às escritas com READONLY, como uma réplica
+	SomenteLeitura bool
+	// Master endereço devolvido aos pedidos do master, como um sentinel
+	Master string
+	// Senha senha exigida pelo AUTH, vazia para sem autenticação
+	Senha    string
+	comandos map[string]int
+	dials    int
+}
+
+// novoRedisTeste inicia um redisTeste encerrado ao fim do teste
+func novoRedisTeste(t *testing.T) *redisTeste {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &redisTeste{
+		Endereco: ln.Addr().String(),
+		ln:       ln,
+		dados:    map[string]interface{}{},
+		expira:   map[string]time.Time{},
+		conns:    map[net.Conn]bool{},
+		Papel:    "master",
+		comandos: map[string]int{},
+	}
+	r.scripts = map[string]scriptRedisTeste{
+		scriptReserva.Hash():  (*redisTeste).reserva,
+		scriptUsa.Hash():      (*redisTeste).usa,
+		scriptCancela.Hash():  (*redisTeste).cancela,
+		scriptDevolve.Hash():  (*redisTeste).devolve,
+		scriptRecupera.Hash(): (*redisTeste).recupera,
+		scriptAbastece.Hash(): (*redisTeste).abastece,
+		scriptLibera.Hash():   (*redisTeste).libera,
+	}
+	go r.aceita()
+	t.Cleanup(r.Close)
+	return r
+}
+
+// Close encerra o servidor e as conexões abertas
+func (r *redisTeste) Close() {
+	r.ln.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for c := range r.conns {
+		c.Close()
+	}
+}
+
+// Comandos quantidade de execuções do comando, como EVALSHA
+func (r *redisTeste) Comandos(nome string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.comandos[nome]
+}
+
+// Conexoes quantidade de conexões aceitas
+func (r *redisTeste) Conexoes() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dials
+}
+
+// Define altera o servidor sob a trava, como na troca de papel em um failover
+func (r *redisTeste) Define(f func(r *redisTeste)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(r)
+}
+
+func (r *redisTeste) aceita() {
+	for {
+		c, err := r.ln.Accept()
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.conns[c] = true
+		r.dials++
+		r.mu.Unlock()
+		go r.atende(c)
+	}
+}
+
+// atende lê os comandos da conexão no protocolo RESP e escreve as respostas
+func (r *redisTeste) atende(c net.Conn) {
+	defer func() {
+		r.mu.Lock()
+		delete(r.conns, c)
+		r.mu.Unlock()
+		c.Close()
+	}()
+	br := bufio.NewReader(c)
+	bw := bufio.NewWriter(c)
+	autenticado := false
+	for {
+		cmd, err := leComando(br)
+		if err != nil {
+			return
+		}
+		var resposta interface{}
+		r.mu.Lock()
+		nome := strings.ToUpper(cmd[0])
+		r.comandos[nome]++
+		switch {
+		case nome == "AUTH":
+			if autenticado = len(cmd) == 2 && cmd[1] == r.Senha; autenticado {
+				resposta = statusRedis("OK")
+			} else {
+				resposta = erroRedis("WRONGPASS invalid password")
+			}
+		case r.Senha != "" && !autenticado:
+			resposta = erroRedis("NOAUTH Authentication required.")
+		default:
+			resposta = r.executa(nome, cmd[1:])
+			r.limpa()
+		}
+		r.mu.Unlock()
+		escreveResposta(bw, resposta)
+		if bw.Buffered() > 0 && br.Buffered() == 0 {
+			if err := bw.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// leComando lê um array de bulk strings
+func leComando(br *bufio.Reader) ([]string, error) {
+	linha, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(linha, "*") {
+		return nil, fmt.Errorf("comando inesperado %q", linha)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(linha[1:]))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("comando inesperado %q", linha)
+	}
+	cmd := make([]string, n)
+	for i := range cmd {
+		if linha, err = br.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		tam, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(linha, "$")))
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, tam+2)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return nil, err
+		}
+		cmd[i] = string(b[:tam])
+	}
+	return cmd, nil
+}
+
+func escreveResposta(w *bufio.Writer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case statusRedis:
+		w.WriteString("+" + string(v) + "\r\n")
+	case erroRedis:
+		w.WriteString("-" + string(v) + "\r\n")
+	case int:
+		w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case string:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case []string:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			escreveResposta(w, e)
+		}
+	case []interface{}:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			escreveResposta(w, e)
+		}
+	default:
+		panic(fmt.Sprintf("resposta %T", v))
+	}
+}
+
+// escritas comandos rejeitados por uma réplica
+var escritas = map[string]bool{"SET": true, "DEL": true, "LPUSH": true, "RPUSH": true, "EVALSHA": true, "EVAL": true}
+
+// executa o comando com r.mu obtido
+func (r *redisTeste) executa(nome string, args []string) interface{} {
+	if r.SomenteLeitura && escritas[nome] {
+		return erroRedis("READONLY You can't write against a read only replica.")
+	}
+	switch nome {
+	case "PING":
+		return statusRedis("PONG")
+	case "SELECT":
+		return statusRedis("OK")
+	case "ROLE":
+		return []interface{}{r.Papel, 0, []interface{}{}}
+	case "SENTINEL":
+		if len(args) != 2 || !strings.EqualFold(args[0], "get-master-addr-by-name") {
+			return erroRedis("ERR sentinel")
+		}
+		if r.Master == "" {
+			return nil
+		}
+		host, porta, _ := net.SplitHostPort(r.Master)
+		return []string{host, porta}
+	case "GET":
+		if v, ok := r.valor(args[0]).(string); ok {
+			return v
+		}
+		return nil
+	case "SET":
+		return r.set(args)
+	case "DEL":
+		n := 0
+		for _, k := range args {
+			if r.valor(k) != nil {
+				r.remove(k)
+				n++
+			}
+		}
+		return n
+	case "LPUSH", "RPUSH":
+		for _, e := range args[1:] {
+			r.push(args[0], e, nome == "LPUSH")
+		}
+		return len(r.lista(args[0]))
+	case "LLEN":
+		return len(r.lista(args[0]))
+	case "HLEN":
+		return len(r.hash(args[0]))
+	case "SCARD":
+		return len(r.conjunto(args[0]))
+	case "EVALSHA", "EVAL":
+		sha := args[0]
+		if nome == "EVAL" {
+			h := sha1.Sum([]byte(args[0]))
+			sha = hex.EncodeToString(h[:])
+		}
+		s, ok := r.scripts[sha]
+		if !ok {
+			return erroRedis("NOSCRIPT No matching script.")
+		}
+		n, _ := strconv.Atoi(args[1])
+		return s(r, args[2:2+n], args[2+n:])
+	}
+	return erroRedis("ERR unknown command '" + nome + "'")
+}
+
+func (r *redisTeste) set(args []string) interface{} {
+	k, v := args[0], args[1]
+	var validade time.Duration
+	nx := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "PX":
+			ms, _ := strconv.Atoi(args[i+1])
+			validade = time.Duration(ms) * time.Millisecond
+			i++
+		}
+	}
+	if nx && r.valor(k) != nil {
+		return nil
+	}
+	r.remove(k)
+	r.dados[k] = v
+	if validade > 0 {
+		r.expira[k] = time.Now().Add(validade)
+	}
+	return statusRedis("OK")
+}
+
+// valor valor da chave, nil quando ausente ou vencida
+func (r *redisTeste) valor(k string) interface{} {
+	if t, ok := r.expira[k]; ok && time.Now().After(t) {
+		r.remove(k)
+	}
+	return r.dados[k]
+}
+
+func (r *redisTeste) remove(k string) {
+	delete(r.dados, k)
+	delete(r.expira, k)
+}
+
+func (r *redisTeste) lista(k string) []string {
+	l, _ := r.valor(k).([]string)
+	return l
+}
+
+func (r *redisTeste) push(k, e string, inicio bool) {
+	if inicio {
+		r.dados[k] = append([]string{e}, r.lista(k)...)
+		return
+	}
+	r.dados[k] = append(r.lista(k), e)
+}
+
+// rpop retira o último elemento da lista
+func (r *redisTeste) rpop(k string) (string, bool) {
+	l := r.lista(k)
+	if len(l) == 0 {
+		return "", false
+	}
+	r.dados[k] = l[:len(l)-1]
+	return l[len(l)-1], true
+}
+
+// limpa remove as listas, hashes e conjuntos vazios, como o REDIS
+func (r *redisTeste) limpa() {
+	for k, v := range r.dados {
+		vazio := false
+		switch v := v.(type) {
+		case []string:
+			vazio = len(v) == 0
+		case map[string]string:
+			vazio = len(v) == 0
+		case map[string]bool:
+			vazio = len(v) == 0
+		}
+		if vazio {
+			r.remove(k)
+		}
+	}
+}
+
+func (r *redisTeste) hash(k string) map[string]string {
+	h, ok := r.valor(k).(map[string]string)
+	if !ok {
+		h = map[string]string{}
+		r.dados[k] = h
+	}
+	return h
+}
+
+func (r *redisTeste) hdel(k, campo string) int {
+	h := r.hash(k)
+	if _, ok := h[campo]; !ok {
+		return 0
+	}
+	delete(h, campo)
+	return 1
+}
+
+func (r *redisTeste) conjunto(k string) map[string]bool {
+	c, ok := r.valor(k).(map[string]bool)
+	if !ok {
+		c = map[string]bool{}
+		r.dados[k] = c
+	}
+	return c
+}
+
+func (r *redisTeste) sadd(k, e string) int {
+	c := r.conjunto(k)
+	if c[e] {
+		return 0
+	}
+	c[e] = true
+	return 1
+}
+
+func (r *redisTeste) srem(k, e string) int {
+	c := r.conjunto(k)
+	if !c[e] {
+		return 0
+	}
+	delete(c, e)
+	return 1
+}
+
+// reserva equivalente de scriptReserva
+func (r *redisTeste) reserva(chaves, args []string) interface{} {
+	e, ok := r.rpop(chaves[0])
+	if !ok {
+		return []interface{}{"", 0}
+	}
+	r.hash(chaves[1])[e] = args[0]
+	return []interface{}{e, len(r.lista(chaves[0]))}
+}
+
+// usa equivalente de scriptUsa
+func (r *redisTeste) usa(chaves, args []string) interface{} {
+	if r.hdel(chaves[0], args[0]) == 0 {
+		return 0
+	}
+	r.sadd(chaves[1], args[0])
+	return 1
+}
+
+// cancela equivalente de scriptCancela
+func (r *redisTeste) cancela(chaves, args []string) interface{} {
+	if r.hdel(chaves[0], args[0]) == 0 && r.srem(chaves[1], args[0]) == 0 {
+		return 0
+	}
+	r.sadd(chaves[2], args[0])
+	return 1
+}
+
+// devolve equivalente de scriptDevolve
+func (r *redisTeste) devolve(chaves, args []string) interface{} {
+	if r.hdel(chaves[0], args[0]) == 0 {
+		return 0
+	}
+	r.push(chaves[1], args[0], false)
+	return 1
+}
+
+// recupera equivalente de scriptRecupera
+func (r *redisTeste) recupera(chaves, args []string) interface{} {
+	limite, _ := strconv.ParseInt(args[0], 10, 64)
+	n := 0
+	for e, instante := range r.hash(chaves[0]) {
+		if t, _ := strconv.ParseInt(instante, 10, 64); t < limite {
+			r.hdel(chaves[0], e)
+			r.push(chaves[1], e, false)
+			n++
+		}
+	}
+	return n
+}
+
+// abastece equivalente de scriptAbastece
+func (r *redisTeste) abastece(chaves, args []string) interface{} {
+	n := 0
+	for _, e := range args {
+		if r.sadd(chaves[1], e) == 1 {
+			r.push(chaves[0], e, true)
+			n++
+		}
+	}
+	return n
+}
+
+// libera equivalente de scriptLibera
+func (r *redisTeste) libera(chaves, args []string) interface{} {
+	if v, _ := r.valor(chaves[0]).(string); v == args[0] {
+		r.remove(chaves[0])
+		return 1
+	}
+	return 0
+}
+
+// enderecoFechado endereço sem servidor escutando
+func enderecoFechado(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+	return ln.Addr().String()
+}
+
+func TestNewRedisStoreConfigInvalida(t *testing.T) {
+	casos := map[string]ConfigRedis{
+		"sem endereço":       {},
+		"sentinel sem lista": {Sentinel: &ConfigSentinel{Master: "mestre"}},
+		"sentinel sem nome":  {Sentinel: &ConfigSentinel{Enderecos: []string{"127.0.0.1:26379"}}},
+	}
+	for nome, cfg := range casos {
+		if s, err := NewRedisStore(cfg); err == nil {
+			s.Close()
+			t.Errorf("%s: NewRedisStore sem erro", nome)
+		}
+	}
+	if _, err := NewRedisStore(ConfigRedis{Endereco: enderecoFechado(t)}); err == nil || !strings.HasPrefix(err.Error(), "plp redis conn") {
+		t.Errorf("NewRedisStore sem servidor = %v", err)
+	}
+}
+
+func TestNewRedisStoreConfig(t *testing.T) {
+	r := novoRedisTeste(t)
+	r.Senha = "segredo"
+	if _, err := NewRedisStore(ConfigRedis{Endereco: r.Endereco}); err == nil {
+		t.Error("NewRedisStore sem a senha exigida pelo servidor sem erro")
+	}
+	s, err := NewRedisStore(ConfigRedis{Endereco: r.Endereco, Senha: "segredo", DB: 3, MaxActive: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Pool.MaxIdle != maxIdleRedis || s.Pool.IdleTimeout != idleTimeoutRedis || s.Pool.MaxConnLifetime != maxConnLifetimeRedis {
+		t.Errorf("pool sem os valores padrão: %+v", s.Pool)
+	}
+	if s.Pool.MaxActive != 2 || !s.Pool.Wait {
+		t.Errorf("pool com MaxActive %d e Wait %v, esperado 2 e true", s.Pool.MaxActive, s.Pool.Wait)
+	}
+	if n := r.Comandos("SELECT"); n != 1 {
+		t.Errorf("SELECT executado %d vezes, esperado 1", n)
+	}
+
+	// com o limite atingido, Conn aguarda até o prazo do contexto
+	c1, _ := s.Conn(context.Background())
+	c2, _ := s.Conn(context.Background())
+	defer c1.Close()
+	defer c2.Close()
+	ctx, cancela := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancela()
+	if _, err := s.Conn(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Conn com o pool esgotado = %v, esperado DeadlineExceeded", err)
+	}
+}
+
+func TestRedisSentinelMaster(t *testing.T) {
+	master, sentinel := novoRedisTeste(t), novoRedisTeste(t)
+	sentinel.Master, sentinel.Senha = master.Endereco, "sentinela"
+	s, err := NewRedisStore(ConfigRedis{Sentinel: &ConfigSentinel{
+		Enderecos: []string{enderecoFechado(t), sentinel.Endereco},
+		Master:    "mestre",
+		Senha:     "sentinela",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if n := sentinel.Comandos("SENTINEL"); n != 1 {
+		t.Errorf("SENTINEL executado %d vezes, esperado 1", n)
+	}
+	if n := master.Comandos("ROLE"); n != 1 {
+		t.Errorf("ROLE executado %d vezes no master, esperado 1", n)
+	}
+
+	desconhecido := novoRedisTeste(t)
+	if _, err := NewRedisStore(ConfigRedis{Sentinel: &ConfigSentinel{
+		Enderecos: []string{desconhecido.Endereco},
+		Master:    "outro",
+	}}); err == nil || !strings.Contains(err.Error(), "sentinel outro") {
+		t.Errorf("NewRedisStore com master desconhecido = %v", err)
+	}
+}
+
+func TestRedisSentinelRejeitaReplica(t *testing.T) {
+	replica, sentinel := novoRedisTeste(t), novoRedisTeste(t)
+	replica.Papel = "slave"
+	sentinel.Master = replica.Endereco
+	if s, err := NewRedisStore(ConfigRedis{Sentinel: &ConfigSentinel{
+		Enderecos: []string{sentinel.Endereco},
+		Master:    "mestre",
+	}}); err == nil || !strings.Contains(err.Error(), "não é o master") {
+		if s != nil {
+			s.Close()
+		}
+		t.Errorf("NewRedisStore com réplica = %v", err)
+	}
+}
+
+func TestRedisSentinelFailover(t *testing.T) {
+	antigo, novo, sentinel := novoRedisTeste(t), novoRedisTeste(t), novoRedisTeste(t)
+	sentinel.Master = antigo.Endereco
+	s, err := NewRedisStore(ConfigRedis{Sentinel: &ConfigSentinel{
+		Enderecos: []string{sentinel.Endereco},
+		Master:    "mestre",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// o master antigo vira réplica; a conexão ociosa ainda não foi testada
+	antigo.Define(func(r *redisTeste) { r.Papel, r.SomenteLeitura = "slave", true })
+	sentinel.Define(func(r *redisTeste) { r.Master = novo.Endereco })
+	c, err := s.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("SET", "chave", "valor"); err == nil || !strings.HasPrefix(err.Error(), "READONLY") {
+		t.Errorf("SET na réplica = %v, esperado READONLY", err)
+	}
+	if c.Err() == nil {
+		t.Error("conexão com READONLY sem erro em Err")
+	}
+	c.Close()
+
+	// a conexão foi descartada e a próxima é aberta com o novo master
+	c, err = s.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Do("SET", "chave", "valor"); err != nil {
+		t.Errorf("SET após o failover: %v", err)
+	}
+	if n := novo.Comandos("SET"); n != 1 {
+		t.Errorf("SET executado %d vezes no novo master, esperado 1", n)
+	}
+	if n := antigo.Conexoes(); n != 1 {
+		t.Errorf("%d conexões com o master antigo, esperado 1", n)
+	}
+
+	// o erro também é percebido nos comandos com prazo
+	if _, err := redis.DoWithTimeout(c, time.Second, "SET", "chave", "valor"); err != nil {
+		t.Errorf("DoWithTimeout: %v", err)
+	}
+	novo.Define(func(r *redisTeste) { r.SomenteLeitura = true })
+	if _, err := redis.DoWithTimeout(c, time.Second, "SET", "chave", "valor"); err == nil || c.Err() == nil {
+		t.Errorf("DoWithTimeout na réplica = %v, Err = %v", err, c.Err())
+	}
+}
+
+func TestRedisTestaConexaoOciosa(t *testing.T) {
+	r := novoRedisTeste(t)
+	s, err := NewRedisStore(ConfigRedis{Endereco: r.Endereco})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c, err := s.dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	pings := r.Comandos("PING")
+	if err := s.testa(c, time.Now()); err != nil || r.Comandos("PING") != pings {
+		t.Errorf("testa de conexão recente = %v, com %d PINGs", err, r.Comandos("PING")-pings)
+	}
+	if err := s.testa(c, time.Now().Add(-2*testeConexaoRedis)); err != nil || r.Comandos("PING") != pings+1 {
+		t.Errorf("testa de conexão ociosa = %v, com %d PINGs", err, r.Comandos("PING")-pings)
+	}
+	r.Close()
+	if err := s.testa(c, time.Now().Add(-2*testeConexaoRedis)); err == nil {
+		t.Error("testa com o servidor encerrado sem erro")
+	}
+}
+
+func TestDefineRedis(t *testing.T) {
+	padrao, pool := redisPadrao, Pool
+	defer func() {
+		DefineRedis(padrao)
+		Pool = pool
+	}()
+
+	DefineRedis(nil)
+	if _, err := redisAtual(); !errors.Is(err, ErrRedisNaoIniciado) {
+		t.Errorf("redisAtual sem RedisStore = %v, esperado ErrRedisNaoIniciado", err)
+	}
+	if err := IniRedisConfig(ConfigRedis{Endereco: enderecoFechado(t)}); err == nil {
+		t.Error("IniRedisConfig sem servidor sem erro")
+	}
+	if _, err := redisAtual(); !errors.Is(err, ErrRedisNaoIniciado) {
+		t.Errorf("redisAtual após IniRedisConfig falho = %v", err)
+	}
+
+	r := novoRedisTeste(t)
+	if err := IniRedis(r.Endereco); err != nil {
+		t.Fatal(err)
+	}
+	s, err := redisAtual()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if Pool != s.Pool {
+		t.Error("Pool diferente do pool do RedisStore padrão")
+	}
+
+	outro := &RedisStore{}
+	DefineRedis(outro)
+	if s, _ := redisAtual(); s != outro {
+		t.Error("redisAtual diferente do definido por DefineRedis")
+	}
+}
@@ -0,0 +1,416 @@
+package plp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Erros dos repositórios de objetos e PLPs
+var (
+	ErrObjetoNaoEncontrado  = errors.New("negocio: objeto postal não cadastrado")
+	ErrPlpNaoCadastrada     = errors.New("negocio: PLP não cadastrada")
+	ErrPlpSemNumero         = errors.New("negocio: PLP sem número")
+	ErrEstadoObjetoAlterado = errors.New("negocio: estado do objeto alterado por outro processo")
+	ErrObjetoEmOutraPlp     = errors.New("negocio: objeto postal cadastrado em outra PLP")
+	ErrBancoNaoIniciado     = errors.New("plp: banco de dados não iniciado, veja IniDb")
+)
+
+// ObjetoRepository acesso aos objetos postais cadastrados. As etiquetas podem ser
+// informadas com ou sem o dígito verificador.
+type ObjetoRepository interface {
+	// InsereObjeto cadastra o objeto na PLP de número plp
+	InsereObjeto(ctx context.Context, plp int, o *Objeto) error
+	// AtualizaEstadoObjeto muda o estado do objeto de para para pela
+	// MaquinaEstadosPadrao, chamando seus hooks, e devolve *ErroTransicao se a
+	// mudança não for permitida e ErrEstadoObjetoAlterado se o objeto não estiver
+	// mais no estado de
+	AtualizaEstadoObjeto(ctx context.Context, etiqueta string, de, para EstadoObjeto) error
+	// BuscaObjeto devolve o objeto da etiqueta ou ErrObjetoNaoEncontrado
+	BuscaObjeto(ctx context.Context, etiqueta string) (*Objeto, error)
+	// ListaObjetos devolve os objetos da PLP de número plp
+	ListaObjetos(ctx context.Context, plp int) ([]*Objeto, error)
+}
+
+// buscadorEstado repositórios que consultam apenas o estado do objeto, sem ler o
+// objeto inteiro, usados por ObjetoJSON.Valida quando disponíveis
+type buscadorEstado interface {
+	BuscaEstadoObjeto(ctx context.Context, etiqueta string) (EstadoObjeto, error)
+}
+
+// PlpRepository acesso às PLPs cadastradas, identificadas pelo campo ID
+type PlpRepository interface {
+	// InserePlp cadastra a PLP e seus objetos
+	InserePlp(ctx context.Context, p *Plp) error
+	// SalvaPlp insere ou atualiza a PLP e seus objetos de uma só vez
+	SalvaPlp(ctx context.Context, p *Plp) error
+	// AtualizaEstadoPlp muda o Status da PLP
+	AtualizaEstadoPlp(ctx context.Context, id int, status int) error
+	// BuscaPlp devolve a PLP, com os objetos, ou ErrPlpNaoCadastrada
+	BuscaPlp(ctx context.Context, id int) (*Plp, error)
+	// ListaPlps devolve as PLPs do cliente, sem os objetos
+	ListaPlps(ctx context.Context, cliente int) ([]*Plp, error)
+}
+
+// repositorioPadrao repositório usado por ObjetoJSON.Valida, definido por IniDb
+var (
+	muRepositorio     sync.RWMutex
+	repositorioPadrao ObjetoRepository
+)
+
+// DefineRepositorio substitui o repositório usado por ObjetoJSON.Valida
+func DefineRepositorio(r ObjetoRepository) {
+	muRepositorio.Lock()
+	repositorioPadrao = r
+	muRepositorio.Unlock()
+}
+
+func repositorio() (ObjetoRepository, error) {
+	muRepositorio.RLock()
+	defer muRepositorio.RUnlock()
+	if repositorioPadrao == nil {
+		return nil, ErrBancoNaoIniciado
+	}
+	return repositorioPadrao, nil
+}
+
+// etiquetaSemDV etiqueta como gravada no banco, sem o dígito verificador
+func etiquetaSemDV(etiqueta string) string {
+	etiqueta = strings.Replace(etiqueta, " ", "", -1)
+	if len(etiqueta) == 13 {
+		return etiqueta[:10] + etiqueta[11:]
+	}
+	return etiqueta
+}
+
+// xmlObjeto elemento objeto_postal do objeto, como gravado no banco
+func xmlObjeto(o *Objeto) (string, error) {
+	var b strings.Builder
+	e := &escritorXML{w: bufio.NewWriter(&b)}
+	o.escreveXML(e)
+	if e.err != nil {
+		return "", e.err
+	}
+	if err := e.w.Flush(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// objetoDeXML lê o elemento objeto_postal gravado por xmlObjeto
+func objetoDeXML(s string) (*Objeto, error) {
+	o := &Objeto{}
+	if err := decodificaUTF8([]byte(s), o); err != nil {
+		return nil, err
+	}
+	aparaTextos(reflect.ValueOf(o))
+	return o, nil
+}
+
+// xmlCabecalho XML da PLP sem os objetos, que são gravados à parte
+func xmlCabecalho(p *Plp) (string, error) {
+	c := *p
+	c.Objetos = nil
+	return c.XML()
+}
+
+// plpDeXML lê o XML gravado por xmlCabecalho
+func plpDeXML(s string) (*Plp, error) {
+	p := &Plp{}
+	if err := decodificaUTF8([]byte(s), p); err != nil {
+		return nil, err
+	}
+	aparaTextos(reflect.ValueOf(p))
+	return p, nil
+}
+
+// MemoryRepository repositório de objetos e PLPs em memória, para testes
+type MemoryRepository struct {
+	mu      sync.Mutex
+	objetos map[string]*registroObjeto
+	plps    map[int]*registroPlp
+}
+
+type registroObjeto struct {
+	plp      int
+	xml      string
+	inclusao time.Time
+	estado   EstadoObjeto
+}
+
+type registroPlp struct {
+	cabecalho Plp
+	xml       string
+}
+
+// NewMemoryRepository cria um MemoryRepository vazio
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		objetos: make(map[string]*registroObjeto),
+		plps:    make(map[int]*registroPlp),
+	}
+}
+
+// InsereObjeto cadastra o objeto na PLP de número plp
+func (r *MemoryRepository) InsereObjeto(ctx context.Context, plp int, o *Objeto) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	inclusao, err := r.insereObjeto(plp, o)
+	if err != nil {
+		return err
+	}
+	o.Inclusao = inclusao
+	return nil
+}
+
+// insereObjeto grava o objeto e devolve a data de inclusão gravada, sem alterar o
+func (r *MemoryRepository) insereObjeto(plp int, o *Objeto) (time.Time, error) {
+	etiqueta := etiquetaSemDV(o.NumeroEtiqueta)
+	if _, ok := r.objetos[etiqueta]; ok {
+		return time.Time{}, fmt.Errorf("plp insereobjeto: objeto %s já cadastrado", o.NumeroEtiqueta)
+	}
+	x, err := xmlObjeto(o)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("plp insereobjeto: %w", err)
+	}
+	inclusao := o.Inclusao
+	if inclusao.IsZero() {
+		inclusao = time.Now()
+	}
+	r.objetos[etiqueta] = &registroObjeto{plp: plp, xml: x, inclusao: inclusao, estado: o.Estado()}
+	return inclusao, nil
+}
+
+// AtualizaEstadoObjeto muda o estado do objeto de para para pela MaquinaEstadosPadrao
+func (r *MemoryRepository) AtualizaEstadoObjeto(ctx context.Context, etiqueta string, de, para EstadoObjeto) error {
+	r.mu.Lock()
+	reg, ok := r.objetos[etiquetaSemDV(etiqueta)]
+	if !ok {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrObjetoNaoEncontrado, etiqueta)
+	}
+	o, err := reg.objeto()
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if o.Estado() != de {
+		return fmt.Errorf("%w: %s está %s", ErrEstadoObjetoAlterado, etiqueta, o.Estado())
+	}
+	return maquinaPadrao.muda(o, para, func() error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if reg.estado != de {
+			return fmt.Errorf("%w: %s está %s", ErrEstadoObjetoAlterado, etiqueta, reg.estado)
+		}
+		reg.estado = para
+		return nil
+	})
+}
+
+// BuscaObjeto devolve o objeto da etiqueta
+func (r *MemoryRepository) BuscaObjeto(ctx context.Context, etiqueta string) (*Objeto, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg, ok := r.objetos[etiquetaSemDV(etiqueta)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrObjetoNaoEncontrado, etiqueta)
+	}
+	return reg.objeto()
+}
+
+// BuscaEstadoObjeto devolve o estado do objeto da etiqueta
+func (r *MemoryRepository) BuscaEstadoObjeto(ctx context.Context, etiqueta string) (EstadoObjeto, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg, ok := r.objetos[etiquetaSemDV(etiqueta)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrObjetoNaoEncontrado, etiqueta)
+	}
+	return reg.estado, nil
+}
+
+// ListaObjetos devolve os objetos da PLP de número plp, na ordem de inclusão
+func (r *MemoryRepository) ListaObjetos(ctx context.Context, plp int) ([]*Objeto, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.listaObjetos(plp)
+}
+
+func (r *MemoryRepository) listaObjetos(plp int) ([]*Objeto, error) {
+	var objetos []*Objeto
+	for _, reg := range r.objetos {
+		if reg.plp != plp {
+			continue
+		}
+		o, err := reg.objeto()
+		if err != nil {
+			return nil, err
+		}
+		objetos = append(objetos, o)
+	}
+	sort.Slice(objetos, func(i, j int) bool {
+		if !objetos[i].Inclusao.Equal(objetos[j].Inclusao) {
+			return objetos[i].Inclusao.Before(objetos[j].Inclusao)
+		}
+		return objetos[i].NumeroEtiqueta < objetos[j].NumeroEtiqueta
+	})
+	return objetos, nil
+}
+
+func (reg *registroObjeto) objeto() (*Objeto, error) {
+	o, err := objetoDeXML(reg.xml)
+	if err != nil {
+		return nil, fmt.Errorf("plp buscaobjeto: %w", err)
+	}
+	o.Inclusao = reg.inclusao
+	o.StatusTabela = int(reg.estado)
+	return o, nil
+}
+
+// InserePlp cadastra a PLP e seus objetos. Nada é gravado se algum objeto falhar.
+func (r *MemoryRepository) InserePlp(ctx context.Context, p *Plp) error {
+	if p.ID == 0 {
+		return ErrPlpSemNumero
+	}
+	x, err := xmlCabecalho(p)
+	if err != nil {
+		return fmt.Errorf("plp insereplp: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.plps[p.ID]; ok {
+		return fmt.Errorf("plp insereplp: PLP %d já cadastrada", p.ID)
+	}
+	inclusoes := make([]time.Time, len(p.Objetos))
+	for i, o := range p.Objetos {
+		if inclusoes[i], err = r.insereObjeto(p.ID, o); err != nil {
+			for _, inserido := range p.Objetos[:i] {
+				delete(r.objetos, etiquetaSemDV(inserido.NumeroEtiqueta))
+			}
+			return err
+		}
+	}
+	for i, o := range p.Objetos {
+		o.Inclusao = inclusoes[i]
+	}
+	cab := *p
+	cab.Objetos = nil
+	r.plps[p.ID] = &registroPlp{cabecalho: cab, xml: x}
+	return nil
+}
+
+// SalvaPlp insere ou atualiza a PLP e seus objetos. Objetos da PLP já cadastrados
+// e ausentes de p.Objetos não são alterados; objetos cadastrados em outra PLP
+// devolvem ErrObjetoEmOutraPlp, sem gravar nada.
+func (r *MemoryRepository) SalvaPlp(ctx context.Context, p *Plp) error {
+	if p.ID == 0 {
+		return ErrPlpSemNumero
+	}
+	x, err := xmlCabecalho(p)
+	if err != nil {
+		return fmt.Errorf("plp salvaplp: %w", err)
+	}
+	objetos := make(map[string]*registroObjeto, len(p.Objetos))
+	for _, o := range p.Objetos {
+		ox, err := xmlObjeto(o)
+		if err != nil {
+			return fmt.Errorf("plp salvaplp: %w", err)
+		}
+		etiqueta := etiquetaSemDV(o.NumeroEtiqueta)
+		objetos[etiqueta] = &registroObjeto{plp: p.ID, xml: ox, inclusao: o.Inclusao, estado: o.Estado()}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for etiqueta := range objetos {
+		if atual, ok := r.objetos[etiqueta]; ok && atual.plp != p.ID {
+			return fmt.Errorf("plp salvaplp: %w: %s na PLP %d", ErrObjetoEmOutraPlp, etiqueta, atual.plp)
+		}
+	}
+	for etiqueta, reg := range objetos {
+		if atual, ok := r.objetos[etiqueta]; ok {
+			reg.inclusao = atual.inclusao
+		} else if reg.inclusao.IsZero() {
+			reg.inclusao = time.Now()
+		}
+		r.objetos[etiqueta] = reg
+	}
+	for _, o := range p.Objetos {
+		o.Inclusao = r.objetos[etiquetaSemDV(o.NumeroEtiqueta)].inclusao
+	}
+	cab := *p
+	cab.Objetos = nil
+	r.plps[p.ID] = &registroPlp{cabecalho: cab, xml: x}
+	return nil
+}
+
+// AtualizaEstadoPlp muda o Status da PLP
+func (r *MemoryRepository) AtualizaEstadoPlp(ctx context.Context, id int, status int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg, ok := r.plps[id]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrPlpNaoCadastrada, id)
+	}
+	reg.cabecalho.Status = status
+	return nil
+}
+
+// BuscaPlp devolve a PLP com os objetos
+func (r *MemoryRepository) BuscaPlp(ctx context.Context, id int) (*Plp, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg, ok := r.plps[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrPlpNaoCadastrada, id)
+	}
+	p, err := reg.plp()
+	if err != nil {
+		return nil, err
+	}
+	if p.Objetos, err = r.listaObjetos(id); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ListaPlps devolve as PLPs do cliente, sem os objetos, em ordem de ID
+func (r *MemoryRepository) ListaPlps(ctx context.Context, cliente int) ([]*Plp, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var plps []*Plp
+	for _, reg := range r.plps {
+		if reg.cabecalho.NumeroCliente != cliente {
+			continue
+		}
+		p, err := reg.plp()
+		if err != nil {
+			return nil, err
+		}
+		plps = append(plps, p)
+	}
+	sort.Slice(plps, func(i, j int) bool { return plps[i].ID < plps[j].ID })
+	return plps, nil
+}
+
+func (reg *registroPlp) plp() (*Plp, error) {
+	p, err := plpDeXML(reg.xml)
+	if err != nil {
+		return nil, fmt.Errorf("plp buscaplp: %w", err)
+	}
+	c := &reg.cabecalho
+	p.ID = c.ID
+	p.Status = c.Status
+	p.NumeroCliente = c.NumeroCliente
+	p.Postagem = c.Postagem
+	p.PostagemSara = c.PostagemSara
+	p.Fechamento = c.Fechamento
+	p.AtualizacaoCliente = c.AtualizacaoCliente
+	return p, nil
+}
@@ -0,0 +1,475 @@
+package plp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SQLRepository repositório de objetos e PLPs nas tabelas NEP_OBJETO_POSTAL e
+// NEP_PLP, criadas por Migra, em qualquer banco com um Dialeto:
+//
+//	NEP_OBJETO_POSTAL: OBJ_NU_ETIQUETA (sem o dígito verificador), PLP_NU,
+//	  OBJ_DT_INCLUSAO, OBJ_IN_STATUS e OBJ_TX_XML (elemento objeto_postal, nulo
+//	  nos objetos gravados antes do SQLRepository)
+//	NEP_PLP: PLP_NU, PLP_NU_SIGEP, PLP_NU_CLIENTE, PLP_IN_STATUS, PLP_DT_POSTAGEM,
+//	  PLP_DT_POSTAGEM_SARA, PLP_DT_FECHAMENTO, PLP_DT_ATUALIZACAO_CLIENTE e
+//	  PLP_TX_XML (documento correioslog sem os objetos)
+//
+// BuscaEstadoObjeto, usado por ObjetoJSON.Valida, lê apenas OBJ_NU_ETIQUETA e
+// OBJ_IN_STATUS e funciona nas bases Oracle anteriores a Migra; as demais
+// operações exigem as colunas criadas por Migra.
+type SQLRepository struct {
+	db      *sql.DB
+	dialeto Dialeto
+}
+
+// NewSQLRepository cria um SQLRepository sobre a conexão db no dialeto informado
+func NewSQLRepository(db *sql.DB, d Dialeto) *SQLRepository {
+	return &SQLRepository{db: db, dialeto: d}
+}
+
+// NewOracleRepository cria um SQLRepository sobre a conexão Oracle db, como a aberta por IniDb
+func NewOracleRepository(db *sql.DB) *SQLRepository {
+	return NewSQLRepository(db, Oracle)
+}
+
+// executor operações comuns a *sql.DB e *sql.Tx
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// InsereObjeto cadastra o objeto na PLP de número plp
+func (r *SQLRepository) InsereObjeto(ctx context.Context, plp int, o *Objeto) error {
+	inclusao, err := r.insereObjeto(ctx, r.db, plp, o)
+	if err != nil {
+		return err
+	}
+	o.Inclusao = inclusao
+	return nil
+}
+
+// insereObjeto grava o objeto e devolve a data de inclusão gravada, sem alterar
+// o, que só recebe a data depois de confirmada a transação
+func (r *SQLRepository) insereObjeto(ctx context.Context, ex executor, plp int, o *Objeto) (time.Time, error) {
+	x, err := xmlObjeto(o)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("plp insereobjeto: %w", err)
+	}
+	inclusao := o.Inclusao
+	if inclusao.IsZero() {
+		inclusao = time.Now()
+	}
+	query := `
+		INSERT INTO NEP_OBJETO_POSTAL
+		(OBJ_NU_ETIQUETA, PLP_NU, OBJ_DT_INCLUSAO, OBJ_IN_STATUS, OBJ_TX_XML)
+		VALUES
+		(?, ?, @data(?), ?, ?)
+	`
+	_, err = ex.ExecContext(ctx, traduz(r.dialeto, query),
+		etiquetaSemDV(o.NumeroEtiqueta), plp, dataOuNulo(r.dialeto, inclusao), o.StatusTabela, x)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("plp insereobjeto: %w", err)
+	}
+	return inclusao, nil
+}
+
+// AtualizaEstadoObjeto muda o estado do objeto de para para pela MaquinaEstadosPadrao
+func (r *SQLRepository) AtualizaEstadoObjeto(ctx context.Context, etiqueta string, de, para EstadoObjeto) error {
+	o, err := r.BuscaObjeto(ctx, etiqueta)
+	if err != nil {
+		return err
+	}
+	if o.Estado() != de {
+		return fmt.Errorf("%w: %s está %s", ErrEstadoObjetoAlterado, etiqueta, o.Estado())
+	}
+	return maquinaPadrao.muda(o, para, func() error {
+		query := `
+			UPDATE NEP_OBJETO_POSTAL SET OBJ_IN_STATUS = ?
+			WHERE OBJ_NU_ETIQUETA = ? AND OBJ_IN_STATUS = ?
+		`
+		res, err := r.db.ExecContext(ctx, traduz(r.dialeto, query), int(para), etiquetaSemDV(etiqueta), int(de))
+		if err != nil {
+			return fmt.Errorf("plp atualizaestadoobjeto: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("plp atualizaestadoobjeto: %w", err)
+		}
+		if n == 0 {
+			return fmt.Errorf("%w: %s não está mais %s", ErrEstadoObjetoAlterado, etiqueta, de)
+		}
+		return nil
+	})
+}
+
+// BuscaObjeto devolve o objeto da etiqueta
+func (r *SQLRepository) BuscaObjeto(ctx context.Context, etiqueta string) (*Objeto, error) {
+	query := `
+		SELECT OBJ_NU_ETIQUETA, @texto(OBJ_DT_INCLUSAO), OBJ_IN_STATUS, OBJ_TX_XML
+		FROM NEP_OBJETO_POSTAL
+		WHERE OBJ_NU_ETIQUETA = ?
+	`
+	o, err := r.escaneiaObjeto(r.db.QueryRowContext(ctx, traduz(r.dialeto, query), etiquetaSemDV(etiqueta)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrObjetoNaoEncontrado, etiqueta)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("plp buscaobjeto: %w", err)
+	}
+	return o, nil
+}
+
+// ListaObjetos devolve os objetos da PLP de número plp, na ordem de inclusão
+func (r *SQLRepository) ListaObjetos(ctx context.Context, plp int) ([]*Objeto, error) {
+	return r.listaObjetos(ctx, r.db, plp)
+}
+
+func (r *SQLRepository) listaObjetos(ctx context.Context, ex executor, plp int) ([]*Objeto, error) {
+	query := `
+		SELECT OBJ_NU_ETIQUETA, @texto(OBJ_DT_INCLUSAO), OBJ_IN_STATUS, OBJ_TX_XML
+		FROM NEP_OBJETO_POSTAL
+		WHERE PLP_NU = ?
+		ORDER BY OBJ_DT_INCLUSAO, OBJ_NU_ETIQUETA
+	`
+	rows, err := ex.QueryContext(ctx, traduz(r.dialeto, query), plp)
+	if err != nil {
+		return nil, fmt.Errorf("plp listaobjetos: %w", err)
+	}
+	defer rows.Close()
+	var objetos []*Objeto
+	for rows.Next() {
+		o, err := r.escaneiaObjeto(rows)
+		if err != nil {
+			return nil, fmt.Errorf("plp listaobjetos: %w", err)
+		}
+		objetos = append(objetos, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("plp listaobjetos: %w", err)
+	}
+	return objetos, nil
+}
+
+// linha *sql.Row ou *sql.Rows
+type linha interface {
+	Scan(dest ...interface{}) error
+}
+
+// escaneiaObjeto lê o objeto da linha. Objetos sem OBJ_TX_XML, gravados antes
+// do SQLRepository, têm apenas a etiqueta, a inclusão e o estado.
+func (r *SQLRepository) escaneiaObjeto(l linha) (*Objeto, error) {
+	var (
+		etiqueta string
+		inclusao sql.NullString
+		status   sql.NullInt64
+		x        sql.NullString
+	)
+	if err := l.Scan(&etiqueta, &inclusao, &status, &x); err != nil {
+		return nil, err
+	}
+	o := &Objeto{NumeroEtiqueta: etiqueta}
+	var err error
+	if x.Valid && x.String != "" {
+		if o, err = objetoDeXML(x.String); err != nil {
+			return nil, err
+		}
+	} else if dv, err := EtiquetaDV(etiqueta); err == nil {
+		o.NumeroEtiqueta = dv
+	}
+	if o.Inclusao, err = leData(r.dialeto, inclusao); err != nil {
+		return nil, err
+	}
+	o.StatusTabela = int(status.Int64)
+	return o, nil
+}
+
+// BuscaEstadoObjeto devolve o estado do objeto da etiqueta, ou ErrObjetoNaoEncontrado
+func (r *SQLRepository) BuscaEstadoObjeto(ctx context.Context, etiqueta string) (EstadoObjeto, error) {
+	query := `SELECT OBJ_IN_STATUS FROM NEP_OBJETO_POSTAL WHERE OBJ_NU_ETIQUETA = ?`
+	var status sql.NullInt64
+	err := r.db.QueryRowContext(ctx, traduz(r.dialeto, query), etiquetaSemDV(etiqueta)).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %s", ErrObjetoNaoEncontrado, etiqueta)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("plp buscaestadoobjeto: %w", err)
+	}
+	return EstadoObjeto(status.Int64), nil
+}
+
+// InserePlp cadastra a PLP e seus objetos em uma transação
+func (r *SQLRepository) InserePlp(ctx context.Context, p *Plp) error {
+	if p.ID == 0 {
+		return ErrPlpSemNumero
+	}
+	x, err := xmlCabecalho(p)
+	if err != nil {
+		return fmt.Errorf("plp insereplp: %w", err)
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("plp insereplp: %w", err)
+	}
+	defer tx.Rollback()
+	if err := r.insereCabecalho(ctx, tx, p, x); err != nil {
+		return fmt.Errorf("plp insereplp: %w", err)
+	}
+	inclusoes := make([]time.Time, len(p.Objetos))
+	for i, o := range p.Objetos {
+		if inclusoes[i], err = r.insereObjeto(ctx, tx, p.ID, o); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("plp insereplp: %w", err)
+	}
+	for i, o := range p.Objetos {
+		o.Inclusao = inclusoes[i]
+	}
+	return nil
+}
+
+// SalvaPlp grava a PLP e seus objetos em uma transação, veja SavePlp
+func (r *SQLRepository) SalvaPlp(ctx context.Context, p *Plp) error {
+	return r.SavePlp(ctx, nil, p)
+}
+
+// SavePlp insere ou atualiza o cabeçalho da PLP e todos os seus objetos, gravando
+// as datas Postagem, PostagemSara, Fechamento e AtualizacaoCliente da PLP. Com tx
+// nil, abre uma transação própria, desfeita em caso de falha; caso contrário usa
+// tx, cabendo ao chamador confirmar ou desfazer. Objetos da PLP já cadastrados e
+// ausentes de p.Objetos não são alterados; objetos cadastrados em outra PLP
+// devolvem ErrObjetoEmOutraPlp. A data de inclusão dos objetos inseridos só é
+// copiada para p.Objetos quando SavePlp termina sem erro.
+func (r *SQLRepository) SavePlp(ctx context.Context, tx *sql.Tx, p *Plp) error {
+	if p.ID == 0 {
+		return ErrPlpSemNumero
+	}
+	x, err := xmlCabecalho(p)
+	if err != nil {
+		return fmt.Errorf("plp saveplp: %w", err)
+	}
+	propria := tx == nil
+	if propria {
+		if tx, err = r.db.BeginTx(ctx, nil); err != nil {
+			return fmt.Errorf("plp saveplp: %w", err)
+		}
+		defer tx.Rollback()
+	}
+	query := `
+		UPDATE NEP_PLP SET
+		PLP_NU_SIGEP = ?, PLP_NU_CLIENTE = ?, PLP_IN_STATUS = ?,
+		PLP_DT_POSTAGEM = @data(?),
+		PLP_DT_POSTAGEM_SARA = @data(?),
+		PLP_DT_FECHAMENTO = @data(?),
+		PLP_DT_ATUALIZACAO_CLIENTE = @data(?),
+		PLP_TX_XML = ?
+		WHERE PLP_NU = ?
+	`
+	res, err := tx.ExecContext(ctx, traduz(r.dialeto, query), p.Plp.IDPlp, p.NumeroCliente, p.Status,
+		dataOuNulo(r.dialeto, p.Postagem), dataOuNulo(r.dialeto, p.PostagemSara),
+		dataOuNulo(r.dialeto, p.Fechamento), dataOuNulo(r.dialeto, p.AtualizacaoCliente), x, p.ID)
+	if err != nil {
+		return fmt.Errorf("plp saveplp: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("plp saveplp: %w", err)
+	}
+	if n == 0 {
+		// PLP não cadastrada ou, nos bancos que só contam as linhas modificadas,
+		// gravada sem mudanças
+		cadastrada, err := r.plpCadastrada(ctx, tx, p.ID)
+		if err != nil {
+			return fmt.Errorf("plp saveplp: %w", err)
+		}
+		if !cadastrada {
+			if err := r.insereCabecalho(ctx, tx, p, x); err != nil {
+				return fmt.Errorf("plp saveplp: %w", err)
+			}
+		}
+	}
+	inclusoes := make([]time.Time, len(p.Objetos))
+	for i, o := range p.Objetos {
+		if inclusoes[i], err = r.salvaObjeto(ctx, tx, p.ID, o); err != nil {
+			return fmt.Errorf("plp saveplp: %w", err)
+		}
+	}
+	if propria {
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("plp saveplp: %w", err)
+		}
+	}
+	for i, o := range p.Objetos {
+		if !inclusoes[i].IsZero() {
+			o.Inclusao = inclusoes[i]
+		}
+	}
+	return nil
+}
+
+// salvaObjeto atualiza o objeto da PLP plp, ou o insere quando não cadastrado,
+// devolvendo a data de inclusão quando inserido. Objetos de outra PLP devolvem
+// ErrObjetoEmOutraPlp.
+func (r *SQLRepository) salvaObjeto(ctx context.Context, ex executor, plp int, o *Objeto) (time.Time, error) {
+	x, err := xmlObjeto(o)
+	if err != nil {
+		return time.Time{}, err
+	}
+	etiqueta := etiquetaSemDV(o.NumeroEtiqueta)
+	query := `
+		UPDATE NEP_OBJETO_POSTAL SET OBJ_IN_STATUS = ?, OBJ_TX_XML = ?
+		WHERE OBJ_NU_ETIQUETA = ? AND PLP_NU = ?
+	`
+	res, err := ex.ExecContext(ctx, traduz(r.dialeto, query), o.StatusTabela, x, etiqueta, plp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if n > 0 {
+		return time.Time{}, nil
+	}
+	// nenhuma linha alterada: objeto não cadastrado, de outra PLP ou, nos bancos
+	// que só contam as linhas modificadas, gravado sem mudanças
+	var atual int
+	err = ex.QueryRowContext(ctx, traduz(r.dialeto, `SELECT PLP_NU FROM NEP_OBJETO_POSTAL WHERE OBJ_NU_ETIQUETA = ?`), etiqueta).Scan(&atual)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return r.insereObjeto(ctx, ex, plp, o)
+	case err != nil:
+		return time.Time{}, err
+	case atual != plp:
+		return time.Time{}, fmt.Errorf("%w: %s na PLP %d", ErrObjetoEmOutraPlp, o.NumeroEtiqueta, atual)
+	}
+	return time.Time{}, nil
+}
+
+// insereCabecalho insere a linha da PLP em NEP_PLP, com o XML x do cabeçalho
+func (r *SQLRepository) insereCabecalho(ctx context.Context, ex executor, p *Plp, x string) error {
+	query := `
+		INSERT INTO NEP_PLP
+		(PLP_NU, PLP_NU_SIGEP, PLP_NU_CLIENTE, PLP_IN_STATUS, PLP_DT_POSTAGEM,
+		PLP_DT_POSTAGEM_SARA, PLP_DT_FECHAMENTO, PLP_DT_ATUALIZACAO_CLIENTE, PLP_TX_XML)
+		VALUES
+		(?, ?, ?, ?, @data(?), @data(?), @data(?), @data(?), ?)
+	`
+	_, err := ex.ExecContext(ctx, traduz(r.dialeto, query), p.ID, p.Plp.IDPlp, p.NumeroCliente, p.Status,
+		dataOuNulo(r.dialeto, p.Postagem), dataOuNulo(r.dialeto, p.PostagemSara),
+		dataOuNulo(r.dialeto, p.Fechamento), dataOuNulo(r.dialeto, p.AtualizacaoCliente), x)
+	return err
+}
+
+// AtualizaEstadoPlp muda o Status da PLP
+func (r *SQLRepository) AtualizaEstadoPlp(ctx context.Context, id int, status int) error {
+	res, err := r.db.ExecContext(ctx, traduz(r.dialeto, `UPDATE NEP_PLP SET PLP_IN_STATUS = ? WHERE PLP_NU = ?`), status, id)
+	if err != nil {
+		return fmt.Errorf("plp atualizaestadoplp: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("plp atualizaestadoplp: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+	cadastrada, err := r.plpCadastrada(ctx, r.db, id)
+	if err != nil {
+		return fmt.Errorf("plp atualizaestadoplp: %w", err)
+	}
+	if !cadastrada {
+		return fmt.Errorf("%w: %d", ErrPlpNaoCadastrada, id)
+	}
+	return nil
+}
+
+// plpCadastrada indica se a PLP id está em NEP_PLP
+func (r *SQLRepository) plpCadastrada(ctx context.Context, ex executor, id int) (bool, error) {
+	var n int
+	err := ex.QueryRowContext(ctx, traduz(r.dialeto, `SELECT PLP_NU FROM NEP_PLP WHERE PLP_NU = ?`), id).Scan(&n)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// colunasPlp colunas lidas por escaneiaPlp
+const colunasPlp = `PLP_NU, PLP_NU_CLIENTE, PLP_IN_STATUS,
+		@texto(PLP_DT_POSTAGEM), @texto(PLP_DT_POSTAGEM_SARA),
+		@texto(PLP_DT_FECHAMENTO), @texto(PLP_DT_ATUALIZACAO_CLIENTE),
+		PLP_TX_XML`
+
+// BuscaPlp devolve a PLP com os objetos
+func (r *SQLRepository) BuscaPlp(ctx context.Context, id int) (*Plp, error) {
+	query := `SELECT ` + colunasPlp + ` FROM NEP_PLP WHERE PLP_NU = ?`
+	p, err := r.escaneiaPlp(r.db.QueryRowContext(ctx, traduz(r.dialeto, query), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrPlpNaoCadastrada, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("plp buscaplp: %w", err)
+	}
+	if p.Objetos, err = r.listaObjetos(ctx, r.db, id); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ListaPlps devolve as PLPs do cliente, sem os objetos, em ordem de ID
+func (r *SQLRepository) ListaPlps(ctx context.Context, cliente int) ([]*Plp, error) {
+	query := `SELECT ` + colunasPlp + ` FROM NEP_PLP WHERE PLP_NU_CLIENTE = ? ORDER BY PLP_NU`
+	rows, err := r.db.QueryContext(ctx, traduz(r.dialeto, query), cliente)
+	if err != nil {
+		return nil, fmt.Errorf("plp listaplps: %w", err)
+	}
+	defer rows.Close()
+	var plps []*Plp
+	for rows.Next() {
+		p, err := r.escaneiaPlp(rows)
+		if err != nil {
+			return nil, fmt.Errorf("plp listaplps: %w", err)
+		}
+		plps = append(plps, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("plp listaplps: %w", err)
+	}
+	return plps, nil
+}
+
+func (r *SQLRepository) escaneiaPlp(l linha) (*Plp, error) {
+	var (
+		id, cliente, status                             int
+		postagem, postagemSara, fechamento, atualizacao sql.NullString
+		x                                               string
+	)
+	if err := l.Scan(&id, &cliente, &status, &postagem, &postagemSara, &fechamento, &atualizacao, &x); err != nil {
+		return nil, err
+	}
+	p, err := plpDeXML(x)
+	if err != nil {
+		return nil, err
+	}
+	p.ID, p.NumeroCliente, p.Status = id, cliente, status
+	for _, d := range []struct {
+		destino *time.Time
+		valor   sql.NullString
+	}{
+		{&p.Postagem, postagem},
+		{&p.PostagemSara, postagemSara},
+		{&p.Fechamento, fechamento},
+		{&p.AtualizacaoCliente, atualizacao},
+	} {
+		if *d.destino, err = leData(r.dialeto, d.valor); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,144 @@
+package plp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// bancoSQLite banco SQLite em memória, fechado ao fim do teste
+func bancoSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cada conexão teria o seu próprio banco em memória
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// esquemaLegado NEP_OBJETO_POSTAL como nas bases anteriores ao SQLRepository
+const esquemaLegado = `CREATE TABLE NEP_OBJETO_POSTAL (
+	OBJ_NU_ETIQUETA TEXT NOT NULL PRIMARY KEY,
+	PLP_NU INTEGER NOT NULL,
+	OBJ_DT_INCLUSAO TEXT NOT NULL,
+	OBJ_IN_STATUS INTEGER DEFAULT 0 NOT NULL
+)`
+
+func TestValidaEsquemaLegado(t *testing.T) {
+	defer isolaRepositorio()()
+	db := bancoSQLite(t)
+	if _, err := db.Exec(esquemaLegado); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.Exec(`INSERT INTO NEP_OBJETO_POSTAL VALUES ('SZ00000001BR', 1, '2020-01-02 10:00:00', 1), ('SZ00000002BR', 1, '2020-01-02 10:00:00', 0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	DefineRepositorio(NewSQLRepository(db, SQLite))
+
+	if err := (&ObjetoJSON{Etiqueta: "SZ000000014BR"}).Valida(); err != ErrObjetoPostado {
+		t.Errorf("Valida de objeto postado = %v, esperado ErrObjetoPostado", err)
+	}
+	if err := (&ObjetoJSON{Etiqueta: "SZ000000028BR"}).Valida(); err != nil {
+		t.Errorf("Valida de objeto em aberto = %v", err)
+	}
+	if err := (&ObjetoJSON{Etiqueta: "SZ000000032BR"}).Valida(); err != nil {
+		t.Errorf("Valida de objeto não cadastrado = %v", err)
+	}
+}
+
+func TestBuscaObjetoLegadoSemXML(t *testing.T) {
+	db := bancoSQLite(t)
+	if _, err := db.Exec(esquemaLegado); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO NEP_OBJETO_POSTAL VALUES ('SZ00000001BR', 1, '2020-01-02 10:00:00', 1)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`ALTER TABLE NEP_OBJETO_POSTAL ADD COLUMN OBJ_TX_XML TEXT`); err != nil {
+		t.Fatal(err)
+	}
+	o, err := NewSQLRepository(db, SQLite).BuscaObjeto(context.Background(), "SZ00000001BR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.NumeroEtiqueta != "SZ000000014BR" || o.Estado() != EstadoObjetoPostado || o.Inclusao.IsZero() {
+		t.Errorf("objeto legado = %+v", o)
+	}
+}
+
+func TestMigracoesOracleIdempotentes(t *testing.T) {
+	for i, m := range Oracle.Migracoes() {
+		if !strings.HasPrefix(m, "BEGIN\n\tEXECUTE IMMEDIATE '") || !strings.HasSuffix(m, "END;") {
+			t.Errorf("migração %d não ignora objetos existentes:\n%s", i+1, m)
+		}
+		if strings.Contains(m, "ALTER TABLE") && !strings.Contains(m, "SQLCODE != -1430") {
+			t.Errorf("migração %d não ignora colunas existentes:\n%s", i+1, m)
+		}
+	}
+	colunas := []string{"OBJ_IN_STATUS", "OBJ_TX_XML", "PLP_TX_XML"}
+	for _, c := range colunas {
+		encontrada := false
+		for _, m := range Oracle.Migracoes() {
+			if strings.Contains(m, "ADD ("+c+" ") {
+				encontrada = true
+			}
+		}
+		if !encontrada {
+			t.Errorf("nenhuma migração acrescenta %s a esquemas existentes", c)
+		}
+	}
+	if _, err := NewSQLRepository(bancoSQLite(t), SQLite).BuscaEstadoObjeto(context.Background(), "SZ000000014BR"); err == nil || errors.Is(err, ErrObjetoNaoEncontrado) {
+		t.Errorf("BuscaEstadoObjeto sem a tabela = %v, esperado erro do banco", err)
+	}
+}
+
+// contaSoModificadas faz o SQLite, como o MySQL, não contar em RowsAffected as
+// linhas de NEP_PLP regravadas sem mudanças
+const contaSoModificadas = `CREATE TRIGGER NEP_PLP_INALTERADA BEFORE UPDATE ON NEP_PLP
+	WHEN NEW.PLP_NU_SIGEP IS OLD.PLP_NU_SIGEP AND NEW.PLP_NU_CLIENTE IS OLD.PLP_NU_CLIENTE
+	AND NEW.PLP_IN_STATUS IS OLD.PLP_IN_STATUS AND NEW.PLP_DT_POSTAGEM IS OLD.PLP_DT_POSTAGEM
+	AND NEW.PLP_DT_POSTAGEM_SARA IS OLD.PLP_DT_POSTAGEM_SARA AND NEW.PLP_DT_FECHAMENTO IS OLD.PLP_DT_FECHAMENTO
+	AND NEW.PLP_DT_ATUALIZACAO_CLIENTE IS OLD.PLP_DT_ATUALIZACAO_CLIENTE AND NEW.PLP_TX_XML IS OLD.PLP_TX_XML
+	BEGIN SELECT RAISE(IGNORE); END`
+
+func TestSQLRepositoryPlpInalterada(t *testing.T) {
+	ctx := context.Background()
+	db := bancoSQLite(t)
+	if err := Migra(ctx, db, SQLite); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(contaSoModificadas); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewSQLRepository(db, SQLite)
+	p := plpTeste(1, "SZ000000014BR")
+	p.Status = 2
+	if err := repo.InserePlp(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	// a primeira gravação muda o status; a segunda não altera nenhuma linha
+	if err := repo.SalvaPlp(ctx, plpTeste(1, "SZ000000014BR", "SZ000000028BR")); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SalvaPlp(ctx, plpTeste(1, "SZ000000014BR", "SZ000000028BR")); err != nil {
+		t.Fatalf("SalvaPlp sem mudanças: %v", err)
+	}
+	if err := repo.AtualizaEstadoPlp(ctx, 1, 0); err != nil {
+		t.Errorf("AtualizaEstadoPlp para o mesmo estado: %v", err)
+	}
+	if err := repo.AtualizaEstadoPlp(ctx, 2, 0); !errors.Is(err, ErrPlpNaoCadastrada) {
+		t.Errorf("AtualizaEstadoPlp de PLP não cadastrada = %v, esperado ErrPlpNaoCadastrada", err)
+	}
+	if n := contaLinhas(t, ctx, db, "SELECT COUNT(*) FROM NEP_OBJETO_POSTAL WHERE PLP_NU = 1"); n != 2 {
+		t.Errorf("%d objetos na PLP, esperado 2", n)
+	}
+}
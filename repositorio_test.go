@@ -0,0 +1,158 @@
+package plp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// repositorioTeste repositório de PLPs e objetos
+type repositorioTeste interface {
+	PlpRepository
+	ObjetoRepository
+}
+
+// repositoriosTeste repositórios vazios: em memória e SQLite migrado
+func repositoriosTeste(t *testing.T) map[string]repositorioTeste {
+	t.Helper()
+	db := bancoSQLite(t)
+	if err := Migra(context.Background(), db, SQLite); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]repositorioTeste{
+		"memoria": NewMemoryRepository(),
+		"sqlite":  NewSQLRepository(db, SQLite),
+	}
+}
+
+// plpTeste PLP de número id com um objeto por etiqueta
+func plpTeste(id int, etiquetas ...string) *Plp {
+	p := &Plp{ID: id, NumeroCliente: 7}
+	p.Plp.IDPlp = id
+	for _, e := range etiquetas {
+		p.Objetos = append(p.Objetos, &Objeto{NumeroEtiqueta: e, CodigoServicoPostagem: "03220"})
+	}
+	return p
+}
+
+func TestRepositorioInserePlp(t *testing.T) {
+	ctx := context.Background()
+	for nome, repo := range repositoriosTeste(t) {
+		t.Run(nome, func(t *testing.T) {
+			p := plpTeste(1, "SZ000000014BR", "SZ000000028BR")
+			if err := repo.InserePlp(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+			for _, o := range p.Objetos {
+				if o.Inclusao.IsZero() {
+					t.Errorf("objeto %s sem data de inclusão", o.NumeroEtiqueta)
+				}
+			}
+			salva, err := repo.BuscaPlp(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if salva.NumeroCliente != 7 || len(salva.Objetos) != 2 {
+				t.Errorf("PLP gravada = %+v", salva)
+			}
+			if err := repo.InserePlp(ctx, plpTeste(1)); err == nil {
+				t.Error("PLP duplicada inserida")
+			}
+		})
+	}
+}
+
+func TestRepositorioInserePlpFalhaNaoAlteraObjetos(t *testing.T) {
+	ctx := context.Background()
+	for nome, repo := range repositoriosTeste(t) {
+		t.Run(nome, func(t *testing.T) {
+			if err := repo.InserePlp(ctx, plpTeste(1, "SZ000000028BR")); err != nil {
+				t.Fatal(err)
+			}
+			p := plpTeste(2, "SZ000000014BR", "SZ000000028BR")
+			if err := repo.InserePlp(ctx, p); err == nil {
+				t.Fatal("PLP com objeto já cadastrado inserida")
+			}
+			for _, o := range p.Objetos {
+				if !o.Inclusao.IsZero() {
+					t.Errorf("objeto %s com data de inclusão após a falha", o.NumeroEtiqueta)
+				}
+			}
+			if _, err := repo.BuscaObjeto(ctx, "SZ000000014BR"); err == nil {
+				t.Error("objeto gravado apesar da falha")
+			}
+			if _, err := repo.BuscaPlp(ctx, 2); !errors.Is(err, ErrPlpNaoCadastrada) {
+				t.Errorf("BuscaPlp = %v, esperado ErrPlpNaoCadastrada", err)
+			}
+		})
+	}
+}
+
+func TestRepositorioSalvaPlp(t *testing.T) {
+	ctx := context.Background()
+	for nome, repo := range repositoriosTeste(t) {
+		t.Run(nome, func(t *testing.T) {
+			inclusao := time.Date(2020, 1, 2, 10, 0, 0, 0, time.Local)
+			p := plpTeste(1, "SZ000000014BR")
+			p.Objetos[0].Inclusao = inclusao
+			if err := repo.InserePlp(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+
+			p = plpTeste(1, "SZ000000014BR", "SZ000000028BR")
+			p.Status = 2
+			p.Objetos[0].StatusTabela = EstadoObjetoPostado
+			if err := repo.SalvaPlp(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Objetos[1].Inclusao.IsZero() {
+				t.Error("objeto inserido sem data de inclusão")
+			}
+			salva, err := repo.BuscaPlp(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if salva.Status != 2 || len(salva.Objetos) != 2 {
+				t.Fatalf("PLP salva = %+v", salva)
+			}
+			o, err := repo.BuscaObjeto(ctx, "SZ000000014BR")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.Estado() != EstadoObjetoPostado || !o.Inclusao.Equal(inclusao) {
+				t.Errorf("objeto atualizado no estado %s, inclusão %s", o.Estado(), o.Inclusao)
+			}
+		})
+	}
+}
+
+func TestRepositorioSalvaPlpObjetoDeOutraPlp(t *testing.T) {
+	ctx := context.Background()
+	for nome, repo := range repositoriosTeste(t) {
+		t.Run(nome, func(t *testing.T) {
+			if err := repo.InserePlp(ctx, plpTeste(1, "SZ000000014BR")); err != nil {
+				t.Fatal(err)
+			}
+			p := plpTeste(2, "SZ000000028BR", "SZ000000014BR")
+			if err := repo.SalvaPlp(ctx, p); !errors.Is(err, ErrObjetoEmOutraPlp) {
+				t.Fatalf("SalvaPlp = %v, esperado ErrObjetoEmOutraPlp", err)
+			}
+			for _, o := range p.Objetos {
+				if !o.Inclusao.IsZero() {
+					t.Errorf("objeto %s com data de inclusão após a falha", o.NumeroEtiqueta)
+				}
+			}
+			objetos, err := repo.ListaObjetos(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(objetos) != 1 || objetos[0].NumeroEtiqueta != "SZ000000014BR" {
+				t.Errorf("objetos da PLP 1 = %+v", objetos)
+			}
+			if _, err := repo.BuscaObjeto(ctx, "SZ000000028BR"); err == nil {
+				t.Error("objeto gravado apesar da falha")
+			}
+		})
+	}
+}
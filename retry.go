@@ -0,0 +1,270 @@
+package plp
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrCircuitoAberto indica que a chamada não foi feita porque o circuito do
+// Client está aberto após falhas consecutivas do SIGEPWEB
+var ErrCircuitoAberto = errors.New("sigep: circuito aberto, serviço indisponível")
+
+// operacoesNaoIdempotentes operações que não podem ser repetidas às cegas: fechar
+// a PLP duas vezes pode gerar PLPs duplicadas e solicitar etiquetas novamente
+// descarta a faixa obtida na tentativa anterior
+var operacoesNaoIdempotentes = map[string]bool{
+	"fechaPlpVariosServicos": true,
+	"solicitaEtiquetas":      true,
+}
+
+// RetryPolicy política de novas tentativas das chamadas ao SIGEPWEB. Campos
+// zerados assumem os valores de DefaultRetryPolicy, exceto Jitter, em que zero
+// indica esperas sem sorteio.
+type RetryPolicy struct {
+	// MaxTentativas número total de tentativas, incluindo a primeira
+	MaxTentativas int
+	// EsperaInicial espera antes da segunda tentativa, dobrada a cada nova tentativa
+	EsperaInicial time.Duration
+	// EsperaMaxima limite da espera entre tentativas
+	EsperaMaxima time.Duration
+	// Jitter fração da espera, entre 0 e 1, sorteada e subtraída a cada tentativa;
+	// zero para sem sorteio. DefaultRetryPolicy usa 0.2.
+	Jitter float64
+	// StatusRetentaveis status HTTP, sem falha SOAP, que permitem nova tentativa
+	StatusRetentaveis []int
+	// Retentavel quando informada, substitui a classificação padrão dos erros
+	Retentavel func(err error) bool
+	// RetentaNaoIdempotentes permite repetir fechaPlpVariosServicos e
+	// solicitaEtiquetas mesmo quando a requisição pode ter chegado ao SIGEPWEB.
+	// Sem ela, essas operações só são repetidas se a conexão nem foi aberta.
+	RetentaNaoIdempotentes bool
+}
+
+// DefaultRetryPolicy devolve a política com três tentativas e espera exponencial
+// a partir de 200ms, repetindo timeouts, erros de rede e status 502, 503 e 504
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxTentativas:     3,
+		EsperaInicial:     200 * time.Millisecond,
+		EsperaMaxima:      5 * time.Second,
+		Jitter:            0.2,
+		StatusRetentaveis: []int{502, 503, 504},
+	}
+}
+
+// normaliza preenche os campos zerados com os valores padrão, mantendo Jitter
+func (p RetryPolicy) normaliza() RetryPolicy {
+	padrao := DefaultRetryPolicy()
+	if p.MaxTentativas <= 0 {
+		p.MaxTentativas = padrao.MaxTentativas
+	}
+	if p.EsperaInicial <= 0 {
+		p.EsperaInicial = padrao.EsperaInicial
+	}
+	if p.EsperaMaxima <= 0 {
+		p.EsperaMaxima = padrao.EsperaMaxima
+	}
+	if p.StatusRetentaveis == nil {
+		p.StatusRetentaveis = padrao.StatusRetentaveis
+	}
+	return p
+}
+
+// retentavel indica se a tentativa da operação que falhou com err pode ser repetida
+func (p RetryPolicy) retentavel(operacao string, err error) bool {
+	if errors.Is(err, ErrCircuitoAberto) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if operacoesNaoIdempotentes[operacao] && !p.RetentaNaoIdempotentes && !erroDeConexao(err) {
+		return false
+	}
+	if p.Retentavel != nil {
+		return p.Retentavel(err)
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		for _, s := range p.StatusRetentaveis {
+			if se.StatusCode == s {
+				return true
+			}
+		}
+		return false
+	}
+	return falhaDeServico(err)
+}
+
+// espera tempo de espera antes da tentativa seguinte à tentativa informada, contada a partir de 1
+func (p RetryPolicy) espera(tentativa int) time.Duration {
+	d := p.EsperaInicial
+	for i := 1; i < tentativa && d < p.EsperaMaxima; i++ {
+		d *= 2
+	}
+	if d > p.EsperaMaxima {
+		d = p.EsperaMaxima
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// erroDeConexao indica que a requisição não chegou a ser enviada porque a conexão
+// com o SIGEPWEB não foi estabelecida
+func erroDeConexao(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+// falhaDeServico indica falhas de infraestrutura do SIGEPWEB, ou seja, timeouts,
+// erros de rede e status HTTP 5xx sem falha SOAP. Falhas SOAP são erros de
+// negócio e não entram nessa conta.
+func falhaDeServico(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrTimeout) {
+		return true
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= 500
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// Estados do CircuitBreaker
+const (
+	circuitoFechado = iota
+	circuitoAberto
+	circuitoMeioAberto
+)
+
+// valores padrão dos campos zerados do CircuitBreaker
+const (
+	limiteFalhasCircuito = 5
+	intervaloCircuito    = 30 * time.Second
+)
+
+// CircuitBreaker interrompe as chamadas ao SIGEPWEB depois de LimiteFalhas
+// falhas de serviço consecutivas, devolvendo ErrCircuitoAberto sem acessar a rede.
+// Após Intervalo, uma única chamada de teste é permitida: se tiver sucesso o
+// circuito fecha, caso contrário volta a abrir. Pode ser compartilhado entre
+// vários Clients que acessam o mesmo endereço.
+type CircuitBreaker struct {
+	// LimiteFalhas falhas consecutivas que abrem o circuito, padrão 5
+	LimiteFalhas int
+	// Intervalo tempo com o circuito aberto antes da chamada de teste, padrão 30s
+	Intervalo time.Duration
+
+	mu       sync.Mutex
+	estado   int
+	falhas   int
+	abertoEm time.Time
+}
+
+// NewCircuitBreaker cria um CircuitBreaker
+func NewCircuitBreaker(limiteFalhas int, intervalo time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{LimiteFalhas: limiteFalhas, Intervalo: intervalo}
+}
+
+// permite indica se a chamada pode ser feita, passando o circuito para meio
+// aberto quando o Intervalo tiver terminado
+func (b *CircuitBreaker) permite() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.estado {
+	case circuitoAberto:
+		if time.Since(b.abertoEm) < b.intervalo() {
+			return ErrCircuitoAberto
+		}
+		b.estado = circuitoMeioAberto
+		return nil
+	case circuitoMeioAberto:
+		// a chamada de teste ainda não terminou
+		return ErrCircuitoAberto
+	}
+	return nil
+}
+
+// registra contabiliza o resultado de uma chamada permitida
+func (b *CircuitBreaker) registra(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if errors.Is(err, context.Canceled) {
+		// chamada cancelada pelo chamador não diz nada sobre o serviço
+		if b.estado == circuitoMeioAberto {
+			b.estado = circuitoAberto
+		}
+		return
+	}
+	if !falhaDeServico(err) {
+		b.estado = circuitoFechado
+		b.falhas = 0
+		return
+	}
+	b.falhas++
+	if b.estado == circuitoMeioAberto || b.falhas >= b.limiteFalhas() {
+		b.estado = circuitoAberto
+		b.abertoEm = time.Now()
+	}
+}
+
+// Aberto indica se o circuito está aberto, recusando as chamadas
+func (b *CircuitBreaker) Aberto() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.estado != circuitoFechado
+}
+
+func (b *CircuitBreaker) limiteFalhas() int {
+	if b.LimiteFalhas <= 0 {
+		return limiteFalhasCircuito
+	}
+	return b.LimiteFalhas
+}
+
+func (b *CircuitBreaker) intervalo() time.Duration {
+	if b.Intervalo <= 0 {
+		return intervaloCircuito
+	}
+	return b.Intervalo
+}
+
+// executa chama tentativa respeitando o CircuitBreaker e a RetryPolicy do Client
+func (c *Client) executa(ctx context.Context, operacao string, tentativa func() error) error {
+	politica := RetryPolicy{MaxTentativas: 1}
+	if c.Retry != nil {
+		politica = c.Retry.normaliza()
+	}
+	for n := 1; ; n++ {
+		err := c.tenta(tentativa)
+		if err == nil || n >= politica.MaxTentativas || !politica.retentavel(operacao, err) {
+			return err
+		}
+		t := time.NewTimer(politica.espera(n))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// tenta faz uma única tentativa, passando pelo CircuitBreaker quando houver
+func (c *Client) tenta(tentativa func() error) error {
+	if c.Breaker == nil {
+		return tentativa()
+	}
+	if err := c.Breaker.permite(); err != nil {
+		return err
+	}
+	err := tentativa()
+	c.Breaker.registra(err)
+	return err
+}
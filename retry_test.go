@@ -0,0 +1,241 @@
+package plp
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RogerioML/plp/sigeptest"
+)
+
+func TestRetryPolicyEspera(t *testing.T) {
+	p := RetryPolicy{EsperaInicial: 100 * time.Millisecond, EsperaMaxima: time.Second}.normaliza()
+	esperadas := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, esperada := range esperadas {
+		if d := p.espera(i + 1); d != esperada {
+			t.Errorf("espera(%d) = %s, esperado %s", i+1, d, esperada)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.espera(2); d <= 100*time.Millisecond || d > 200*time.Millisecond {
+			t.Fatalf("espera com jitter = %s, fora de (100ms, 200ms]", d)
+		}
+	}
+}
+
+func TestRetryPolicyNormaliza(t *testing.T) {
+	p := RetryPolicy{}.normaliza()
+	padrao := DefaultRetryPolicy()
+	if p.MaxTentativas != padrao.MaxTentativas || p.EsperaInicial != padrao.EsperaInicial ||
+		p.EsperaMaxima != padrao.EsperaMaxima || len(p.StatusRetentaveis) != len(padrao.StatusRetentaveis) {
+		t.Errorf("normaliza() = %+v, esperado %+v", p, padrao)
+	}
+}
+
+// clienteRetry Client do servidor com novas tentativas sem espera perceptível
+func clienteRetry(srv *sigeptest.Server) *Client {
+	c := NewClient(srv.URL, srv.Usuario, srv.Senha)
+	c.Retry = &RetryPolicy{MaxTentativas: 3, EsperaInicial: time.Millisecond, EsperaMaxima: time.Millisecond}
+	return c
+}
+
+func TestRetryRepeteFalhasDeServico(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	srv.DefineFalha("buscaServicos", sigeptest.Falha{Status: http.StatusServiceUnavailable, Vezes: 2})
+
+	servicos, err := clienteRetry(srv).BuscaServicos("9912208555", "0067599079")
+	if err != nil {
+		t.Fatalf("BuscaServicos: %v", err)
+	}
+	if len(servicos) == 0 {
+		t.Error("BuscaServicos sem serviços")
+	}
+	if n := srv.Chamadas("buscaServicos"); n != 3 {
+		t.Errorf("chamadas = %d, esperado 3", n)
+	}
+}
+
+func TestRetryRespeitaMaxTentativas(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	srv.DefineFalha("buscaServicos", sigeptest.Falha{Status: http.StatusBadGateway})
+
+	_, err := clienteRetry(srv).BuscaServicos("9912208555", "0067599079")
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusBadGateway {
+		t.Fatalf("erro = %v, esperado *StatusError 502", err)
+	}
+	if n := srv.Chamadas("buscaServicos"); n != 3 {
+		t.Errorf("chamadas = %d, esperado 3", n)
+	}
+}
+
+func TestRetryNaoRepeteFalhaSOAP(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	srv.DefineFalha("buscaServicos", sigeptest.Falha{Mensagem: "Usuário ou senha inválidos"})
+
+	_, err := clienteRetry(srv).BuscaServicos("9912208555", "0067599079")
+	if !errors.Is(err, ErrCredenciaisInvalidas) {
+		t.Fatalf("erro = %v, esperado ErrCredenciaisInvalidas", err)
+	}
+	if n := srv.Chamadas("buscaServicos"); n != 1 {
+		t.Errorf("chamadas = %d, esperado 1", n)
+	}
+}
+
+func TestRetryNaoRepeteOperacoesNaoIdempotentes(t *testing.T) {
+	casos := []struct {
+		operacao string
+		chama    func(c *Client) error
+	}{
+		{"solicitaEtiquetas", func(c *Client) error {
+			_, err := c.SolicitaEtiquetas("03220", "34028316000103", 1)
+			return err
+		}},
+		{"fechaPlpVariosServicos", func(c *Client) error {
+			_, err := c.FechaPlpVariosServicos("<correioslog/>", "SZ000000015BR", "SZ00000001BR", "1", "0067599079")
+			return err
+		}},
+	}
+	for _, caso := range casos {
+		t.Run(caso.operacao, func(t *testing.T) {
+			srv := sigeptest.NewServer()
+			defer srv.Close()
+			srv.DefineFalha(caso.operacao, sigeptest.Falha{Status: http.StatusServiceUnavailable})
+
+			c := clienteRetry(srv)
+			if err := caso.chama(c); err == nil {
+				t.Fatal("chamada sem erro")
+			}
+			if n := srv.Chamadas(caso.operacao); n != 1 {
+				t.Errorf("chamadas = %d, esperado 1", n)
+			}
+
+			c.Retry.RetentaNaoIdempotentes = true
+			if err := caso.chama(c); err == nil {
+				t.Fatal("chamada sem erro")
+			}
+			if n := srv.Chamadas(caso.operacao); n != 1+3 {
+				t.Errorf("chamadas com RetentaNaoIdempotentes = %d, esperado 4", n)
+			}
+		})
+	}
+}
+
+func TestRetryRepeteTimeout(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	srv.DefineLatencia("buscaServicos", 200*time.Millisecond)
+
+	c := clienteRetry(srv)
+	c.Timeout = 20 * time.Millisecond
+	_, err := c.BuscaServicos("9912208555", "0067599079")
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("erro = %v, esperado ErrTimeout", err)
+	}
+	if n := srv.Chamadas("buscaServicos"); n != 3 {
+		t.Errorf("chamadas = %d, esperado 3", n)
+	}
+}
+
+func TestCircuitBreakerPadrao(t *testing.T) {
+	b := &CircuitBreaker{}
+	falha := &StatusError{Operation: "buscaServicos", StatusCode: http.StatusServiceUnavailable}
+	for i := 1; i < limiteFalhasCircuito; i++ {
+		b.registra(falha)
+		if b.Aberto() {
+			t.Fatalf("circuito aberto após %d falhas com LimiteFalhas zerado", i)
+		}
+	}
+	b.registra(falha)
+	if !b.Aberto() {
+		t.Fatalf("circuito fechado após %d falhas", limiteFalhasCircuito)
+	}
+	if err := b.permite(); !errors.Is(err, ErrCircuitoAberto) {
+		t.Errorf("permite() = %v, esperado ErrCircuitoAberto dentro do Intervalo padrão", err)
+	}
+}
+
+func TestCircuitBreakerEstados(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	c := NewClient(srv.URL, srv.Usuario, srv.Senha)
+	c.Breaker = NewCircuitBreaker(2, 50*time.Millisecond)
+	busca := func() error {
+		_, err := c.BuscaServicos("9912208555", "0067599079")
+		return err
+	}
+
+	// falhas SOAP são de negócio e não abrem o circuito
+	srv.DefineFalha("buscaServicos", sigeptest.Falha{Mensagem: "Contrato não encontrado", Vezes: 3})
+	for i := 0; i < 3; i++ {
+		busca()
+	}
+	if c.Breaker.Aberto() {
+		t.Fatal("circuito aberto por falhas SOAP")
+	}
+
+	// fechado -> aberto
+	srv.DefineFalha("buscaServicos", sigeptest.Falha{Status: http.StatusServiceUnavailable})
+	busca()
+	if c.Breaker.Aberto() {
+		t.Fatal("circuito aberto antes do limite")
+	}
+	busca()
+	if !c.Breaker.Aberto() {
+		t.Fatal("circuito fechado após o limite")
+	}
+	chamadas := srv.Chamadas("buscaServicos")
+	if err := busca(); !errors.Is(err, ErrCircuitoAberto) {
+		t.Fatalf("erro = %v, esperado ErrCircuitoAberto", err)
+	}
+	if srv.Chamadas("buscaServicos") != chamadas {
+		t.Error("circuito aberto acessou o servidor")
+	}
+
+	// meio aberto -> aberto com a chamada de teste falhando
+	time.Sleep(60 * time.Millisecond)
+	if err := busca(); errors.Is(err, ErrCircuitoAberto) {
+		t.Fatal("chamada de teste não permitida após o Intervalo")
+	}
+	if !c.Breaker.Aberto() {
+		t.Fatal("circuito fechado após falha da chamada de teste")
+	}
+
+	// meio aberto -> fechado com a chamada de teste bem sucedida
+	srv.RemoveFalha("buscaServicos")
+	time.Sleep(60 * time.Millisecond)
+	if err := busca(); err != nil {
+		t.Fatalf("chamada de teste: %v", err)
+	}
+	if c.Breaker.Aberto() {
+		t.Fatal("circuito aberto após sucesso da chamada de teste")
+	}
+}
+
+func TestRetryPolicyJitterZero(t *testing.T) {
+	p := RetryPolicy{EsperaInicial: 100 * time.Millisecond}.normaliza()
+	if p.Jitter != 0 {
+		t.Fatalf("Jitter = %f, esperado 0 mantido por normaliza", p.Jitter)
+	}
+	for i := 0; i < 10; i++ {
+		if d := p.espera(1); d != 100*time.Millisecond {
+			t.Fatalf("espera sem jitter = %s, esperado 100ms", d)
+		}
+	}
+	if DefaultRetryPolicy().Jitter != 0.2 {
+		t.Errorf("Jitter padrão = %f, esperado 0.2", DefaultRetryPolicy().Jitter)
+	}
+}
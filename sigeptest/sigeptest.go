@@ -0,0 +1,542 @@
+// Package sigeptest oferece um SIGEPWEB falso, baseado em httptest, para testes
+// que não podem acessar o serviço dos Correios. O Server implementa as operações
+// usadas pelo pacote plp com estado em memória, falhas e latência configuráveis.
+//
+//	srv := sigeptest.NewServer()
+//	defer srv.Close()
+//	c := plp.NewClient(srv.URL, srv.Usuario, srv.Senha)
+package sigeptest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credenciais aceitas por padrão pelo Server
+const (
+	UsuarioPadrao = "sigep"
+	SenhaPadrao   = "n5f9t8"
+)
+
+// EstadoEtiqueta situação de uma etiqueta emitida pelo Server
+type EstadoEtiqueta string
+
+// Estados possíveis para as etiquetas
+const (
+	EtiquetaReservada EstadoEtiqueta = "reservada"
+	EtiquetaUsada     EstadoEtiqueta = "usada"
+	EtiquetaCancelada EstadoEtiqueta = "cancelada"
+)
+
+// Servico serviço do contrato devolvido pelo buscaServicos
+type Servico struct {
+	Codigo    string `xml:"codigo"`
+	ID        int    `xml:"id"`
+	Descricao string `xml:"descricao"`
+}
+
+// Endereco endereço devolvido pelo consultaCEP
+type Endereco struct {
+	Bairro      string `xml:"bairro"`
+	Cep         string `xml:"cep"`
+	Cidade      string `xml:"cidade"`
+	Complemento string `xml:"complemento2"`
+	Endereco    string `xml:"end"`
+	UF          string `xml:"uf"`
+}
+
+// Falha resposta de erro a ser devolvida por uma operação. Com Mensagem vazia o
+// Server responde apenas o Status, sem envelope, como faz um balanceador com o
+// serviço fora. Vezes limita a quantidade de respostas com a falha, zero indica
+// todas as chamadas.
+type Falha struct {
+	Codigo   string
+	Mensagem string
+	Status   int
+	Vezes    int
+}
+
+// PlpFechada PLP recebida pelo fechaPlpVariosServicos
+type PlpFechada struct {
+	Numero         int64
+	IDPlpCliente   string
+	CartaoPostagem string
+	Etiquetas      []string
+	XML            string
+}
+
+// Server SIGEPWEB falso. Os campos exportados podem ser alterados antes das chamadas.
+type Server struct {
+	*httptest.Server
+
+	// Usuario e Senha credenciais aceitas, vazias para aceitar qualquer uma
+	Usuario string
+	Senha   string
+	// Prefixo e Sufixo das etiquetas emitidas
+	Prefixo string
+	Sufixo  string
+
+	mu           sync.Mutex
+	servicos     []Servico
+	ceps         map[string]Endereco
+	etiquetas    map[string]EstadoEtiqueta
+	proxEtiqueta int
+	plps         map[int64]*PlpFechada
+	proxPlp      int64
+	falhas       map[string]*Falha
+	latencias    map[string]time.Duration
+	chamadas     map[string]int
+}
+
+// NewServer inicia um Server com as credenciais padrão e os serviços mais comuns
+func NewServer() *Server {
+	s := novoServer()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.atende))
+	return s
+}
+
+// NewTLSServer inicia um Server como NewServer, atendendo em HTTPS com um
+// certificado próprio, disponível em Certificate
+func NewTLSServer() *Server {
+	s := novoServer()
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.atende))
+	return s
+}
+
+func novoServer() *Server {
+	return &Server{
+		Usuario: UsuarioPadrao,
+		Senha:   SenhaPadrao,
+		Prefixo: "SZ",
+		Sufixo:  "BR",
+		servicos: []Servico{
+			{Codigo: "03220", ID: 162022, Descricao: "SEDEX CONTRATO AG"},
+			{Codigo: "03298", ID: 162026, Descricao: "PAC CONTRATO AG"},
+			{Codigo: "04227", ID: 160136, Descricao: "CARTA COMERCIAL A FATURAR"},
+		},
+		ceps:         map[string]Endereco{},
+		etiquetas:    map[string]EstadoEtiqueta{},
+		proxEtiqueta: 1,
+		plps:         map[int64]*PlpFechada{},
+		proxPlp:      100000000,
+		falhas:       map[string]*Falha{},
+		latencias:    map[string]time.Duration{},
+		chamadas:     map[string]int{},
+	}
+}
+
+// DefineServicos substitui os serviços devolvidos pelo buscaServicos
+func (s *Server) DefineServicos(servicos ...Servico) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.servicos = append([]Servico(nil), servicos...)
+}
+
+// AdicionaCEP cadastra o endereço devolvido pelo consultaCEP para o CEP
+func (s *Server) AdicionaCEP(cep string, e Endereco) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.Cep == "" {
+		e.Cep = cep
+	}
+	s.ceps[cep] = e
+}
+
+// DefineFalha faz a operação responder com a falha, a partir da próxima chamada
+func (s *Server) DefineFalha(operacao string, f Falha) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Status == 0 {
+		f.Status = http.StatusInternalServerError
+	}
+	s.falhas[operacao] = &f
+}
+
+// RemoveFalha volta a operação ao funcionamento normal
+func (s *Server) RemoveFalha(operacao string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.falhas, operacao)
+}
+
+// DefineLatencia atrasa as respostas da operação, ou de todas quando a operação for vazia
+func (s *Server) DefineLatencia(operacao string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latencias[operacao] = d
+}
+
+// Chamadas quantidade de requisições recebidas para a operação
+func (s *Server) Chamadas(operacao string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.chamadas[operacao]
+}
+
+// Etiqueta situação da etiqueta, com ou sem dígito verificador
+func (s *Server) Etiqueta(etiqueta string) (EstadoEtiqueta, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.etiquetas[semDV(etiqueta)]
+	return e, ok
+}
+
+// Plp PLP fechada com o número informado
+func (s *Server) Plp(numero int64) (PlpFechada, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.plps[numero]
+	if !ok {
+		return PlpFechada{}, false
+	}
+	return *p, true
+}
+
+// Plps quantidade de PLPs fechadas
+func (s *Server) Plps() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.plps)
+}
+
+// requisicao envelope recebido, com os campos da operação por nome
+type requisicao struct {
+	Body struct {
+		Operacao struct {
+			XMLName xml.Name
+			Campos  []struct {
+				XMLName xml.Name
+				Valor   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// campos valores dos elementos da operação, agrupados por nome
+type campos map[string][]string
+
+func (c campos) valor(nome string) string {
+	if v := c[nome]; len(v) > 0 {
+		return strings.TrimSpace(v[0])
+	}
+	return ""
+}
+
+// erroSigep falha SOAP a ser devolvida pela operação
+type erroSigep string
+
+func (e erroSigep) Error() string { return string(e) }
+
+func (s *Server) atende(w http.ResponseWriter, r *http.Request) {
+	req := requisicao{}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		escreveFault(w, http.StatusInternalServerError, "soap:Client", "envelope inválido: "+err.Error())
+		return
+	}
+	operacao := req.Body.Operacao.XMLName.Local
+	c := campos{}
+	for _, f := range req.Body.Operacao.Campos {
+		c[f.XMLName.Local] = append(c[f.XMLName.Local], f.Valor)
+	}
+
+	s.mu.Lock()
+	s.chamadas[operacao]++
+	latencia, ok := s.latencias[operacao]
+	if !ok {
+		latencia = s.latencias[""]
+	}
+	falha := s.falhas[operacao]
+	if falha != nil && falha.Vezes > 0 {
+		falha.Vezes--
+		if falha.Vezes == 0 {
+			delete(s.falhas, operacao)
+		}
+	}
+	s.mu.Unlock()
+
+	if latencia > 0 {
+		select {
+		case <-time.After(latencia):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if falha != nil {
+		if falha.Mensagem == "" {
+			w.WriteHeader(falha.Status)
+			return
+		}
+		codigo := falha.Codigo
+		if codigo == "" {
+			codigo = "soap:Server"
+		}
+		escreveFault(w, falha.Status, codigo, falha.Mensagem)
+		return
+	}
+
+	var (
+		retorno interface{}
+		err     error
+	)
+	switch operacao {
+	case "consultaCEP":
+		retorno, err = s.consultaCEP(c)
+	default:
+		if err = s.autentica(c); err != nil {
+			break
+		}
+		switch operacao {
+		case "solicitaEtiquetas":
+			retorno, err = s.solicitaEtiquetas(c)
+		case "geraDigitoVerificadorEtiquetas":
+			retorno, err = s.geraDigitoVerificadorEtiquetas(c)
+		case "fechaPlpVariosServicos":
+			retorno, err = s.fechaPlpVariosServicos(c)
+		case "solicitaPLP":
+			retorno, err = s.solicitaPLP(c)
+		case "cancelarObjeto":
+			retorno, err = s.cancelarObjeto(c)
+		case "buscaServicos":
+			retorno, err = s.buscaServicos(c)
+		default:
+			escreveFault(w, http.StatusInternalServerError, "soap:Client", "operação desconhecida: "+operacao)
+			return
+		}
+	}
+	if err != nil {
+		escreveFault(w, http.StatusInternalServerError, "soap:Server", err.Error())
+		return
+	}
+	escreveRetorno(w, operacao, retorno)
+}
+
+func (s *Server) autentica(c campos) error {
+	if s.Usuario == "" && s.Senha == "" {
+		return nil
+	}
+	if c.valor("usuario") != s.Usuario || c.valor("senha") != s.Senha {
+		return erroSigep("Usuário ou senha inválidos")
+	}
+	return nil
+}
+
+func (s *Server) solicitaEtiquetas(c campos) (interface{}, error) {
+	qtd, err := strconv.Atoi(c.valor("qtdEtiquetas"))
+	if err != nil || qtd <= 0 {
+		return nil, erroSigep("Quantidade de etiquetas inválida")
+	}
+	if !s.temServico(c.valor("idServico")) {
+		return nil, erroSigep("Serviço " + c.valor("idServico") + " não disponível para o contrato")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ini := s.proxEtiqueta
+	for i := 0; i < qtd; i++ {
+		s.etiquetas[s.etiqueta(ini+i)] = EtiquetaReservada
+	}
+	s.proxEtiqueta += qtd
+	fim := ini + qtd - 1
+	return fmt.Sprintf("%s%08d %s,%s%08d %s", s.Prefixo, ini, s.Sufixo, s.Prefixo, fim, s.Sufixo), nil
+}
+
+// temServico indica se o serviço, pelo código ou pelo id, pertence ao contrato
+func (s *Server) temServico(servico string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sv := range s.servicos {
+		if sv.Codigo == servico || strconv.Itoa(sv.ID) == servico {
+			return true
+		}
+	}
+	return false
+}
+
+// etiqueta etiqueta sem dígito verificador com o número informado
+func (s *Server) etiqueta(numero int) string {
+	return fmt.Sprintf("%s%08d%s", s.Prefixo, numero, s.Sufixo)
+}
+
+func (s *Server) geraDigitoVerificadorEtiquetas(c campos) (interface{}, error) {
+	dv, ok := DigitoVerificador(c.valor("etiquetas"))
+	if !ok {
+		return nil, erroSigep("Etiqueta " + c.valor("etiquetas") + " inválida")
+	}
+	return dv, nil
+}
+
+func (s *Server) fechaPlpVariosServicos(c campos) (interface{}, error) {
+	if strings.TrimSpace(c.valor("xml")) == "" {
+		return nil, erroSigep("XML da PLP não informado")
+	}
+	var lista []string
+	for _, v := range c["listaEtiquetas"] {
+		for _, e := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ';' || r == ' ' || r == '\n' || r == '\t' }) {
+			lista = append(lista, semDV(e))
+		}
+	}
+	if len(lista) == 0 {
+		return nil, erroSigep("Lista de etiquetas não informada")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range lista {
+		switch s.etiquetas[e] {
+		case EtiquetaReservada:
+		case EtiquetaUsada:
+			return nil, erroSigep("Etiqueta " + e + " já utilizada")
+		case EtiquetaCancelada:
+			return nil, erroSigep("Etiqueta " + e + " cancelada")
+		default:
+			return nil, erroSigep("Etiqueta " + e + " não pertence ao cliente")
+		}
+	}
+	for _, e := range lista {
+		s.etiquetas[e] = EtiquetaUsada
+	}
+	numero := s.proxPlp
+	s.proxPlp++
+	s.plps[numero] = &PlpFechada{
+		Numero:         numero,
+		IDPlpCliente:   c.valor("idPlpCliente"),
+		CartaoPostagem: c.valor("cartaoPostagem"),
+		Etiquetas:      lista,
+		XML:            erIDPlp.ReplaceAllString(c.valor("xml"), fmt.Sprintf("<id_plp>%d</id_plp>", numero)),
+	}
+	return strconv.FormatInt(numero, 10), nil
+}
+
+var erIDPlp = regexp.MustCompile(`<id_plp\s*/>|<id_plp>[^<]*</id_plp>`)
+
+func (s *Server) solicitaPLP(c campos) (interface{}, error) {
+	numero, err := strconv.ParseInt(c.valor("idPlpMaster"), 10, 64)
+	if err != nil {
+		return nil, erroSigep("PLP não encontrada")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.plps[numero]
+	if !ok {
+		return nil, erroSigep("PLP não encontrada")
+	}
+	return p.XML, nil
+}
+
+func (s *Server) cancelarObjeto(c campos) (interface{}, error) {
+	numero, err := strconv.ParseInt(c.valor("idPlp"), 10, 64)
+	if err != nil {
+		return nil, erroSigep("PLP não encontrada")
+	}
+	etiqueta := semDV(c.valor("numeroEtiqueta"))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.plps[numero]
+	if !ok {
+		return nil, erroSigep("PLP não encontrada")
+	}
+	for _, e := range p.Etiquetas {
+		if e == etiqueta {
+			if s.etiquetas[e] == EtiquetaCancelada {
+				return nil, erroSigep("Objeto " + e + " já cancelado")
+			}
+			s.etiquetas[e] = EtiquetaCancelada
+			return true, nil
+		}
+	}
+	return nil, erroSigep("Objeto " + etiqueta + " não pertence à PLP")
+}
+
+func (s *Server) buscaServicos(c campos) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Servico(nil), s.servicos...), nil
+}
+
+func (s *Server) consultaCEP(c campos) (interface{}, error) {
+	cep := strings.Replace(c.valor("cep"), "-", "", -1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.ceps[cep]
+	if !ok {
+		return nil, erroSigep("CEP NAO ENCONTRADO")
+	}
+	return e, nil
+}
+
+// DigitoVerificador calcula o dígito verificador de uma etiqueta no formato
+// SZ12345678BR, com o mesmo algoritmo do SIGEPWEB
+func DigitoVerificador(etiqueta string) (int, bool) {
+	e := strings.Replace(etiqueta, " ", "", -1)
+	if len(e) != 12 {
+		return 0, false
+	}
+	multiplicadores := [...]int{8, 6, 4, 2, 3, 5, 9, 7}
+	soma := 0
+	for i, m := range multiplicadores {
+		d := e[2+i]
+		if d < '0' || d > '9' {
+			return 0, false
+		}
+		soma += int(d-'0') * m
+	}
+	switch resto := soma % 11; resto {
+	case 0:
+		return 5, true
+	case 1:
+		return 0, true
+	default:
+		return 11 - resto, true
+	}
+}
+
+// semDV remove espaços e o dígito verificador da etiqueta
+func semDV(etiqueta string) string {
+	e := strings.Replace(etiqueta, " ", "", -1)
+	if len(e) == 13 {
+		e = e[:10] + e[11:]
+	}
+	return e
+}
+
+// envelopes de resposta no formato do JAX-WS usado pelo SIGEPWEB
+const (
+	inicioEnvelope = `<?xml version='1.0' encoding='UTF-8'?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`
+	fimEnvelope    = `</soap:Body></soap:Envelope>`
+)
+
+func escreveRetorno(w http.ResponseWriter, operacao string, retorno interface{}) {
+	resposta := struct {
+		XMLName xml.Name
+		Ns      string      `xml:"xmlns:ns2,attr"`
+		Return  interface{} `xml:"return"`
+	}{
+		XMLName: xml.Name{Local: "ns2:" + operacao + "Response"},
+		Ns:      "http://cliente.bean.master.sigep.bsb.correios.com.br/",
+		Return:  retorno,
+	}
+	b, err := xml.Marshal(resposta)
+	if err != nil {
+		escreveFault(w, http.StatusInternalServerError, "soap:Server", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	fmt.Fprint(w, inicioEnvelope)
+	w.Write(b)
+	fmt.Fprint(w, fimEnvelope)
+}
+
+func escreveFault(w http.ResponseWriter, status int, codigo string, mensagem string) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprint(w, inicioEnvelope+`<soap:Fault><faultcode>`)
+	xml.EscapeText(w, []byte(codigo))
+	fmt.Fprint(w, `</faultcode><faultstring>`)
+	xml.EscapeText(w, []byte(mensagem))
+	fmt.Fprint(w, `</faultstring></soap:Fault>`+fimEnvelope)
+}
@@ -0,0 +1,139 @@
+package plp
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"unicode/utf8"
+)
+
+// Namespaces usados nos envelopes enviados ao SIGEPWEB
+const (
+	nsSoapenv = "http://schemas.xmlsoap.org/soap/envelope/"
+	nsSigep   = "http://cliente.bean.master.sigep.bsb.correios.com.br/"
+)
+
+// envelope envelope SOAP de requisição. O conteúdo do Body é a estrutura da
+// operação, cujo XMLName deve usar o prefixo cli, por exemplo `xml:"cli:buscaServicos"`.
+// Os elementos filhos ficam sem namespace, como espera o SIGEPWEB.
+type envelope struct {
+	XMLName   xml.Name `xml:"soapenv:Envelope"`
+	XmlnsSoap string   `xml:"xmlns:soapenv,attr"`
+	XmlnsCli  string   `xml:"xmlns:cli,attr"`
+	Header    struct{} `xml:"soapenv:Header"`
+	Body      struct {
+		Conteudo interface{}
+	} `xml:"soapenv:Body"`
+}
+
+// envelopeResposta envelope SOAP de resposta. Conteudo guarda o XML bruto do
+// Body para ser decodificado na estrutura de resposta da operação.
+type envelopeResposta struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		Fault    *soapFault `xml:"Fault"`
+		Conteudo []byte     `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+// soapFault falha SOAP devolvida pelo SIGEPWEB
+type soapFault struct {
+	FaultCode   string `xml:"faultcode"`
+	FaultString string `xml:"faultstring"`
+}
+
+// montaEnvelope serializa a requisição da operação dentro de um envelope SOAP
+func montaEnvelope(requisicao interface{}) ([]byte, error) {
+	env := envelope{XmlnsSoap: nsSoapenv, XmlnsCli: nsSigep}
+	env.Body.Conteudo = requisicao
+	return xml.Marshal(env)
+}
+
+// chama executa a operação no SIGEPWEB: serializa a requisição, envia o envelope,
+// com novas tentativas conforme a RetryPolicy do Client, e decodifica o conteúdo
+// do Body da resposta em resposta, que deve ser um ponteiro para a estrutura da
+// operação, por exemplo `xml:"buscaServicosResponse"`.
+func (c *Client) chama(ctx context.Context, operacao string, requisicao interface{}, resposta interface{}) error {
+	payload, err := montaEnvelope(requisicao)
+	if err != nil {
+		return fmt.Errorf("sigep %s: %w", operacao, err)
+	}
+	return c.executa(ctx, operacao, func() error {
+		b, status, err := c.post(ctx, operacao, payload)
+		if err != nil {
+			return err
+		}
+		return decodificaResposta(operacao, status, b, resposta)
+	})
+}
+
+// post envia o envelope SOAP da operação ao SIGEPWEB e devolve o corpo da resposta
+// em UTF-8 e o status HTTP. O contexto é propagado para a requisição HTTP.
+func (c *Client) post(ctx context.Context, operacao string, payload []byte) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.Wsdl, bytes.NewReader(payload))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, 0, erroContexto(ctx, operacao, err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, res.StatusCode, erroContexto(ctx, operacao, err)
+	}
+	// o SIGEPWEB responde em ISO-8859-1 sem declarar a codificação
+	if !utf8.Valid(b) {
+		b, err = IsoUtf8(b)
+		if err != nil {
+			return nil, res.StatusCode, err
+		}
+	}
+	return b, res.StatusCode, nil
+}
+
+// decodificaResposta decodifica o envelope de resposta. Falhas SOAP são devolvidas
+// como *FaultError e status HTTP de erro sem falha como *StatusError.
+func decodificaResposta(operacao string, status int, b []byte, resposta interface{}) error {
+	env := envelopeResposta{}
+	if err := decodificaUTF8(b, &env); err != nil {
+		if !statusSucesso(status) {
+			return &StatusError{Operation: operacao, StatusCode: status, Raw: b}
+		}
+		return fmt.Errorf("sigep %s: resposta inválida: %w", operacao, err)
+	}
+	if env.Body.Fault != nil {
+		return novoFaultError(operacao, env.Body.Fault, status, b)
+	}
+	if !statusSucesso(status) {
+		return &StatusError{Operation: operacao, StatusCode: status, Raw: b}
+	}
+	if len(bytes.TrimSpace(env.Body.Conteudo)) == 0 {
+		return fmt.Errorf("sigep %s: resposta vazia", operacao)
+	}
+	if err := decodificaUTF8(env.Body.Conteudo, resposta); err != nil {
+		return fmt.Errorf("sigep %s: resposta inválida: %w", operacao, err)
+	}
+	return nil
+}
+
+// statusSucesso indica se o status HTTP é da faixa 2xx
+func statusSucesso(status int) bool {
+	return status >= 200 && status < 300
+}
+
+// decodificaUTF8 decodifica b, já convertido para UTF-8, ignorando a codificação
+// declarada no prólogo do documento
+func decodificaUTF8(b []byte, v interface{}) error {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	d.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return d.Decode(v)
+}
@@ -0,0 +1,335 @@
+package plp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Erros das travas
+var (
+	ErrTravaOcupada = errors.New("plp: trava ocupada por outro processo")
+	ErrTravaPerdida = errors.New("plp: trava expirada ou obtida por outro processo")
+	// ErrFechamentoEmDuvida o fechamento anterior expirou sem resposta do
+	// SIGEPWEB, que pode ter fechado a PLP; confira e use ResolveDuvida
+	ErrFechamentoEmDuvida = errors.New("plp: fechamento da PLP em dúvida")
+)
+
+// valores padrão das travas e do FechamentoPlp
+const (
+	prefixoTrava               = "plp:trava"
+	validadeTravaFechamento    = 2 * time.Minute
+	validadeRegistroFechamento = 7 * 24 * time.Hour
+	// prazoFinalizacao prazo para liberar a trava e gravar o Registro, independente
+	// do prazo da chamada
+	prazoFinalizacao = 5 * time.Second
+	// registroEmDuvida valor do Registro para o fechamento sem resposta
+	registroEmDuvida = "em dúvida"
+)
+
+// scriptLibera KEYS trava; ARGV dono. Só remove a trava do próprio dono.
+var scriptLibera = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Trava exclusão mútua por chave entre os processos que fecham PLPs
+type Trava interface {
+	// Obtem obtém a trava da chave por no máximo validade, aguardando enquanto
+	// ela estiver ocupada até o prazo de ctx, e devolve o dono usado em Libera
+	Obtem(ctx context.Context, chave string, validade time.Duration) (string, error)
+	// Libera libera a trava obtida pelo dono
+	Libera(ctx context.Context, chave string, dono string) error
+}
+
+// RedisTrava trava guardada no REDIS com SET NX PX, compartilhada entre processos
+type RedisTrava struct {
+	// Redis conexões com o REDIS, nil para o RedisStore iniciado por IniRedis
+	Redis *RedisStore
+	// Prefixo prefixo das chaves no REDIS, padrão "plp:trava"
+	Prefixo string
+}
+
+// NewRedisTrava cria uma RedisTrava sobre o RedisStore informado
+func NewRedisTrava(s *RedisStore) *RedisTrava {
+	return &RedisTrava{Redis: s}
+}
+
+// Obtem obtém a trava da chave. Sem prazo em ctx, desiste após validade e
+// devolve ErrTravaOcupada.
+func (t *RedisTrava) Obtem(ctx context.Context, chave string, validade time.Duration) (string, error) {
+	dono, err := donoTrava()
+	if err != nil {
+		return "", fmt.Errorf("plp trava %s: %w", chave, err)
+	}
+	limite := time.Now().Add(validade)
+	for {
+		c, err := t.conexao(ctx)
+		if err != nil {
+			return "", err
+		}
+		ok, err := tentaTrava(c, t.chave(chave), dono, validade)
+		c.Close()
+		if err != nil {
+			return "", fmt.Errorf("plp trava %s: %w", chave, err)
+		}
+		if ok {
+			return dono, nil
+		}
+		if _, prazo := ctx.Deadline(); !prazo && time.Now().After(limite) {
+			return "", fmt.Errorf("plp trava %s: %w", chave, ErrTravaOcupada)
+		}
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("plp trava %s: %w: %s", chave, ErrTravaOcupada, ctx.Err())
+		case <-time.After(intervaloEspera):
+		}
+	}
+}
+
+// Libera libera a trava, devolvendo ErrTravaPerdida se ela já expirou
+func (t *RedisTrava) Libera(ctx context.Context, chave string, dono string) error {
+	c, err := t.conexao(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	n, err := redis.Int(scriptLibera.Do(c, t.chave(chave), dono))
+	if err != nil {
+		return fmt.Errorf("plp trava %s: %w", chave, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("plp trava %s: %w", chave, ErrTravaPerdida)
+	}
+	return nil
+}
+
+func (t *RedisTrava) conexao(ctx context.Context) (redis.Conn, error) {
+	s := t.Redis
+	if s == nil {
+		var err error
+		if s, err = redisAtual(); err != nil {
+			return nil, err
+		}
+	}
+	return s.Conn(ctx)
+}
+
+func (t *RedisTrava) chave(chave string) string {
+	prefixo := t.Prefixo
+	if prefixo == "" {
+		prefixo = prefixoTrava
+	}
+	return prefixo + ":" + chave
+}
+
+// TravaLocal trava que não faz nada, para programas com um único processo
+// fechando PLPs e para testes
+type TravaLocal struct{}
+
+// Obtem devolve sempre a trava
+func (TravaLocal) Obtem(ctx context.Context, chave string, validade time.Duration) (string, error) {
+	return "", nil
+}
+
+// Libera não faz nada
+func (TravaLocal) Libera(ctx context.Context, chave string, dono string) error {
+	return nil
+}
+
+// tentaTrava tenta uma única vez obter a trava da chave para o dono
+func tentaTrava(c redis.Conn, chave string, dono string, validade time.Duration) (bool, error) {
+	_, err := redis.String(c.Do("SET", chave, dono, "NX", "PX", int64(validade/time.Millisecond)))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// donoTrava identificador aleatório de quem obteve a trava
+func donoTrava() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// FechamentoPlp fecha cada PLP no SIGEPWEB uma única vez por idPlpCliente. Os
+// fechamentos do mesmo idPlpCliente são serializados pela Trava e o número da
+// PLP devolvido pelo SIGEPWEB fica guardado no Registro, de modo que repetir o
+// fechamento devolve o resultado original sem nova chamada.
+//
+// A chamada ao SIGEPWEB termina antes de vencer a trava. Se ela terminar sem
+// uma resposta definitiva do SIGEPWEB (FaultError ou StatusError), como em
+// ErrTimeout, no cancelamento de ctx ou na queda da conexão, a PLP pode ter sido
+// fechada: o fechamento fica registrado como em dúvida, as novas tentativas
+// devolvem ErrFechamentoEmDuvida até ResolveDuvida e a trava não é liberada,
+// expirando sozinha.
+type FechamentoPlp struct {
+	Client *Client
+	// Trava exclusão mútua entre os processos, nil para TravaLocal
+	Trava Trava
+	// Registro números das PLPs já fechadas, nil para não guardar. Um LRUCache
+	// pode descartar registros e só protege o próprio processo; entre processos,
+	// use um RedisCache.
+	Registro Cache
+	// ValidadeTrava tempo máximo de um fechamento, padrão 2min
+	ValidadeTrava time.Duration
+	// ValidadeRegistro tempo pelo qual o número da PLP é guardado, padrão 7 dias
+	ValidadeRegistro time.Duration
+}
+
+// NewFechamentoPlp cria um FechamentoPlp com os valores padrão
+func NewFechamentoPlp(c *Client, t Trava, registro Cache) *FechamentoPlp {
+	return &FechamentoPlp{Client: c, Trava: t, Registro: registro}
+}
+
+// FechaPlpVariosServicos fecha a PLP no SIGEPWEB ou devolve o número da PLP já
+// fechada com o mesmo idPlpCliente
+func (f *FechamentoPlp) FechaPlpVariosServicos(ctx context.Context, xmlPLP string, etiqueta string, etiquetaSemVerificador string, idPlpCliente string, cartao string) (string, error) {
+	chave := "fechamento:" + idPlpCliente
+	if numero, ok, err := f.registrado(ctx, chave); err != nil {
+		return "", fmt.Errorf("plp fechaPlp %s: %w", idPlpCliente, err)
+	} else if ok {
+		return numero, nil
+	}
+	trava := f.Trava
+	if trava == nil {
+		trava = TravaLocal{}
+	}
+	validade := f.ValidadeTrava
+	if validade <= 0 {
+		validade = validadeTravaFechamento
+	}
+	dono, err := trava.Obtem(ctx, chave, validade)
+	if err != nil {
+		return "", fmt.Errorf("plp fechaPlp %s: %w", idPlpCliente, err)
+	}
+	// a chamada termina antes da trava vencer, com folga de um décimo da validade
+	chamada, cancela := context.WithTimeout(ctx, validade-validade/10)
+	defer cancela()
+	libera := true
+	defer func() {
+		if libera {
+			// ctx pode já estar cancelado
+			c, cancela := context.WithTimeout(context.Background(), prazoFinalizacao)
+			defer cancela()
+			trava.Libera(c, chave, dono)
+		}
+	}()
+	// outro processo pode ter fechado a PLP enquanto aguardávamos a trava
+	if numero, ok, err := f.registrado(chamada, chave); err != nil {
+		return "", fmt.Errorf("plp fechaPlp %s: %w", idPlpCliente, err)
+	} else if ok {
+		return numero, nil
+	}
+	numero, err := f.Client.FechaPlpVariosServicosContext(chamada, xmlPLP, etiqueta, etiquetaSemVerificador, idPlpCliente, cartao)
+	if err != nil {
+		if !respostaSigep(err) {
+			// o SIGEPWEB pode ter fechado a PLP: a trava expira sozinha
+			libera = false
+			if errRegistro := f.registra(chave, registroEmDuvida); errRegistro != nil {
+				return "", fmt.Errorf("plp fechaPlp %s: fechamento em dúvida sem registro (%v): %w", idPlpCliente, errRegistro, err)
+			}
+		}
+		return "", err
+	}
+	if err := f.registra(chave, numero); err != nil {
+		return numero, fmt.Errorf("plp fechaPlp %s: PLP %s fechada sem registro: %w", idPlpCliente, numero, err)
+	}
+	return numero, nil
+}
+
+// respostaSigep indica se err é uma resposta do SIGEPWEB recusando a chamada,
+// caso em que a PLP com certeza não foi fechada
+func respostaSigep(err error) bool {
+	var fault *FaultError
+	var status *StatusError
+	return errors.As(err, &fault) || errors.As(err, &status)
+}
+
+// ResolveDuvida resolve o fechamento em dúvida de idPlpCliente conferido no
+// SIGEPWEB: numero é o da PLP fechada, ou vazio se ela não foi fechada, caso em
+// que o fechamento pode ser repetido
+func (f *FechamentoPlp) ResolveDuvida(ctx context.Context, idPlpCliente string, numero string) error {
+	if f.Registro == nil {
+		return nil
+	}
+	chave := "fechamento:" + idPlpCliente
+	var err error
+	if numero == "" {
+		err = f.Registro.Delete(ctx, chave)
+	} else {
+		err = f.registra(chave, numero)
+	}
+	if err != nil {
+		return fmt.Errorf("plp fechaPlp %s: %w", idPlpCliente, err)
+	}
+	return nil
+}
+
+// registrado número da PLP já fechada. Falhas do Registro interrompem o
+// fechamento, que poderia duplicar a PLP.
+func (f *FechamentoPlp) registrado(ctx context.Context, chave string) (string, bool, error) {
+	if f.Registro == nil {
+		return "", false, nil
+	}
+	v, ok, err := f.Registro.Get(ctx, chave)
+	if err != nil || !ok || len(v) == 0 {
+		return "", false, err
+	}
+	if string(v) == registroEmDuvida {
+		return "", false, ErrFechamentoEmDuvida
+	}
+	return string(v), true, nil
+}
+
+// registra guarda o valor no Registro com um prazo próprio, já que o da
+// chamada pode ter vencido
+func (f *FechamentoPlp) registra(chave string, valor string) error {
+	if f.Registro == nil {
+		return nil
+	}
+	validade := f.ValidadeRegistro
+	if validade <= 0 {
+		validade = validadeRegistroFechamento
+	}
+	ctx, cancela := context.WithTimeout(context.Background(), prazoFinalizacao)
+	defer cancela()
+	return f.Registro.Set(ctx, chave, []byte(valor), validade)
+}
+
+var (
+	muFechamento       sync.RWMutex
+	travaFechamento    Trava
+	registroFechamento Cache
+)
+
+// DefineFechamento define a trava e o registro usados pela função
+// FechaPlpVariosServicos do pacote. Com ambos nil, o fechamento volta a chamar
+// o SIGEPWEB diretamente.
+func DefineFechamento(t Trava, registro Cache) {
+	muFechamento.Lock()
+	travaFechamento, registroFechamento = t, registro
+	muFechamento.Unlock()
+}
+
+// fechamentoLegado monta um FechamentoPlp sobre o clienteLegado com a trava e o
+// registro do pacote
+func fechamentoLegado(usuario string, senha string) *FechamentoPlp {
+	muFechamento.RLock()
+	defer muFechamento.RUnlock()
+	return NewFechamentoPlp(clienteLegado(usuario, senha), travaFechamento, registroFechamento)
+}
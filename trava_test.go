@@ -0,0 +1,228 @@
+package plp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RogerioML/plp/sigeptest"
+)
+
+// travaTeste Trava em memória que registra as liberações
+type travaTeste struct {
+	mu        sync.Mutex
+	obtida    func()
+	liberadas int
+	errLibera error
+}
+
+func (t *travaTeste) Obtem(ctx context.Context, chave string, validade time.Duration) (string, error) {
+	if t.obtida != nil {
+		t.obtida()
+	}
+	return "dono", nil
+}
+
+func (t *travaTeste) Libera(ctx context.Context, chave string, dono string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.liberadas++
+	t.errLibera = ctx.Err()
+	return nil
+}
+
+// fechamentoTeste reserva uma etiqueta e devolve os argumentos de
+// FechaPlpVariosServicos para uma PLP com ela
+func fechamentoTeste(t *testing.T, c *Client) (xmlPLP, etiqueta, semDV string) {
+	t.Helper()
+	retorno, err := c.SolicitaEtiquetas("03220", "34028316000103", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	faixa, err := ParseFaixaEtiquetas(retorno)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := faixa.Inicio
+	return fmt.Sprintf(xmlPlpCiclo, objetoCiclo(e.String())), e.String(), e.SemDV()
+}
+
+func TestFechamentoPlpUmaVez(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	trava := &travaTeste{}
+	f := NewFechamentoPlp(NewClient(srv.URL, srv.Usuario, srv.Senha), trava, NewLRUCache(10))
+	xmlPLP, etiqueta, semDV := fechamentoTeste(t, f.Client)
+
+	numero, err := f.FechaPlpVariosServicos(context.Background(), xmlPLP, etiqueta, semDV, "1", "0067599079")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repetido, err := f.FechaPlpVariosServicos(context.Background(), xmlPLP, etiqueta, semDV, "1", "0067599079")
+	if err != nil || repetido != numero {
+		t.Errorf("fechamento repetido = %s, %v, esperado %s", repetido, err, numero)
+	}
+	if n := srv.Chamadas("fechaPlpVariosServicos"); n != 1 {
+		t.Errorf("chamadas = %d, esperado 1", n)
+	}
+	if trava.liberadas != 1 {
+		t.Errorf("trava liberada %d vezes, esperado 1", trava.liberadas)
+	}
+}
+
+func TestFechamentoPlpPrazoDaTrava(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	srv.DefineLatencia("fechaPlpVariosServicos", time.Second)
+	trava := &travaTeste{}
+	f := NewFechamentoPlp(NewClient(srv.URL, srv.Usuario, srv.Senha), trava, NewLRUCache(10))
+	f.ValidadeTrava = 100 * time.Millisecond
+	xmlPLP, etiqueta, semDV := fechamentoTeste(t, f.Client)
+
+	inicio := time.Now()
+	_, err := f.FechaPlpVariosServicos(context.Background(), xmlPLP, etiqueta, semDV, "1", "0067599079")
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("erro = %v, esperado ErrTimeout", err)
+	}
+	if d := time.Since(inicio); d >= f.ValidadeTrava {
+		t.Errorf("fechamento durou %s, além da validade da trava", d)
+	}
+	if trava.liberadas != 0 {
+		t.Error("trava liberada após fechamento em dúvida")
+	}
+
+	srv.DefineLatencia("fechaPlpVariosServicos", 0)
+	if _, err := f.FechaPlpVariosServicos(context.Background(), xmlPLP, etiqueta, semDV, "1", "0067599079"); !errors.Is(err, ErrFechamentoEmDuvida) {
+		t.Fatalf("nova tentativa = %v, esperado ErrFechamentoEmDuvida", err)
+	}
+	if n := srv.Chamadas("fechaPlpVariosServicos"); n != 1 {
+		t.Errorf("chamadas = %d, esperado 1", n)
+	}
+
+	if err := f.ResolveDuvida(context.Background(), "1", "100000000"); err != nil {
+		t.Fatal(err)
+	}
+	if numero, err := f.FechaPlpVariosServicos(context.Background(), xmlPLP, etiqueta, semDV, "1", "0067599079"); err != nil || numero != "100000000" {
+		t.Errorf("fechamento resolvido = %s, %v", numero, err)
+	}
+}
+
+func TestFechamentoPlpResolveDuvidaSemFechamento(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	registro := NewLRUCache(10)
+	registro.Set(context.Background(), "fechamento:1", []byte(registroEmDuvida), 0)
+	f := NewFechamentoPlp(NewClient(srv.URL, srv.Usuario, srv.Senha), &travaTeste{}, registro)
+	xmlPLP, etiqueta, semDV := fechamentoTeste(t, f.Client)
+
+	if err := f.ResolveDuvida(context.Background(), "1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.FechaPlpVariosServicos(context.Background(), xmlPLP, etiqueta, semDV, "1", "0067599079"); err != nil {
+		t.Fatalf("fechamento após ResolveDuvida: %v", err)
+	}
+	if n := srv.Chamadas("fechaPlpVariosServicos"); n != 1 {
+		t.Errorf("chamadas = %d, esperado 1", n)
+	}
+}
+
+// cancelaAposResposta transporte que lê a resposta do SIGEPWEB e cancela o
+// contexto do chamador antes de entregá-la
+type cancelaAposResposta struct {
+	cancela context.CancelFunc
+}
+
+func (t cancelaAposResposta) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	t.cancela()
+	return resp, nil
+}
+
+func TestFechamentoPlpLiberaComContextoProprio(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	srv.DefineFalha("fechaPlpVariosServicos", sigeptest.Falha{Mensagem: "Cartão de postagem inválido", Vezes: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trava := &travaTeste{}
+	f := NewFechamentoPlp(NewClient(srv.URL, srv.Usuario, srv.Senha), trava, NewLRUCache(10))
+	xmlPLP, etiqueta, semDV := fechamentoTeste(t, f.Client)
+	// o chamador desiste logo após a recusa do SIGEPWEB
+	f.Client = NewClient(srv.URL, srv.Usuario, srv.Senha)
+	f.Client.Transport = cancelaAposResposta{cancel}
+
+	_, err := f.FechaPlpVariosServicos(ctx, xmlPLP, etiqueta, semDV, "1", "0067599079")
+	if !errors.As(err, new(*FaultError)) {
+		t.Fatalf("erro = %v, esperado FaultError", err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("contexto do chamador não foi cancelado")
+	}
+	if trava.liberadas != 1 {
+		t.Fatalf("trava liberada %d vezes, esperado 1", trava.liberadas)
+	}
+	if trava.errLibera != nil {
+		t.Errorf("Libera chamada com contexto encerrado: %v", trava.errLibera)
+	}
+
+	// a recusa não deixa o fechamento em dúvida
+	if _, err := f.FechaPlpVariosServicos(context.Background(), xmlPLP, etiqueta, semDV, "1", "0067599079"); err != nil {
+		t.Errorf("nova tentativa após a recusa: %v", err)
+	}
+}
+
+func TestFechamentoPlpRecusaStatus(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	srv.DefineFalha("fechaPlpVariosServicos", sigeptest.Falha{Status: http.StatusServiceUnavailable, Vezes: 1})
+	trava := &travaTeste{}
+	f := NewFechamentoPlp(NewClient(srv.URL, srv.Usuario, srv.Senha), trava, NewLRUCache(10))
+	xmlPLP, etiqueta, semDV := fechamentoTeste(t, f.Client)
+
+	_, err := f.FechaPlpVariosServicos(context.Background(), xmlPLP, etiqueta, semDV, "1", "0067599079")
+	if !errors.As(err, new(*StatusError)) {
+		t.Fatalf("erro = %v, esperado StatusError", err)
+	}
+	if trava.liberadas != 1 {
+		t.Errorf("trava liberada %d vezes, esperado 1", trava.liberadas)
+	}
+	if _, err := f.FechaPlpVariosServicos(context.Background(), xmlPLP, etiqueta, semDV, "1", "0067599079"); err != nil {
+		t.Errorf("nova tentativa após a recusa: %v", err)
+	}
+}
+
+func TestFechamentoPlpCanceladoEmDuvida(t *testing.T) {
+	srv := sigeptest.NewServer()
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// o chamador desiste logo após obter a trava, sem saber se a chamada saiu
+	trava := &travaTeste{obtida: cancel}
+	f := NewFechamentoPlp(NewClient(srv.URL, srv.Usuario, srv.Senha), trava, NewLRUCache(10))
+	xmlPLP, etiqueta, semDV := fechamentoTeste(t, f.Client)
+
+	if _, err := f.FechaPlpVariosServicos(ctx, xmlPLP, etiqueta, semDV, "1", "0067599079"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("erro = %v, esperado context.Canceled", err)
+	}
+	if trava.liberadas != 0 {
+		t.Error("trava liberada após fechamento cancelado")
+	}
+	if _, err := f.FechaPlpVariosServicos(context.Background(), xmlPLP, etiqueta, semDV, "1", "0067599079"); !errors.Is(err, ErrFechamentoEmDuvida) {
+		t.Errorf("nova tentativa = %v, esperado ErrFechamentoEmDuvida", err)
+	}
+}
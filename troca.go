@@ -0,0 +1,334 @@
+package plp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Erros da troca de serviços
+var (
+	ErrTrocaServicoSemRegra      = errors.New("negocio: nenhuma regra de troca de serviço para os pacotes informados")
+	ErrTrocaServicoSemMapeamento = errors.New("negocio: serviço sem mapeamento na regra de troca")
+	ErrTabelaServicosInvalida    = errors.New("negocio: tabela de troca de serviços inválida")
+	ErrServicoForaDoContrato     = errors.New("negocio: serviço não disponível no contrato")
+)
+
+// tabelaServicosPadrao tabela da política comercial vigente. Cada regra se aplica
+// aos pacotes de origem listados e, quando destinos é vazio, a qualquer destino.
+//
+// Histórico de versões:
+//   - 2020.1: as trocas do switch original de TrocaServico;
+//   - 2020.2: mantém todas as trocas da 2020.1 e acrescenta 03050 -> 03220 em
+//     "bronze para os demais pacotes" e 03280 -> 03050 em "diamante e infinite
+//     para os demais pacotes", os serviços gerados pelas regras de 5.x e 2.x,
+//     que a 2020.1 só previa como 03052 e 03282.
+const tabelaServicosPadrao = `{
+	"versao": "2020.2",
+	"regras": [
+		{
+			"nome": "2.0 para bronze",
+			"origens": ["2.0"],
+			"destinos": ["bronze"],
+			"servicos": {
+				"04537": "03042", "04553": "03050", "04596": "03085", "04618": "03107",
+				"40215": "04790", "40169": "04782", "40290": "04804"
+			}
+		},
+		{
+			"nome": "2.0 para prata a infinite",
+			"origens": ["2.0"],
+			"destinos": ["prata", "ouro", "platinum", "diamante", "infinite"],
+			"servicos": {
+				"04537": "03212", "04553": "03220", "04596": "03298", "04618": "03328",
+				"40215": "03158", "40169": "03140", "40290": "03204"
+			}
+		},
+		{
+			"nome": "2.x para bronze",
+			"origens": ["2.1", "2.2", "2.3", "2.4", "2.5", "2.6", "2.7", "2.8", "2.9"],
+			"destinos": ["bronze"],
+			"servicos": {
+				"40169": "04782", "40215": "04790", "40290": "04804",
+				"04138": "03042", "04162": "03050", "04669": "03085", "04693": "03107"
+			}
+		},
+		{
+			"nome": "2.x para prata a infinite",
+			"origens": ["2.1", "2.2", "2.3", "2.4", "2.5", "2.6", "2.7", "2.8", "2.9"],
+			"destinos": ["prata", "ouro", "platinum", "diamante", "infinite"],
+			"servicos": {
+				"40169": "03140", "40215": "03158", "40290": "03204",
+				"04138": "03212", "04162": "03220", "04669": "03298", "04693": "03328"
+			}
+		},
+		{
+			"nome": "5.x para bronze",
+			"origens": ["5.1", "5.2", "5.3", "5.4", "5.5", "5.6", "5.7"],
+			"destinos": ["bronze"],
+			"servicos": {
+				"40169": "04782", "40215": "04790", "40290": "04804",
+				"04138": "03042", "04162": "03050", "04669": "03085", "04693": "03107",
+				"04316": "03050", "04812": "03085"
+			}
+		},
+		{
+			"nome": "5.x para prata a platinum",
+			"origens": ["5.1", "5.2", "5.3", "5.4", "5.5", "5.6", "5.7"],
+			"destinos": ["prata", "ouro", "platinum"],
+			"servicos": {
+				"40169": "03140", "40215": "03158", "40290": "03204",
+				"04138": "03212", "04162": "03220", "04669": "03298", "04693": "03328",
+				"04316": "03220", "04812": "03298"
+			}
+		},
+		{
+			"nome": "5.x para diamante e infinite",
+			"origens": ["5.1", "5.2", "5.3", "5.4", "5.5", "5.6", "5.7"],
+			"destinos": ["diamante", "infinite"],
+			"servicos": {
+				"40169": "03140", "40215": "03158", "40290": "03204",
+				"04138": "03212", "04162": "03220", "04669": "03298", "04693": "03328",
+				"04316": "03280", "04812": "03336"
+			}
+		},
+		{
+			"nome": "bronze para os demais pacotes",
+			"origens": ["bronze"],
+			"servicos": {
+				"04782": "03140", "04790": "03158", "04804": "03204",
+				"03042": "03212", "03052": "03220", "03085": "03298", "03107": "03328",
+				"03050": "03220"
+			}
+		},
+		{
+			"nome": "diamante e infinite para os demais pacotes",
+			"origens": ["diamante", "infinite"],
+			"servicos": {
+				"03140": "04782", "03158": "04790", "03204": "04804",
+				"03212": "03042", "03220": "03050", "03298": "03085", "03328": "03107",
+				"03282": "03050", "03336": "03085",
+				"03280": "03050"
+			}
+		}
+	]
+}`
+
+// RegraTroca regra de troca de serviços entre pacotes da política comercial
+type RegraTroca struct {
+	Nome    string   `json:"nome"`
+	Origens []string `json:"origens"`
+	// Destinos pacotes de destino da regra, vazio para qualquer destino
+	Destinos []string `json:"destinos"`
+	// Servicos código do serviço no pacote de origem para o código no pacote de destino
+	Servicos map[string]string `json:"servicos"`
+}
+
+// TabelaServicos tabela versionada das regras de troca de serviços
+type TabelaServicos struct {
+	Versao string       `json:"versao"`
+	Regras []RegraTroca `json:"regras"`
+}
+
+// ResultadoTroca explica a troca de serviço de um objeto
+type ResultadoTroca struct {
+	Etiqueta        string
+	Versao          string
+	Regra           string
+	Origem          string
+	Destino         string
+	ServicoAnterior string
+	ServicoNovo     string
+	// Alterado falso quando o serviço já era um serviço de destino da regra
+	Alterado bool
+}
+
+func (r ResultadoTroca) String() string {
+	if !r.Alterado {
+		return fmt.Sprintf("%s mantido pela regra %q da tabela %s", r.ServicoAnterior, r.Regra, r.Versao)
+	}
+	return fmt.Sprintf("%s -> %s pela regra %q da tabela %s", r.ServicoAnterior, r.ServicoNovo, r.Regra, r.Versao)
+}
+
+var (
+	muTabela     sync.RWMutex
+	tabelaAtual  *TabelaServicos
+	tabelaPadrao *TabelaServicos
+)
+
+func init() {
+	t, err := CarregaTabelaServicos(strings.NewReader(tabelaServicosPadrao))
+	if err != nil {
+		panic(err)
+	}
+	tabelaPadrao, tabelaAtual = t, t
+}
+
+// CarregaTabelaServicos lê uma tabela de troca de serviços em JSON, no mesmo
+// formato da tabela padrão
+func CarregaTabelaServicos(r io.Reader) (*TabelaServicos, error) {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	t := &TabelaServicos{}
+	if err := d.Decode(t); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTabelaServicosInvalida, err)
+	}
+	if t.Versao == "" {
+		return nil, fmt.Errorf("%w: versão não informada", ErrTabelaServicosInvalida)
+	}
+	for i, r := range t.Regras {
+		if len(r.Origens) == 0 || len(r.Servicos) == 0 {
+			return nil, fmt.Errorf("%w: regra %d sem origens ou serviços", ErrTabelaServicosInvalida, i)
+		}
+	}
+	return t, nil
+}
+
+// TabelaServicosPadrao devolve a tabela da política comercial vigente embutida no módulo
+func TabelaServicosPadrao() *TabelaServicos {
+	return tabelaPadrao
+}
+
+// TabelaServicosAtual devolve a tabela usada por TrocaServico
+func TabelaServicosAtual() *TabelaServicos {
+	muTabela.RLock()
+	defer muTabela.RUnlock()
+	return tabelaAtual
+}
+
+// DefineTabelaServicos substitui a tabela usada por TrocaServico. Com t nil,
+// volta a usar a tabela padrão.
+func DefineTabelaServicos(t *TabelaServicos) {
+	if t == nil {
+		t = tabelaPadrao
+	}
+	muTabela.Lock()
+	tabelaAtual = t
+	muTabela.Unlock()
+}
+
+// Explica indica qual regra se aplica ao serviço na troca do pacote origem para
+// o pacote destino, sem alterar nada. Serviços que já são de destino da regra
+// permanecem os mesmos.
+func (t *TabelaServicos) Explica(origem, destino, servico string) (ResultadoTroca, error) {
+	res := ResultadoTroca{Versao: t.Versao, Origem: origem, Destino: destino, ServicoAnterior: servico}
+	r := t.regra(origem, destino)
+	if r == nil {
+		return res, fmt.Errorf("%w: %s para %s na tabela %s", ErrTrocaServicoSemRegra, origem, destino, t.Versao)
+	}
+	res.Regra = r.Nome
+	if novo, ok := r.Servicos[servico]; ok {
+		res.ServicoNovo = novo
+		res.Alterado = novo != servico
+		return res, nil
+	}
+	for _, novo := range r.Servicos {
+		if novo == servico {
+			res.ServicoNovo = servico
+			return res, nil
+		}
+	}
+	return res, fmt.Errorf("%w: %s na regra %q da tabela %s", ErrTrocaServicoSemMapeamento, servico, r.Nome, t.Versao)
+}
+
+// regra primeira regra da tabela para os pacotes, ou nil
+func (t *TabelaServicos) regra(origem, destino string) *RegraTroca {
+	for i := range t.Regras {
+		r := &t.Regras[i]
+		if contem(r.Origens, origem) && (len(r.Destinos) == 0 || contem(r.Destinos, destino)) {
+			return r
+		}
+	}
+	return nil
+}
+
+func contem(lista []string, s string) bool {
+	for _, v := range lista {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ExplicaTrocaServico indica qual regra da tabela atual TrocaServico aplicaria ao objeto
+func (o *Objeto) ExplicaTrocaServico(pacoteOrigem string, pacoteDestino string) (ResultadoTroca, error) {
+	res, err := TabelaServicosAtual().Explica(pacoteOrigem, pacoteDestino, o.CodigoServicoPostagem)
+	res.Etiqueta = o.NumeroEtiqueta
+	return res, err
+}
+
+// OpcoesTroca opções da troca de serviços de todos os objetos da PLP
+type OpcoesTroca struct {
+	// Tabela tabela de troca, nil para a tabela atual
+	Tabela *TabelaServicos
+	// Servicos serviços do contrato, como devolvidos por BuscaServicos. Quando
+	// informados, trocas para serviços fora da lista não são feitas.
+	Servicos []Servico
+	// DryRun monta o relatório sem alterar os objetos
+	DryRun bool
+}
+
+// FalhaTroca objeto cujo serviço não pôde ser trocado
+type FalhaTroca struct {
+	ResultadoTroca
+	Err error
+}
+
+// RelatorioTroca resultado da troca de serviços de todos os objetos da PLP
+type RelatorioTroca struct {
+	Alterados   []ResultadoTroca
+	Inalterados []ResultadoTroca
+	// NaoMapeados objetos sem regra, sem mapeamento ou com serviço novo fora do
+	// contrato, que mantêm o serviço anterior
+	NaoMapeados []FalhaTroca
+}
+
+// Completo indica se todos os objetos tiveram o serviço trocado ou mantido
+func (r *RelatorioTroca) Completo() bool {
+	return len(r.NaoMapeados) == 0
+}
+
+// TrocaServicos troca o serviço de todos os objetos da PLP do pacote origem para
+// o pacote destino. Os objetos que não podem ser trocados mantêm o serviço e são
+// listados em NaoMapeados. Com opcoes nil, usa a tabela atual sem validar os
+// serviços do contrato.
+func (p *Plp) TrocaServicos(origem, destino string, opcoes *OpcoesTroca) *RelatorioTroca {
+	if opcoes == nil {
+		opcoes = &OpcoesTroca{}
+	}
+	tabela := opcoes.Tabela
+	if tabela == nil {
+		tabela = TabelaServicosAtual()
+	}
+	var contrato map[string]bool
+	if opcoes.Servicos != nil {
+		contrato = make(map[string]bool, len(opcoes.Servicos))
+		for _, s := range opcoes.Servicos {
+			contrato[strings.TrimSpace(s.Codigo)] = true
+		}
+	}
+	rel := &RelatorioTroca{}
+	for _, o := range p.Objetos {
+		res, err := tabela.Explica(origem, destino, o.CodigoServicoPostagem)
+		res.Etiqueta = o.NumeroEtiqueta
+		if err == nil && contrato != nil && !contrato[res.ServicoNovo] {
+			err = fmt.Errorf("%w: %s", ErrServicoForaDoContrato, res.ServicoNovo)
+		}
+		switch {
+		case err != nil:
+			rel.NaoMapeados = append(rel.NaoMapeados, FalhaTroca{res, err})
+		case res.Alterado:
+			if !opcoes.DryRun {
+				o.CodigoServicoPostagem = res.ServicoNovo
+			}
+			rel.Alterados = append(rel.Alterados, res)
+		default:
+			rel.Inalterados = append(rel.Inalterados, res)
+		}
+	}
+	return rel
+}
@@ -0,0 +1,378 @@
+package plp
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// trocaServicoOriginal switch de TrocaServico anterior à tabela de troca, usado
+// como referência da versão 2020.1
+func trocaServicoOriginal(pacoteOrigem, pacoteDestino, servico string) string {
+	o := &Objeto{CodigoServicoPostagem: servico}
+	switch pacoteOrigem {
+	case "2.0":
+		switch pacoteDestino {
+		case "bronze":
+			switch o.CodigoServicoPostagem {
+			case "04537":
+				o.CodigoServicoPostagem = "03042"
+			case "04553":
+				o.CodigoServicoPostagem = "03050"
+			case "04596":
+				o.CodigoServicoPostagem = "03085"
+			case "04618":
+				o.CodigoServicoPostagem = "03107"
+			case "40215":
+				o.CodigoServicoPostagem = "04790"
+			case "40169":
+				o.CodigoServicoPostagem = "04782"
+			case "40290":
+				o.CodigoServicoPostagem = "04804"
+			}
+		case "prata", "ouro", "platinum", "diamante", "infinite":
+			switch o.CodigoServicoPostagem {
+			case "04537":
+				o.CodigoServicoPostagem = "03212"
+			case "04553":
+				o.CodigoServicoPostagem = "03220"
+			case "04596":
+				o.CodigoServicoPostagem = "03298"
+			case "04618":
+				o.CodigoServicoPostagem = "03328"
+			case "40215":
+				o.CodigoServicoPostagem = "03158"
+			case "40169":
+				o.CodigoServicoPostagem = "03140"
+			case "40290":
+				o.CodigoServicoPostagem = "03204"
+			}
+		}
+	case "2.1", "2.2", "2.3", "2.4", "2.5", "2.6", "2.7", "2.8", "2.9":
+		switch pacoteDestino {
+		case "bronze":
+			switch o.CodigoServicoPostagem {
+			case "40169":
+				o.CodigoServicoPostagem = "04782"
+			case "40215":
+				o.CodigoServicoPostagem = "04790"
+			case "40290":
+				o.CodigoServicoPostagem = "04804"
+			case "04138":
+				o.CodigoServicoPostagem = "03042"
+			case "04162":
+				o.CodigoServicoPostagem = "03050"
+			case "04669":
+				o.CodigoServicoPostagem = "03085"
+			case "04693":
+				o.CodigoServicoPostagem = "03107"
+			}
+		case "prata", "ouro", "platinum", "diamante", "infinite":
+			switch o.CodigoServicoPostagem {
+			case "40169":
+				o.CodigoServicoPostagem = "03140"
+			case "40215":
+				o.CodigoServicoPostagem = "03158"
+			case "40290":
+				o.CodigoServicoPostagem = "03204"
+			case "04138":
+				o.CodigoServicoPostagem = "03212"
+			case "04162":
+				o.CodigoServicoPostagem = "03220"
+			case "04669":
+				o.CodigoServicoPostagem = "03298"
+			case "04693":
+				o.CodigoServicoPostagem = "03328"
+			}
+		}
+	case "5.1", "5.2", "5.3", "5.4", "5.5", "5.6", "5.7":
+		switch pacoteDestino {
+		case "bronze":
+			switch o.CodigoServicoPostagem {
+			case "40169":
+				o.CodigoServicoPostagem = "04782"
+			case "40215":
+				o.CodigoServicoPostagem = "04790"
+			case "40290":
+				o.CodigoServicoPostagem = "04804"
+			case "04138":
+				o.CodigoServicoPostagem = "03042"
+			case "04162":
+				o.CodigoServicoPostagem = "03050"
+			case "04669":
+				o.CodigoServicoPostagem = "03085"
+			case "04693":
+				o.CodigoServicoPostagem = "03107"
+			case "04316":
+				o.CodigoServicoPostagem = "03050"
+			case "04812":
+				o.CodigoServicoPostagem = "03085"
+			}
+		case "prata", "ouro", "platinum":
+			switch o.CodigoServicoPostagem {
+			case "40169":
+				o.CodigoServicoPostagem = "03140"
+			case "40215":
+				o.CodigoServicoPostagem = "03158"
+			case "40290":
+				o.CodigoServicoPostagem = "03204"
+			case "04138":
+				o.CodigoServicoPostagem = "03212"
+			case "04162":
+				o.CodigoServicoPostagem = "03220"
+			case "04669":
+				o.CodigoServicoPostagem = "03298"
+			case "04693":
+				o.CodigoServicoPostagem = "03328"
+			case "04316":
+				o.CodigoServicoPostagem = "03220"
+			case "04812":
+				o.CodigoServicoPostagem = "03298"
+			}
+		case "diamante", "infinite":
+			switch o.CodigoServicoPostagem {
+			case "40169":
+				o.CodigoServicoPostagem = "03140"
+			case "40215":
+				o.CodigoServicoPostagem = "03158"
+			case "40290":
+				o.CodigoServicoPostagem = "03204"
+			case "04138":
+				o.CodigoServicoPostagem = "03212"
+			case "04162":
+				o.CodigoServicoPostagem = "03220"
+			case "04669":
+				o.CodigoServicoPostagem = "03298"
+			case "04693":
+				o.CodigoServicoPostagem = "03328"
+			case "04316":
+				o.CodigoServicoPostagem = "03280"
+			case "04812":
+				o.CodigoServicoPostagem = "03336"
+			}
+		}
+	case "bronze":
+		switch o.CodigoServicoPostagem {
+		case "04782":
+			o.CodigoServicoPostagem = "03140"
+		case "04790":
+			o.CodigoServicoPostagem = "03158"
+		case "04804":
+			o.CodigoServicoPostagem = "03204"
+		case "03042":
+			o.CodigoServicoPostagem = "03212"
+		case "03052":
+			o.CodigoServicoPostagem = "03220"
+		case "03085":
+			o.CodigoServicoPostagem = "03298"
+		case "03107":
+			o.CodigoServicoPostagem = "03328"
+		}
+	case "diamante", "infinite":
+		switch o.CodigoServicoPostagem {
+		case "03140":
+			o.CodigoServicoPostagem = "04782"
+		case "03158":
+			o.CodigoServicoPostagem = "04790"
+		case "03204":
+			o.CodigoServicoPostagem = "04804"
+		case "03212":
+			o.CodigoServicoPostagem = "03042"
+		case "03220":
+			o.CodigoServicoPostagem = "03050"
+		case "03298":
+			o.CodigoServicoPostagem = "03085"
+		case "03328":
+			o.CodigoServicoPostagem = "03107"
+		case "03282":
+			o.CodigoServicoPostagem = "03050"
+		case "03336":
+			o.CodigoServicoPostagem = "03085"
+		}
+	}
+	return o.CodigoServicoPostagem
+}
+
+// correcoes2020_2 trocas acrescentadas na versão 2020.2, por origem e serviço
+var correcoes2020_2 = map[[2]string]string{
+	{"bronze", "03050"}:   "03220",
+	{"diamante", "03280"}: "03050",
+	{"infinite", "03280"}: "03050",
+}
+
+func TestTabelaServicosPadraoComparaSwitchOriginal(t *testing.T) {
+	origens := []string{"2.0", "2.1", "2.5", "2.9", "5.1", "5.4", "5.7", "bronze", "prata", "ouro", "platinum", "diamante", "infinite", "3.0"}
+	destinos := []string{"bronze", "prata", "ouro", "platinum", "diamante", "infinite", "outro"}
+	codigos := map[string]bool{"99999": true}
+	for _, r := range TabelaServicosPadrao().Regras {
+		for de, para := range r.Servicos {
+			codigos[de], codigos[para] = true, true
+		}
+	}
+	servicos := make([]string, 0, len(codigos))
+	for c := range codigos {
+		servicos = append(servicos, c)
+	}
+	sort.Strings(servicos)
+
+	tabela := TabelaServicosPadrao()
+	for _, origem := range origens {
+		for _, destino := range destinos {
+			for _, servico := range servicos {
+				esperado := trocaServicoOriginal(origem, destino, servico)
+				if c, ok := correcoes2020_2[[2]string{origem, servico}]; ok {
+					esperado = c
+				}
+				obtido := servico
+				res, err := tabela.Explica(origem, destino, servico)
+				if err == nil {
+					obtido = res.ServicoNovo
+				} else if !errors.Is(err, ErrTrocaServicoSemRegra) && !errors.Is(err, ErrTrocaServicoSemMapeamento) {
+					t.Fatalf("Explica(%s, %s, %s): %v", origem, destino, servico, err)
+				}
+				if obtido != esperado {
+					t.Errorf("troca de %s para %s do serviço %s = %s, esperado %s", origem, destino, servico, obtido, esperado)
+				}
+			}
+		}
+	}
+}
+
+func TestTabelaServicosPadraoVersao(t *testing.T) {
+	if v := TabelaServicosPadrao().Versao; v != "2020.2" {
+		t.Errorf("versão da tabela padrão = %s, esperado 2020.2", v)
+	}
+	o := &Objeto{NumeroEtiqueta: "SZ000000015BR", CodigoServicoPostagem: "03052"}
+	if err := o.TrocaServico("bronze", "prata"); err != nil || o.CodigoServicoPostagem != "03220" {
+		t.Errorf("troca de 03052 = %s, %v, esperado 03220", o.CodigoServicoPostagem, err)
+	}
+	o.CodigoServicoPostagem = "03282"
+	if err := o.TrocaServico("diamante", "bronze"); err != nil || o.CodigoServicoPostagem != "03050" {
+		t.Errorf("troca de 03282 = %s, %v, esperado 03050", o.CodigoServicoPostagem, err)
+	}
+}
+
+// tabelaTrocaTeste tabela com uma regra de bronze para prata
+func tabelaTrocaTeste(t *testing.T) *TabelaServicos {
+	t.Helper()
+	tabela, err := CarregaTabelaServicos(strings.NewReader(`{"versao": "teste", "regras": [{"nome": "bronze-prata",
+		"origens": ["bronze"], "destinos": ["prata"], "servicos": {"03050": "03220", "03085": "03298"}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tabela
+}
+
+// plpTrocaTeste PLP com um objeto por serviço, com etiquetas numeradas a partir de 1
+func plpTrocaTeste(servicos ...string) *Plp {
+	p := &Plp{}
+	for i, s := range servicos {
+		e := Etiqueta{Prefixo: "SZ", Numero: i + 1, Sufixo: "BR"}
+		p.Objetos = append(p.Objetos, &Objeto{NumeroEtiqueta: e.String(), CodigoServicoPostagem: s})
+	}
+	return p
+}
+
+// servicosObjetos serviços dos objetos da PLP, na ordem
+func servicosObjetos(p *Plp) []string {
+	servicos := make([]string, len(p.Objetos))
+	for i, o := range p.Objetos {
+		servicos[i] = o.CodigoServicoPostagem
+	}
+	return servicos
+}
+
+// anteriores serviços anteriores dos resultados, na ordem
+func anteriores(resultados []ResultadoTroca) []string {
+	servicos := make([]string, len(resultados))
+	for i, r := range resultados {
+		servicos[i] = r.ServicoAnterior
+	}
+	return servicos
+}
+
+func TestPlpTrocaServicos(t *testing.T) {
+	p := plpTrocaTeste("03050", "03298", "99999", "03085")
+	rel := p.TrocaServicos("bronze", "prata", &OpcoesTroca{Tabela: tabelaTrocaTeste(t)})
+
+	if a := anteriores(rel.Alterados); !reflect.DeepEqual(a, []string{"03050", "03085"}) {
+		t.Errorf("alterados = %v", rel.Alterados)
+	}
+	if rel.Alterados[0].ServicoNovo != "03220" || rel.Alterados[0].Etiqueta != p.Objetos[0].NumeroEtiqueta || rel.Alterados[0].Versao != "teste" {
+		t.Errorf("alterado = %+v", rel.Alterados[0])
+	}
+	if i := anteriores(rel.Inalterados); !reflect.DeepEqual(i, []string{"03298"}) || rel.Inalterados[0].Alterado {
+		t.Errorf("inalterados = %v", rel.Inalterados)
+	}
+	if len(rel.NaoMapeados) != 1 || rel.NaoMapeados[0].ServicoAnterior != "99999" ||
+		!errors.Is(rel.NaoMapeados[0].Err, ErrTrocaServicoSemMapeamento) {
+		t.Errorf("não mapeados = %v", rel.NaoMapeados)
+	}
+	if rel.Completo() {
+		t.Error("Completo() verdadeiro com objeto não mapeado")
+	}
+	if s := servicosObjetos(p); !reflect.DeepEqual(s, []string{"03220", "03298", "99999", "03298"}) {
+		t.Errorf("serviços após a troca = %v", s)
+	}
+
+	// sem regra para os pacotes, nenhum objeto é alterado
+	rel = p.TrocaServicos("ouro", "prata", &OpcoesTroca{Tabela: tabelaTrocaTeste(t)})
+	if len(rel.NaoMapeados) != 4 || len(rel.Alterados)+len(rel.Inalterados) != 0 ||
+		!errors.Is(rel.NaoMapeados[0].Err, ErrTrocaServicoSemRegra) {
+		t.Errorf("troca sem regra = %+v", rel)
+	}
+}
+
+func TestPlpTrocaServicosDryRun(t *testing.T) {
+	p := plpTrocaTeste("03050", "03298", "99999")
+	rel := p.TrocaServicos("bronze", "prata", &OpcoesTroca{Tabela: tabelaTrocaTeste(t), DryRun: true})
+	if len(rel.Alterados) != 1 || rel.Alterados[0].ServicoNovo != "03220" || len(rel.Inalterados) != 1 || len(rel.NaoMapeados) != 1 {
+		t.Errorf("relatório = %+v", rel)
+	}
+	if s := servicosObjetos(p); !reflect.DeepEqual(s, []string{"03050", "03298", "99999"}) {
+		t.Errorf("DryRun alterou os objetos: %v", s)
+	}
+}
+
+func TestPlpTrocaServicosContrato(t *testing.T) {
+	p := plpTrocaTeste("03050", "03085", "03298")
+	contrato := []Servico{{Codigo: "03220 "}, {Codigo: "04227"}}
+	rel := p.TrocaServicos("bronze", "prata", &OpcoesTroca{Tabela: tabelaTrocaTeste(t), Servicos: contrato})
+
+	if a := anteriores(rel.Alterados); !reflect.DeepEqual(a, []string{"03050"}) {
+		t.Errorf("alterados = %v", rel.Alterados)
+	}
+	// 03298 não está no contrato, seja como serviço novo ou como serviço mantido
+	if len(rel.NaoMapeados) != 2 || len(rel.Inalterados) != 0 {
+		t.Fatalf("relatório = %+v", rel)
+	}
+	for _, f := range rel.NaoMapeados {
+		if !errors.Is(f.Err, ErrServicoForaDoContrato) || f.ServicoNovo != "03298" {
+			t.Errorf("não mapeado = %+v", f)
+		}
+	}
+	if s := servicosObjetos(p); !reflect.DeepEqual(s, []string{"03220", "03085", "03298"}) {
+		t.Errorf("serviços após a troca = %v", s)
+	}
+
+	// lista vazia, diferente de nil, não aceita nenhum serviço
+	p = plpTrocaTeste("03050")
+	if rel := p.TrocaServicos("bronze", "prata", &OpcoesTroca{Tabela: tabelaTrocaTeste(t), Servicos: []Servico{}}); len(rel.NaoMapeados) != 1 {
+		t.Errorf("troca com contrato sem serviços = %+v", rel)
+	}
+}
+
+func TestPlpTrocaServicosTabelaAtual(t *testing.T) {
+	DefineTabelaServicos(tabelaTrocaTeste(t))
+	defer DefineTabelaServicos(nil)
+	p := plpTrocaTeste("03050")
+	rel := p.TrocaServicos("bronze", "prata", nil)
+	if len(rel.Alterados) != 1 || rel.Alterados[0].Versao != "teste" || p.Objetos[0].CodigoServicoPostagem != "03220" {
+		t.Errorf("relatório com opções nil = %+v", rel)
+	}
+	if !rel.Completo() {
+		t.Error("Completo() falso sem objetos não mapeados")
+	}
+}
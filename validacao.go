@@ -0,0 +1,308 @@
+package plp
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErroCampo falha de validação de um campo, identificado pelo caminho no XML da
+// PLP, por exemplo "remetente.cep_remetente"
+type ErroCampo struct {
+	Campo string
+	Err   error
+}
+
+func (e *ErroCampo) Error() string {
+	return e.Campo + ": " + e.Err.Error()
+}
+
+// Unwrap devolve o erro do campo, por exemplo ErrCepRemetente
+func (e *ErroCampo) Unwrap() error {
+	return e.Err
+}
+
+// ErrosValidacao lista de todos os campos inválidos encontrados na validação
+type ErrosValidacao []*ErroCampo
+
+func (e ErrosValidacao) Error() string {
+	msgs := make([]string, len(e))
+	for i, c := range e {
+		msgs[i] = c.Error()
+	}
+	return fmt.Sprintf("negocio: %d campo(s) inválido(s): %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Is permite testar com errors.Is se algum dos campos falhou com target
+func (e ErrosValidacao) Is(target error) bool {
+	for _, c := range e {
+		if errors.Is(c, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As permite obter com errors.As o primeiro campo que corresponda a target
+func (e ErrosValidacao) As(target interface{}) bool {
+	for _, c := range e {
+		if errors.As(c, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// validador acumula os erros de validação de uma estrutura
+type validador struct {
+	prefixo string
+	erros   ErrosValidacao
+}
+
+// adiciona registra a falha no campo
+func (v *validador) adiciona(campo string, err error) {
+	v.erros = append(v.erros, &ErroCampo{Campo: v.prefixo + campo, Err: err})
+}
+
+// obrigatorio valida um campo que deve ser informado, com até max caracteres
+// e, quando re não for nula, no formato da expressão
+func (v *validador) obrigatorio(campo string, valor string, max int, re *regexp.Regexp, err error) {
+	if strings.TrimSpace(valor) == "" {
+		v.adiciona(campo, fmt.Errorf("%w: campo obrigatório", err))
+		return
+	}
+	v.opcional(campo, valor, max, re, err)
+}
+
+// opcional valida um campo que pode ficar vazio, com até max caracteres e,
+// quando re não for nula, no formato da expressão
+func (v *validador) opcional(campo string, valor string, max int, re *regexp.Regexp, err error) {
+	if valor == "" {
+		return
+	}
+	if max > 0 && utf8.RuneCountInString(valor) > max {
+		v.adiciona(campo, fmt.Errorf("%w: máximo de %d caracteres", err, max))
+		return
+	}
+	if re != nil && !re.MatchString(valor) {
+		v.adiciona(campo, err)
+	}
+}
+
+// erro devolve os erros acumulados ou nil
+func (v *validador) erro() error {
+	if len(v.erros) == 0 {
+		return nil
+	}
+	return v.erros
+}
+
+// Validate verifica os campos da PLP, do remetente e de cada objeto postal conforme
+// as regras do SIGEPWEB, devolvendo ErrosValidacao com todos os campos inválidos ou nil
+func (p *Plp) Validate() error {
+	v := &validador{}
+	if p.TipoArquivo != "Postagem" {
+		v.adiciona("tipo_arquivo", ErrTipoArquivo)
+	}
+	v.obrigatorio("versao_arquivo", p.VersaoArquivo, 5, nil, ErrVersaoArquivo)
+	v.obrigatorio("plp.cartao_postagem", p.Plp.CartaoPostagem, 0, erCartao, ErrCartaoInvalido)
+
+	r := &p.Remetente
+	v.obrigatorio("remetente.numero_contrato", r.NumeroContrato, 0, erContrato, ErrContratoInvalido)
+	v.obrigatorio("remetente.numero_diretoria", r.NumeroDiretoria, 0, erDr, ErrDrInvalido)
+	v.obrigatorio("remetente.codigo_administrativo", r.CodigoAdministrativo, 0, erCodAdm, ErrCodAdmInvalido)
+	v.obrigatorio("remetente.nome_remetente", r.NomeRemetente.CData, 50, nil, ErrNomeRemetente)
+	v.obrigatorio("remetente.logradouro_remetente", r.LogradouroRemetente.CData, 50, nil, ErrLogradouroRemetente)
+	v.obrigatorio("remetente.numero_remetente", r.NumeroRemetente.CData, 6, nil, ErrNumeroRemetente)
+	v.opcional("remetente.complemento_remetente", r.ComplementoRemetente.CData, 30, nil, ErrComplementoRemetente)
+	v.obrigatorio("remetente.bairro_remetente", r.BairroRemetente.CData, 30, nil, ErrBairroRemetente)
+	v.obrigatorio("remetente.cep_remetente", r.CepRemetente.CData, 0, erCep, ErrCepRemetente)
+	v.obrigatorio("remetente.cidade_remetente", r.CidadeRemetente.CData, 30, nil, ErrCidadeRemetente)
+	v.obrigatorio("remetente.uf_remetente", r.UfRemetente, 0, erUf, ErrUfRemetente)
+	v.opcional("remetente.telefone_remetente", r.TelefoneRemetente.CData, 12, erTelefone, ErrTelefoneRemetente)
+	v.opcional("remetente.fax_remetente", r.FaxRemetente.CData, 12, erTelefone, ErrFaxRemetente)
+	v.opcional("remetente.email_remetente", r.EmailRemetente.CData, 50, erEmail, ErrEmailRemetente)
+	v.opcional("remetente.celular_remetente", r.CelularRemetente.CData, 12, erTelefone, ErrCelularRemetente)
+	v.opcional("remetente.cpf_cnpj_remetente", r.CpfCnpjRemetente, 0, erCpfCnpj, ErrCpfCnpjRemetente)
+
+	if len(p.Objetos) == 0 {
+		v.adiciona("objeto_postal", ErrPlpSemObjetos)
+	}
+	for i, o := range p.Objetos {
+		v.prefixo = fmt.Sprintf("objeto_postal[%d].", i)
+		o.valida(v)
+	}
+	return v.erro()
+}
+
+// etiquetaProvisoria etiqueta usada no XML da PLP antes da etiqueta definitiva,
+// substituída por FechaPlpVariosServicos
+const etiquetaProvisoria = "XX000000000XX"
+
+// Tipos de objeto do elemento tipo_objeto
+const (
+	TipoObjetoEnvelope = "001"
+	TipoObjetoCaixa    = "002"
+	TipoObjetoCilindro = "003"
+)
+
+// pesoMaximoPadrao peso máximo, em gramas, dos serviços sem limite específico
+const pesoMaximoPadrao = 30000
+
+// pesoMaximoServico peso máximo, em gramas, dos serviços com limite menor que o padrão
+var pesoMaximoServico = map[string]int{
+	// SEDEX 12
+	"40169": 10000, "04782": 10000, "03140": 10000,
+	// SEDEX 10
+	"40215": 10000, "04790": 10000, "03158": 10000,
+	// SEDEX Hoje
+	"40290": 10000, "04804": 10000, "03204": 10000,
+	// Mini Envios
+	"04227": 300,
+	// Carta comercial
+	"80250": 500, "10065": 500, "10138": 500,
+}
+
+// limite intervalo aceito para uma dimensão, em centímetros
+type limite struct {
+	min, max float64
+}
+
+// limitesDimensoes limites de altura, largura, comprimento e diâmetro por tipo de
+// objeto; limites zerados indicam dimensão não considerada
+var limitesDimensoes = map[string]struct {
+	altura, largura, comprimento, diametro limite
+	soma                                   float64
+}{
+	TipoObjetoEnvelope: {largura: limite{11, 60}, comprimento: limite{16, 60}},
+	TipoObjetoCaixa:    {altura: limite{2, 100}, largura: limite{11, 100}, comprimento: limite{16, 100}, soma: 200},
+	TipoObjetoCilindro: {comprimento: limite{18, 100}, diametro: limite{5, 91}, soma: 200},
+}
+
+var (
+	erServico          = regexp.MustCompile(`^[0-9]{5}$`)
+	erServicoAdicional = regexp.MustCompile(`^[0-9]{3}$`)
+	erNumeroNotaFiscal = regexp.MustCompile(`^[0-9]{1,7}$`)
+	erValor            = regexp.MustCompile(`^[0-9]+([.,][0-9]{1,2})?$`)
+	erDimensao         = regexp.MustCompile(`^[0-9]+([.,][0-9]+)?$`)
+	erSerieNotaFiscal  = regexp.MustCompile(`^[0-9A-Za-z]{1,3}$`)
+)
+
+// Validate verifica os campos do objeto postal conforme o layout do SIGEPWEB,
+// devolvendo ErrosValidacao com todos os campos inválidos ou nil
+func (o *Objeto) Validate() error {
+	v := &validador{}
+	o.valida(v)
+	return v.erro()
+}
+
+// valida acumula em v os erros do objeto, com os caminhos relativos ao objeto_postal
+func (o *Objeto) valida(v *validador) {
+	o.validaEtiqueta(v)
+	if !o.Estado().Valido() {
+		v.adiciona("status", fmt.Errorf("%w: %d", ErrEstadoObjetoInvalido, o.StatusTabela))
+	}
+	servicoValido := erServico.MatchString(o.CodigoServicoPostagem)
+	if !servicoValido {
+		v.adiciona("codigo_servico_postagem", ErrServicoInvalido)
+	}
+	if o.Peso <= 0 {
+		v.adiciona("peso", fmt.Errorf("%w: peso deve ser positivo", ErrPesoInvalido))
+	} else if servicoValido {
+		max, ok := pesoMaximoServico[o.CodigoServicoPostagem]
+		if !ok {
+			max = pesoMaximoPadrao
+		}
+		if o.Peso > max {
+			v.adiciona("peso", fmt.Errorf("%w: máximo de %dg", ErrPesoInvalido, max))
+		}
+	}
+
+	d := &o.Destinatario
+	v.obrigatorio("destinatario.nome_destinatario", d.NomeDestinatario.CData, 50, nil, ErrNomeDestinatario)
+	v.opcional("destinatario.telefone_destinatario", d.TelefoneDestinatario.CData, 12, erTelefone, ErrTelefoneDestinatario)
+	v.opcional("destinatario.celular_destinatario", d.CelularDestinatario.CData, 12, erTelefone, ErrCelularDestinatario)
+	v.opcional("destinatario.email_destinatario", d.EmailDestinatario.CData, 50, erEmail, ErrEmailDestinatario)
+	v.obrigatorio("destinatario.logradouro_destinatario", d.LogradouroDestinatario.CData, 50, nil, ErrLogradouroDestinatario)
+	v.opcional("destinatario.complemento_destinatario", d.ComplementoDestinatario.CData, 30, nil, ErrComplementoDestinatario)
+	v.obrigatorio("destinatario.numero_end_destinatario", d.NumeroEndDestinatario.CData, 6, nil, ErrNumeroDestinatario)
+	v.opcional("destinatario.cpf_cnpj_destinatario", d.CpfCnpjDestinatario, 0, erCpfCnpj, ErrCpfCnpjDestinatario)
+
+	n := &o.Nacional
+	v.obrigatorio("nacional.bairro_destinatario", n.BairroDestinatario.CData, 30, nil, ErrBairroDestinatario)
+	v.obrigatorio("nacional.cidade_destinatario", n.CidadeDestinatario.CData, 30, nil, ErrCidadeDestinatario)
+	v.obrigatorio("nacional.uf_destinatario", n.UfDestinatario, 0, erUf, ErrUfDestinatario)
+	v.obrigatorio("nacional.cep_destinatario", n.CepDestinatario.CData, 0, erCep, ErrCepDestinatario)
+	v.opcional("nacional.numero_nota_fiscal", n.NumeroNotaFiscal, 0, erNumeroNotaFiscal, ErrNumeroNotaFiscal)
+	v.opcional("nacional.serie_nota_fiscal", n.SerieNotaFiscal, 0, erSerieNotaFiscal, ErrSerieNotaFiscal)
+	v.opcional("nacional.valor_nota_fiscal", n.ValorNotaFiscal, 0, erValor, ErrValorNotaFiscal)
+	v.opcional("nacional.descricao_objeto", n.DescricaoObjeto.CData, 255, nil, ErrDescricaoObjeto)
+	v.opcional("nacional.valor_a_cobrar", n.ValorACobrar, 0, erValor, ErrValorACobrar)
+
+	for i, sa := range o.ServicoAdicional {
+		prefixo := fmt.Sprintf("servico_adicional[%d].", i)
+		for j, c := range sa.CodigoServicoAdicional {
+			v.opcional(fmt.Sprintf("%scodigo_servico_adicional[%d]", prefixo, j), strings.TrimSpace(c), 0, erServicoAdicional, ErrServicoAdicional)
+		}
+		v.opcional(prefixo+"valor_declarado", sa.ValorDeclarado, 0, erValor, ErrValorDeclarado)
+	}
+
+	o.validaDimensoes(v)
+}
+
+// validaEtiqueta verifica o formato e o dígito verificador da etiqueta
+func (o *Objeto) validaEtiqueta(v *validador) {
+	e := o.NumeroEtiqueta
+	if e == etiquetaProvisoria {
+		return
+	}
+	et, err := ParseEtiqueta(e)
+	switch {
+	case errors.Is(err, ErrDVEtiqueta):
+		v.adiciona("numero_etiqueta", ErrDVEtiqueta)
+	case err != nil || et.String() != e:
+		// no XML a etiqueta vai completa, sem espaços e em maiúsculas
+		v.adiciona("numero_etiqueta", ErrEtiquetaInvalida)
+	}
+}
+
+// validaDimensoes verifica as dimensões conforme o tipo do objeto
+func (o *Objeto) validaDimensoes(v *validador) {
+	dim := &o.Dimensoes
+	limites, ok := limitesDimensoes[dim.Tipo]
+	if !ok {
+		v.adiciona("dimensao_objeto.tipo_objeto", ErrTipoObjetoInvalido)
+		return
+	}
+	var soma float64
+	valida := func(campo string, valor string, l limite, err error) float64 {
+		if l.max == 0 {
+			return 0
+		}
+		if !erDimensao.MatchString(valor) {
+			v.adiciona(campo, err)
+			return 0
+		}
+		f, _ := strconv.ParseFloat(strings.Replace(valor, ",", ".", 1), 64)
+		if f < l.min || f > l.max {
+			v.adiciona(campo, fmt.Errorf("%w: entre %gcm e %gcm", err, l.min, l.max))
+		}
+		return f
+	}
+	altura := valida("dimensao_objeto.dimensao_altura", dim.Altura, limites.altura, ErrAlturaInvalida)
+	largura := valida("dimensao_objeto.dimensao_largura", dim.Largura, limites.largura, ErrLarguraInvalida)
+	comprimento := valida("dimensao_objeto.dimensao_comprimento", dim.Comprimento, limites.comprimento, ErrComprimentoInvalido)
+	diametro := valida("dimensao_objeto.dimensao_diametro", dim.Diametro, limites.diametro, ErrDiametroInvalido)
+	switch dim.Tipo {
+	case TipoObjetoCaixa:
+		soma = altura + largura + comprimento
+	case TipoObjetoCilindro:
+		soma = comprimento + 2*diametro
+	}
+	if limites.soma > 0 && soma > limites.soma {
+		v.adiciona("dimensao_objeto", fmt.Errorf("%w: máximo de %gcm", ErrSomaDimensoes, limites.soma))
+	}
+}
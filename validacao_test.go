@@ -0,0 +1,214 @@
+package plp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// plpValida PLP de testdata que passa na validação
+func plpValida(t *testing.T) *Plp {
+	t.Helper()
+	p := lePlpTeste(t, "plp_iso88591.xml")
+	p.Objetos[1].NumeroEtiqueta = "SZ000000028BR"
+	if err := p.Validate(); err != nil {
+		t.Fatalf("PLP de teste inválida: %v", err)
+	}
+	return &p
+}
+
+// erroUnico confere que err tem um único campo inválido, o campo informado, com o erro esperado
+func erroUnico(t *testing.T, err error, campo string, esperado error) {
+	t.Helper()
+	var erros ErrosValidacao
+	if !errors.As(err, &erros) {
+		t.Fatalf("erro = %v, esperado ErrosValidacao", err)
+	}
+	if len(erros) != 1 || erros[0].Campo != campo || !errors.Is(erros[0], esperado) {
+		t.Errorf("erro = %v, esperado %s: %v", err, campo, esperado)
+	}
+}
+
+func TestPlpValidate(t *testing.T) {
+	longo := strings.Repeat("a", 51)
+	casos := []struct {
+		campo  string
+		altera func(p *Plp)
+		err    error
+	}{
+		{"tipo_arquivo", func(p *Plp) { p.TipoArquivo = "Lista" }, ErrTipoArquivo},
+		{"versao_arquivo", func(p *Plp) { p.VersaoArquivo = "" }, ErrVersaoArquivo},
+		{"versao_arquivo", func(p *Plp) { p.VersaoArquivo = "2.3.10" }, ErrVersaoArquivo},
+		{"plp.cartao_postagem", func(p *Plp) { p.Plp.CartaoPostagem = "67599079" }, ErrCartaoInvalido},
+		{"remetente.numero_contrato", func(p *Plp) { p.Remetente.NumeroContrato = "991220855" }, ErrContratoInvalido},
+		{"remetente.numero_diretoria", func(p *Plp) { p.Remetente.NumeroDiretoria = "1" }, ErrDrInvalido},
+		{"remetente.codigo_administrativo", func(p *Plp) { p.Remetente.CodigoAdministrativo = "8082650" }, ErrCodAdmInvalido},
+		{"remetente.nome_remetente", func(p *Plp) { p.Remetente.NomeRemetente.CData = " " }, ErrNomeRemetente},
+		{"remetente.nome_remetente", func(p *Plp) { p.Remetente.NomeRemetente.CData = longo }, ErrNomeRemetente},
+		{"remetente.logradouro_remetente", func(p *Plp) { p.Remetente.LogradouroRemetente.CData = longo }, ErrLogradouroRemetente},
+		{"remetente.numero_remetente", func(p *Plp) { p.Remetente.NumeroRemetente.CData = "1234567" }, ErrNumeroRemetente},
+		{"remetente.complemento_remetente", func(p *Plp) { p.Remetente.ComplementoRemetente.CData = longo[:31] }, ErrComplementoRemetente},
+		{"remetente.bairro_remetente", func(p *Plp) { p.Remetente.BairroRemetente.CData = "" }, ErrBairroRemetente},
+		{"remetente.cep_remetente", func(p *Plp) { p.Remetente.CepRemetente.CData = "01310-100" }, ErrCepRemetente},
+		{"remetente.cidade_remetente", func(p *Plp) { p.Remetente.CidadeRemetente.CData = longo[:31] }, ErrCidadeRemetente},
+		{"remetente.uf_remetente", func(p *Plp) { p.Remetente.UfRemetente = "SPP" }, ErrUfRemetente},
+		{"remetente.telefone_remetente", func(p *Plp) { p.Remetente.TelefoneRemetente.CData = "(61)3333" }, ErrTelefoneRemetente},
+		{"remetente.fax_remetente", func(p *Plp) { p.Remetente.FaxRemetente.CData = "6133334444555" }, ErrFaxRemetente},
+		{"remetente.email_remetente", func(p *Plp) { p.Remetente.EmailRemetente.CData = "remetente@" }, ErrEmailRemetente},
+		{"remetente.celular_remetente", func(p *Plp) { p.Remetente.CelularRemetente.CData = "61 99999" }, ErrCelularRemetente},
+		{"remetente.cpf_cnpj_remetente", func(p *Plp) { p.Remetente.CpfCnpjRemetente = "3402831600010" }, ErrCpfCnpjRemetente},
+		{"objeto_postal", func(p *Plp) { p.Objetos = nil }, ErrPlpSemObjetos},
+		{"objeto_postal[1].peso", func(p *Plp) { p.Objetos[1].Peso = 0 }, ErrPesoInvalido},
+		{"objeto_postal[0].numero_etiqueta", func(p *Plp) { p.Objetos[0].NumeroEtiqueta = "SZ000000015BR" }, ErrDVEtiqueta},
+	}
+	for _, c := range casos {
+		p := plpValida(t)
+		c.altera(p)
+		t.Run(c.campo, func(t *testing.T) {
+			erroUnico(t, p.Validate(), c.campo, c.err)
+		})
+	}
+}
+
+func TestPlpValidateAcumulaErros(t *testing.T) {
+	p := plpValida(t)
+	p.Remetente.CepRemetente.CData = ""
+	p.Remetente.UfRemetente = "S"
+	p.Objetos[1].CodigoServicoPostagem = "3220"
+
+	err := p.Validate()
+	var erros ErrosValidacao
+	if !errors.As(err, &erros) || len(erros) != 3 {
+		t.Fatalf("erro = %v, esperado 3 campos", err)
+	}
+	campos := []string{"remetente.cep_remetente", "remetente.uf_remetente", "objeto_postal[1].codigo_servico_postagem"}
+	for i, campo := range campos {
+		if erros[i].Campo != campo {
+			t.Errorf("campo %d = %s, esperado %s", i, erros[i].Campo, campo)
+		}
+	}
+	for _, e := range []error{ErrCepRemetente, ErrUfRemetente, ErrServicoInvalido} {
+		if !errors.Is(err, e) {
+			t.Errorf("errors.Is(%v) falso", e)
+		}
+	}
+	if errors.Is(err, ErrPesoInvalido) {
+		t.Error("errors.Is(ErrPesoInvalido) verdadeiro sem erro de peso")
+	}
+
+	// errors.As obtém o primeiro campo inválido
+	var campo *ErroCampo
+	if !errors.As(err, &campo) || campo.Campo != "remetente.cep_remetente" {
+		t.Errorf("errors.As = %v", campo)
+	}
+	if !strings.Contains(campo.Error(), "campo obrigatório") {
+		t.Errorf("campo vazio = %q, esperado campo obrigatório", campo.Error())
+	}
+	if !strings.HasPrefix(err.Error(), "negocio: 3 campo(s) inválido(s): remetente.cep_remetente: ") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+// objetoValido primeiro objeto da PLP de testdata: caixa 10x20x30cm, 300g, serviço 03220
+func objetoValido(t *testing.T) *Objeto {
+	t.Helper()
+	return plpValida(t).Objetos[0]
+}
+
+func TestObjetoValidate(t *testing.T) {
+	peso := func(servico string, peso int) func(o *Objeto) {
+		return func(o *Objeto) {
+			o.CodigoServicoPostagem = servico
+			o.Peso = peso
+		}
+	}
+	dimensoes := func(tipo, altura, largura, comprimento, diametro string) func(o *Objeto) {
+		return func(o *Objeto) {
+			d := &o.Dimensoes
+			d.Tipo, d.Altura, d.Largura, d.Comprimento, d.Diametro = tipo, altura, largura, comprimento, diametro
+		}
+	}
+	casos := []struct {
+		nome   string
+		altera func(o *Objeto)
+		campo  string
+		err    error
+	}{
+		{"peso zero", peso("03220", 0), "peso", ErrPesoInvalido},
+		{"peso padrão no limite", peso("03298", 30000), "", nil},
+		{"peso padrão acima", peso("03298", 30001), "peso", ErrPesoInvalido},
+		{"SEDEX 10 no limite", peso("03158", 10000), "", nil},
+		{"SEDEX 10 acima", peso("03158", 10001), "peso", ErrPesoInvalido},
+		{"Mini Envios no limite", peso("04227", 300), "", nil},
+		{"Mini Envios acima", peso("04227", 301), "peso", ErrPesoInvalido},
+		{"carta acima", peso("10065", 501), "peso", ErrPesoInvalido},
+		{"serviço inválido", peso("3220", 30001), "codigo_servico_postagem", ErrServicoInvalido},
+
+		{"envelope largura 10", dimensoes("001", "", "10", "20", ""), "dimensao_objeto.dimensao_largura", ErrLarguraInvalida},
+		{"envelope largura 11", dimensoes("001", "", "11", "20", ""), "", nil},
+		{"envelope largura 60", dimensoes("001", "", "60", "20", ""), "", nil},
+		{"envelope largura 61", dimensoes("001", "", "61", "20", ""), "dimensao_objeto.dimensao_largura", ErrLarguraInvalida},
+		{"envelope comprimento 15", dimensoes("001", "", "11", "15", ""), "dimensao_objeto.dimensao_comprimento", ErrComprimentoInvalido},
+		{"envelope ignora altura", dimensoes("001", "x", "11", "16", "x"), "", nil},
+		{"caixa altura 1", dimensoes("002", "1", "20", "30", ""), "dimensao_objeto.dimensao_altura", ErrAlturaInvalida},
+		{"caixa altura 2", dimensoes("002", "2", "20", "30", ""), "", nil},
+		{"caixa altura 101", dimensoes("002", "101", "20", "30", ""), "dimensao_objeto.dimensao_altura", ErrAlturaInvalida},
+		{"caixa com vírgula", dimensoes("002", "10,5", "20", "30", ""), "", nil},
+		{"caixa altura inválida", dimensoes("002", "10cm", "20", "30", ""), "dimensao_objeto.dimensao_altura", ErrAlturaInvalida},
+		{"caixa soma 200", dimensoes("002", "50", "50", "100", ""), "", nil},
+		{"caixa soma 201", dimensoes("002", "51", "50", "100", ""), "dimensao_objeto", ErrSomaDimensoes},
+		{"cilindro comprimento 17", dimensoes("003", "", "", "17", "10"), "dimensao_objeto.dimensao_comprimento", ErrComprimentoInvalido},
+		{"cilindro diâmetro 4", dimensoes("003", "", "", "20", "4"), "dimensao_objeto.dimensao_diametro", ErrDiametroInvalido},
+		{"cilindro diâmetro 5", dimensoes("003", "", "", "20", "5"), "", nil},
+		{"cilindro diâmetro 91", dimensoes("003", "", "", "18", "91"), "", nil},
+		{"cilindro soma 202", dimensoes("003", "", "", "100", "51"), "dimensao_objeto", ErrSomaDimensoes},
+		{"tipo de objeto", dimensoes("004", "10", "20", "30", ""), "dimensao_objeto.tipo_objeto", ErrTipoObjetoInvalido},
+
+		{"etiqueta provisória", func(o *Objeto) { o.NumeroEtiqueta = etiquetaProvisoria }, "", nil},
+		{"etiqueta DV", func(o *Objeto) { o.NumeroEtiqueta = "SZ000000015BR" }, "numero_etiqueta", ErrDVEtiqueta},
+		{"etiqueta sem DV", func(o *Objeto) { o.NumeroEtiqueta = "SZ00000001BR" }, "numero_etiqueta", ErrEtiquetaInvalida},
+		{"status", func(o *Objeto) { o.StatusTabela = 99 }, "status", ErrEstadoObjetoInvalido},
+
+		{"nome do destinatário", func(o *Objeto) { o.Destinatario.NomeDestinatario.CData = "" }, "destinatario.nome_destinatario", ErrNomeDestinatario},
+		{"telefone do destinatário", func(o *Objeto) { o.Destinatario.TelefoneDestinatario.CData = "61-3333" }, "destinatario.telefone_destinatario", ErrTelefoneDestinatario},
+		{"email do destinatário", func(o *Objeto) { o.Destinatario.EmailDestinatario.CData = "destinatario" }, "destinatario.email_destinatario", ErrEmailDestinatario},
+		{"CEP com hífen", func(o *Objeto) { o.Nacional.CepDestinatario.CData = "70002-900" }, "nacional.cep_destinatario", ErrCepDestinatario},
+		{"CEP vazio", func(o *Objeto) { o.Nacional.CepDestinatario.CData = "" }, "nacional.cep_destinatario", ErrCepDestinatario},
+		{"UF minúscula", func(o *Objeto) { o.Nacional.UfDestinatario = "df" }, "", nil},
+		{"UF", func(o *Objeto) { o.Nacional.UfDestinatario = "D" }, "nacional.uf_destinatario", ErrUfDestinatario},
+		{"nota fiscal com 7 dígitos", func(o *Objeto) { o.Nacional.NumeroNotaFiscal = "1234567" }, "", nil},
+		{"nota fiscal com 8 dígitos", func(o *Objeto) { o.Nacional.NumeroNotaFiscal = "12345678" }, "nacional.numero_nota_fiscal", ErrNumeroNotaFiscal},
+		{"série da nota fiscal", func(o *Objeto) { o.Nacional.SerieNotaFiscal = "ABCD" }, "nacional.serie_nota_fiscal", ErrSerieNotaFiscal},
+		{"valor da nota fiscal", func(o *Objeto) { o.Nacional.ValorNotaFiscal = "1.000,00" }, "nacional.valor_nota_fiscal", ErrValorNotaFiscal},
+		{"valor a cobrar com uma casa", func(o *Objeto) { o.Nacional.ValorACobrar = "10,5" }, "", nil},
+		{"valor a cobrar com três casas", func(o *Objeto) { o.Nacional.ValorACobrar = "10,555" }, "nacional.valor_a_cobrar", ErrValorACobrar},
+		{"valor a cobrar não numérico", func(o *Objeto) { o.Nacional.ValorACobrar = "abc" }, "nacional.valor_a_cobrar", ErrValorACobrar},
+
+		{"serviço adicional", func(o *Objeto) { o.ServicoAdicional[0].CodigoServicoAdicional[1] = "1" }, "servico_adicional[0].codigo_servico_adicional[1]", ErrServicoAdicional},
+		{"valor declarado", func(o *Objeto) { o.ServicoAdicional[0].ValorDeclarado = "R$ 150" }, "servico_adicional[0].valor_declarado", ErrValorDeclarado},
+	}
+	for _, c := range casos {
+		o := objetoValido(t)
+		c.altera(o)
+		t.Run(c.nome, func(t *testing.T) {
+			err := o.Validate()
+			if c.err == nil {
+				if err != nil {
+					t.Errorf("erro = %v, esperado nil", err)
+				}
+				return
+			}
+			erroUnico(t, err, c.campo, c.err)
+		})
+	}
+
+	// acima de 91cm de diâmetro o cilindro também excede a soma das dimensões
+	o := objetoValido(t)
+	o.Dimensoes.Tipo, o.Dimensoes.Comprimento, o.Dimensoes.Diametro = TipoObjetoCilindro, "18", "92"
+	err := o.Validate()
+	var erros ErrosValidacao
+	if !errors.As(err, &erros) || len(erros) != 2 || erros[0].Campo != "dimensao_objeto.dimensao_diametro" ||
+		!errors.Is(err, ErrDiametroInvalido) || !errors.Is(err, ErrSomaDimensoes) {
+		t.Errorf("cilindro com diâmetro 92 = %v", err)
+	}
+}